@@ -0,0 +1,154 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+
+	"github.com/congop/terraform-provider-saya/internal/saya"
+	"github.com/pkg/errors"
+	"golang.org/x/exp/slices"
+)
+
+// flagKind tells how a flag is parsed.
+type flagKind int
+
+const (
+	flagSingle flagKind = iota // --key value, given at most once
+	flagMulti                  // --key value, repeatable
+	flagBool                   // --key, without value
+	flagSecret                 // --key value, given at most once, otherwise read from its SAYA_ environment variable
+)
+
+// globalFlags are accepted by all sub-commands.
+var globalFlags = map[string]flagKind{
+	"--config":      flagSingle,
+	"--forge":       flagSingle,
+	"--license-key": flagSecret,
+	"--log-level":   flagSingle,
+}
+
+// cliArgs is a parsed command line.
+type cliArgs struct {
+	positional []string
+	values     map[string][]string
+	lookupEnv  func(key string) (string, bool)
+}
+
+// parseArgs parses the args following the sub-command; unknown flags are errors, so that
+// the provider does not silently pass flags saya does not know.
+func parseArgs(args []string, cmdFlags map[string]flagKind, lookupEnv func(key string) (string, bool)) (*cliArgs, error) {
+	parsed := &cliArgs{values: map[string][]string{}, lookupEnv: lookupEnv}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "--") {
+			parsed.positional = append(parsed.positional, arg)
+			continue
+		}
+		key, val, hasVal := strings.Cut(arg, "=")
+		kind, known := cmdFlags[key]
+		if !known {
+			kind, known = globalFlags[key]
+		}
+		switch {
+		case !known:
+			return nil, errors.Errorf("parseArgs -- unknown flag: flag=%s", key)
+		case kind == flagBool && hasVal:
+			return nil, errors.Errorf("parseArgs -- flag does not take a value: flag=%s", arg)
+		case kind == flagBool:
+			val = "true"
+		case !hasVal && i+1 >= len(args):
+			return nil, errors.Errorf("parseArgs -- flag needs a value: flag=%s", key)
+		case !hasVal:
+			i++
+			val = args[i]
+		}
+		if _, given := parsed.values[key]; given && kind != flagMulti {
+			return nil, errors.Errorf("parseArgs -- flag given more than once: flag=%s", key)
+		}
+		parsed.values[key] = append(parsed.values[key], val)
+	}
+	parsed.secretsFromEnv(cmdFlags)
+	parsed.secretsFromEnv(globalFlags)
+	return parsed, nil
+}
+
+// secretsFromEnv sets the secret flags not given as args from their SAYA_ environment variables.
+func (args *cliArgs) secretsFromEnv(flags map[string]flagKind) {
+	for key, kind := range flags {
+		if _, given := args.values[key]; given || kind != flagSecret {
+			continue
+		}
+		if val := args.Env(saya.SayaEnvKey(key)); val != "" {
+			args.values[key] = []string{val}
+		}
+	}
+}
+
+// Value returns the flag value; empty if not given.
+func (args *cliArgs) Value(key string) string {
+	if values := args.values[key]; len(values) != 0 {
+		return strings.TrimSpace(values[0])
+	}
+	return ""
+}
+
+// Env returns the value of the environment variable saya has been run with; empty if not set.
+func (args *cliArgs) Env(key string) string {
+	if args.lookupEnv == nil {
+		return ""
+	}
+	val, _ := args.lookupEnv(key)
+	return strings.TrimSpace(val)
+}
+
+// Values returns all the values of a repeatable flag.
+func (args *cliArgs) Values(key string) []string {
+	return args.values[key]
+}
+
+// Bool returns true if the boolean flag has been given.
+func (args *cliArgs) Bool(key string) bool {
+	return args.Value(key) == "true"
+}
+
+// Positional returns the positional arg at the index; empty if not given.
+func (args *cliArgs) Positional(index int) string {
+	if index >= len(args.positional) {
+		return ""
+	}
+	return strings.TrimSpace(args.positional[index])
+}
+
+// maxPositional returns an error if more positional args than expected have been given.
+func (args *cliArgs) maxPositional(max int) error {
+	if len(args.positional) > max {
+		return errors.Errorf("cliArgs.maxPositional -- too many args: max=%d args=%q", max, args.positional)
+	}
+	return nil
+}
+
+// Filters returns the --filter key=value pairs; unsupported keys are errors.
+func (args *cliArgs) Filters(supported ...string) (map[string]string, error) {
+	filters := map[string]string{}
+	for _, filter := range args.Values("--filter") {
+		key, val, found := strings.Cut(filter, "=")
+		if !found || !slices.Contains(supported, key) {
+			return nil, errors.Errorf("cliArgs.Filters -- unsupported filter: filter=%s supported=%v", filter, supported)
+		}
+		filters[key] = strings.TrimSpace(val)
+	}
+	return filters, nil
+}
@@ -0,0 +1,144 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/congop/terraform-provider-saya/internal/saya"
+	"github.com/pkg/errors"
+)
+
+const (
+	// defaultForge is the forge used if none is given, relative to the working directory as saya does.
+	defaultForge = ".forge"
+
+	forgeStateFile = "fake-saya-state.json"
+	forgeLockFile  = "fake-saya-state.lock"
+	forgeImagesDir = "images"
+
+	forgeLockTimeout = 30 * time.Second
+)
+
+// forgeState is the content of the forge: the pulled images and the vms run from them.
+type forgeState struct {
+	Images  []saya.ImageTagMetaData `json:"images"`
+	Vms     []saya.VmLsResultCmd    `json:"vms"`
+	VmCount int                     `json:"vm_count"`
+}
+
+// forge stores the forge state as json file in the forge directory.
+// Concurrent fake-saya processes, e.g. run by terraform in parallel, are serialized through a lock file.
+type forge struct {
+	dir string
+}
+
+func newForge(dir string) (*forge, error) {
+	if dir = strings.TrimSpace(dir); dir == "" {
+		dir = defaultForge
+	}
+	if err := os.MkdirAll(filepath.Join(dir, forgeImagesDir), 0700); err != nil {
+		return nil, errors.Wrapf(err, "newForge -- fail to create forge directory: dir=%s err=%v", dir, err)
+	}
+	return &forge{dir: dir}, nil
+}
+
+// imagePath returns the path of the image content in the forge.
+func (f *forge) imagePath(img *saya.ImageTagMetaData) string {
+	return filepath.Join(f.dir, forgeImagesDir, img.Sha256+"."+img.Type)
+}
+
+// read calls fn with the current forge state.
+func (f *forge) read(fn func(state *forgeState) error) error {
+	return f.withLock(func() error {
+		state, err := f.load()
+		if err != nil {
+			return err
+		}
+		return fn(state)
+	})
+}
+
+// update calls fn with the current forge state and saves the state if fn succeeds.
+func (f *forge) update(fn func(state *forgeState) error) error {
+	return f.withLock(func() error {
+		state, err := f.load()
+		if err != nil {
+			return err
+		}
+		if err := fn(state); err != nil {
+			return err
+		}
+		return f.save(state)
+	})
+}
+
+func (f *forge) load() (*forgeState, error) {
+	path := filepath.Join(f.dir, forgeStateFile)
+	stateJson, err := os.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		return &forgeState{}, nil
+	case err != nil:
+		return nil, errors.Wrapf(err, "forge.load -- fail to read state: path=%s err=%v", path, err)
+	}
+	state := &forgeState{}
+	if err := json.Unmarshal(stateJson, state); err != nil {
+		return nil, errors.Wrapf(err, "forge.load -- fail to unmarshal state: path=%s err=%v", path, err)
+	}
+	return state, nil
+}
+
+func (f *forge) save(state *forgeState) error {
+	path := filepath.Join(f.dir, forgeStateFile)
+	stateJson, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return errors.Wrapf(err, "forge.save -- fail to marshal state: path=%s err=%v", path, err)
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, stateJson, 0600); err != nil {
+		return errors.Wrapf(err, "forge.save -- fail to write state: path=%s err=%v", tmpPath, err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return errors.Wrapf(err, "forge.save -- fail to replace state: path=%s err=%v", path, err)
+	}
+	return nil
+}
+
+func (f *forge) withLock(fn func() error) error {
+	path := filepath.Join(f.dir, forgeLockFile)
+	deadline := time.Now().Add(forgeLockTimeout)
+	for {
+		lock, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			_ = lock.Close()
+			break
+		}
+		if !os.IsExist(err) {
+			return errors.Wrapf(err, "forge.withLock -- fail to create lock file: path=%s err=%v", path, err)
+		}
+		if time.Now().After(deadline) {
+			return errors.Errorf("forge.withLock -- timeout waiting for lock, remove the lock file if stale: path=%s timeout=%v",
+				path, forgeLockTimeout)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	defer os.Remove(path)
+	return fn()
+}
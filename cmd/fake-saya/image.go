@@ -0,0 +1,243 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	stderrors "errors"
+
+	"github.com/congop/terraform-provider-saya/internal/saya"
+	repos "github.com/congop/terraform-provider-saya/internal/stubrepo"
+	"github.com/pkg/errors"
+	"golang.org/x/exp/slices"
+)
+
+// pullImgTypes are the image types tried, in order, if the pull request does not specify one.
+var pullImgTypes = []string{"qcow2", "ova", "vmdk", "vhd", "vdi", "img", "iso"}
+
+var imgPullFlags = map[string]flagKind{
+	"--hash":                     flagSingle,
+	"--img-type":                 flagSingle,
+	"--platform":                 flagSingle,
+	"--repo-type":                flagSingle,
+	"--result-dst":               flagSingle,
+	"--http-repo-url":            flagSingle,
+	"--http-base-path":           flagSingle,
+	"--http-auth-basic-username": flagSingle,
+	"--http-auth-basic-password": flagSecret,
+	"--http-upload-strategy":     flagSingle,
+	"--s3-bucket":                flagSingle,
+	"--s3-base-key":              flagSingle,
+	"--s3-use-path-style":        flagBool,
+	"--aws-access-key-id":        flagSingle,
+	"--aws-secret-access-key":    flagSecret,
+	"--aws-ep-url":               flagSingle,
+	"--aws-ep-url-s3":            flagSingle,
+	"--aws-region":               flagSingle,
+}
+
+var imgLsFlags = map[string]flagKind{
+	"--filter":     flagMulti,
+	"--format":     flagSingle,
+	"--result-dst": flagSingle,
+}
+
+var imgRmFlags = map[string]flagKind{
+	"--img-type": flagSingle,
+	"--platform": flagSingle,
+}
+
+// imgPull fetches the image from the repository into the forge and writes its meta data as result.
+func imgPull(ctx context.Context, f *forge, args *cliArgs, stdout io.Writer) error {
+	if err := args.maxPositional(1); err != nil {
+		return err
+	}
+	ref, err := saya.ParseReference(args.Positional(0))
+	if err != nil {
+		return err
+	}
+	platform, err := saya.PlatformNormalized(args.Value("--platform"))
+	if err != nil {
+		return err
+	}
+	fetcher, err := newRepoFetcher(args)
+	if err != nil {
+		return err
+	}
+	imgTypes := pullImgTypes
+	if imgType := args.Value("--img-type"); imgType != "" {
+		imgTypes = []string{imgType}
+	}
+
+	var content []byte
+	var meta *saya.ImageTagMetaData
+	for _, imgType := range imgTypes {
+		content, meta, err = fetchImg(ctx, fetcher, platform, ref, imgType)
+		if err == nil || !stderrors.Is(err, errNotInRepo) {
+			break
+		}
+	}
+	if err != nil {
+		return errors.Wrapf(err, "imgPull -- image not pulled: ref=%s platform=%s img-types=%v err=%v",
+			ref.Normalized(), platform.PlatformStr(), imgTypes, err)
+	}
+
+	sha256, err := repos.DigestSha256(bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	switch hash := args.Value("--hash"); {
+	case hash != "" && hash != sha256:
+		return errors.Errorf("imgPull -- image hash mismatch: ref=%s expected=%s actual=%s", ref.Normalized(), hash, sha256)
+	case meta.Sha256 != "" && meta.Sha256 != sha256:
+		return errors.Errorf("imgPull -- image corrupted, hash does not match meta data: ref=%s meta=%s actual=%s",
+			ref.Normalized(), meta.Sha256, sha256)
+	}
+	meta.Sha256 = sha256
+	if meta.CreatedAt.IsZero() {
+		meta.CreatedAt = time.Now().UTC()
+	}
+
+	err = f.update(func(state *forgeState) error {
+		if err := os.WriteFile(f.imagePath(meta), content, 0600); err != nil {
+			return errors.Wrapf(err, "imgPull -- fail to write image: path=%s err=%v", f.imagePath(meta), err)
+		}
+		state.Images = slices.DeleteFunc(state.Images, func(img saya.ImageTagMetaData) bool {
+			return imgIdOf(&img) == imgIdOf(meta)
+		})
+		state.Images = append(state.Images, *meta)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "INF Pull -- image pulled: %s#%s\n", imgIdOf(meta), meta.Sha256)
+	return writeResult(args, meta)
+}
+
+// imgLs writes the images of the forge matching the reference and filters as result.
+func imgLs(ctx context.Context, f *forge, args *cliArgs, stdout io.Writer) error {
+	if err := args.maxPositional(1); err != nil {
+		return err
+	}
+	if err := checkFormatJson(args); err != nil {
+		return err
+	}
+	var ref *saya.Reference
+	if refStr := args.Positional(0); refStr != "" {
+		parsed, err := saya.ParseReference(refStr)
+		if err != nil {
+			return err
+		}
+		ref = parsed
+	}
+	filters, err := args.Filters("img-type", "os", "arch", "os-variant")
+	if err != nil {
+		return err
+	}
+
+	found := []saya.ImageTagMetaData{}
+	err = f.read(func(state *forgeState) error {
+		for _, img := range state.Images {
+			switch {
+			case ref != nil && (ref.Name != img.Name || ref.Version != img.Version):
+			case !filterMatches(filters, "img-type", img.Type):
+			case !filterMatches(filters, "os", img.Platform.Os):
+			case !filterMatches(filters, "arch", img.Platform.ArchWithVariant()):
+			case !filterMatches(filters, "os-variant", img.Platform.OsVariant):
+			default:
+				found = append(found, img)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "INF Ls -- images found: count=%d\n", len(found))
+	return writeResult(args, found)
+}
+
+// imgRm removes the images matching the reference, type and platform from the forge.
+func imgRm(ctx context.Context, f *forge, args *cliArgs, stdout io.Writer) error {
+	if err := args.maxPositional(1); err != nil {
+		return err
+	}
+	ref, err := saya.ParseReference(args.Positional(0))
+	if err != nil {
+		return err
+	}
+	var platform *saya.Platform
+	if platformStr := args.Value("--platform"); platformStr != "" {
+		if platform, err = saya.PlatformNormalized(platformStr); err != nil {
+			return err
+		}
+	}
+	imgType := args.Value("--img-type")
+	matches := func(img saya.ImageTagMetaData) bool {
+		switch {
+		case ref.Name != img.Name || ref.Version != img.Version:
+			return false
+		case imgType != "" && imgType != img.Type:
+			return false
+		case platform != nil && platform.PlatformStr() != img.Platform.PlatformStr():
+			return false
+		}
+		return true
+	}
+
+	return f.update(func(state *forgeState) error {
+		removed := 0
+		for _, img := range state.Images {
+			if !matches(img) {
+				continue
+			}
+			if err := os.Remove(f.imagePath(&img)); err != nil && !os.IsNotExist(err) {
+				return errors.Wrapf(err, "imgRm -- fail to remove image: path=%s err=%v", f.imagePath(&img), err)
+			}
+			removed++
+			fmt.Fprintf(stdout, "INF Rm -- image removed: %s\n", imgIdOf(&img))
+		}
+		if removed == 0 {
+			return errors.Errorf("imgRm -- image not found in forge: ref=%s img-type=%s platform=%v", ref.Normalized(), imgType, platform)
+		}
+		state.Images = slices.DeleteFunc(state.Images, matches)
+		return nil
+	})
+}
+
+// imgIdOf returns the image id, e.g. linux/arm64:ubuntu:v1:ova.
+func imgIdOf(img *saya.ImageTagMetaData) string {
+	return strings.Join([]string{img.Platform.PlatformStr(), img.Name, img.Version, img.Type}, ":")
+}
+
+func filterMatches(filters map[string]string, key, val string) bool {
+	filter, found := filters[key]
+	return !found || filter == val
+}
+
+func checkFormatJson(args *cliArgs) error {
+	if format := args.Value("--format"); format != "" && format != "json" {
+		return errors.Errorf("checkFormatJson -- format not supported: format=%s supported=[json]", format)
+	}
+	return nil
+}
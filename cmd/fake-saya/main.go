@@ -0,0 +1,113 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// fake-saya is a test double of the saya cli, so that acceptance tests can run without virtualization.
+//
+// It implements the image pull|ls|rm and vm run|ls|start|stop|rm sub-commands with the saya flags
+// and result formats. The forge state is stored as json file in the --forge directory, images are pulled
+// from http and s3 repositories (e.g. the stubrepo servers) and vms are only simulated.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// version is reported by saya version; it follows the format of the saya teaser builds.
+const version = "saya_teaser-20231005T135240"
+
+// exitCodeUsage is the exit code of invalid command lines, 1 being the one of failed commands.
+const exitCodeUsage = 2
+
+type subCommand struct {
+	flags map[string]flagKind
+	run   func(ctx context.Context, f *forge, args *cliArgs, stdout io.Writer) error
+}
+
+var subCommands = map[string]subCommand{
+	"image pull": {flags: imgPullFlags, run: imgPull},
+	"image ls":   {flags: imgLsFlags, run: imgLs},
+	"image rm":   {flags: imgRmFlags, run: imgRm},
+	"vm run":     {flags: vmRunFlags, run: vmRun},
+	"vm ls":      {flags: vmLsFlags, run: vmLs},
+	"vm start":   {flags: vmIdFlags, run: vmStart},
+	"vm stop":    {flags: vmIdFlags, run: vmStop},
+	"vm rm":      {flags: vmIdFlags, run: vmRm},
+}
+
+func main() {
+	os.Exit(run(context.Background(), os.Args[1:], os.LookupEnv, os.Stdout, os.Stderr))
+}
+
+// run executes the command line (without the executable) and returns the exit code.
+func run(ctx context.Context, args []string, lookupEnv func(key string) (string, bool), stdout, stderr io.Writer) int {
+	if len(args) >= 1 && args[0] == "version" {
+		fmt.Fprintln(stdout, version)
+		return 0
+	}
+	if len(args) < 2 {
+		fmt.Fprintf(stderr, "ERR usage: fake-saya version | fake-saya <%s> [args] [flags]\n", strings.Join(supportedSubCommands(), "|"))
+		return exitCodeUsage
+	}
+	name := args[0] + " " + args[1]
+	cmd, found := subCommands[name]
+	if !found {
+		fmt.Fprintf(stderr, "ERR unknown command: command=%s supported=%v\n", name, supportedSubCommands())
+		return exitCodeUsage
+	}
+	cliArgs, err := parseArgs(args[2:], cmd.flags, lookupEnv)
+	if err != nil {
+		fmt.Fprintf(stderr, "ERR %s -- invalid command line: err=%v\n", name, err)
+		return exitCodeUsage
+	}
+	f, err := newForge(cliArgs.Value("--forge"))
+	if err == nil {
+		err = cmd.run(ctx, f, cliArgs, stdout)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "ERR %s -- failed: err=%v\n", name, err)
+		return 1
+	}
+	return 0
+}
+
+func supportedSubCommands() []string {
+	names := maps.Keys(subCommands)
+	slices.Sort(names)
+	return names
+}
+
+// writeResult writes the result as json to the --result-dst file, if given.
+func writeResult(args *cliArgs, result any) error {
+	resultDst := args.Value("--result-dst")
+	if resultDst == "" {
+		return nil
+	}
+	resultJson, err := json.Marshal(result)
+	if err != nil {
+		return errors.Wrapf(err, "writeResult -- fail to marshal result: result=%#v err=%v", result, err)
+	}
+	if err := os.WriteFile(resultDst, resultJson, 0600); err != nil {
+		return errors.Wrapf(err, "writeResult -- fail to write result: path=%s err=%v", resultDst, err)
+	}
+	return nil
+}
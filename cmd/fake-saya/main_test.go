@@ -0,0 +1,250 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/congop/terraform-provider-saya/internal/saya"
+	repos "github.com/congop/terraform-provider-saya/internal/stubrepo"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slices"
+)
+
+// inProcessExecutor runs fake-saya in the test process instead of a saya executable.
+func inProcessExecutor() saya.Executor {
+	return saya.ExecutorFunc(func(ctx context.Context, req saya.ExecRequest) (saya.ExecResult, error) {
+		lookupEnv := func(key string) (string, bool) {
+			val, found := req.ExtraEnv[key]
+			return val, found
+		}
+		stdout, stderr := bytes.Buffer{}, bytes.Buffer{}
+		exitCode := run(ctx, req.Argv[1:], lookupEnv, &stdout, &stderr)
+		res := saya.ExecResult{Stdout: stdout.String(), Stderr: stderr.String(), ExitCode: exitCode}
+		if exitCode != 0 {
+			return res, fmt.Errorf("exit status %d", exitCode)
+		}
+		return res, nil
+	})
+}
+
+func givenHttpRepoWithImg(t *testing.T, withMeta bool) (*repos.HttpRepo, *repos.ImgInRepo) {
+	httpRepo := repos.NewDummyHttpRepo()
+	require.NoError(t, httpRepo.Start())
+	t.Cleanup(func() { _ = httpRepo.Close() })
+	img, err := repos.GivenImgInRemoteRepoBySpec(httpRepo.RegisterDummyImg, repos.PullImgSpecData{
+		Tag:       saya.Reference{Original: "ubuntu:v1", Name: "ubuntu", Version: "v1"},
+		OsVariant: "ubuntu",
+		Platform:  saya.Platform{Os: "linux", Arch: "arm64"},
+		RepoType:  "http",
+		ImgType:   "ova",
+	}, withMeta)
+	require.NoError(t, err)
+	return httpRepo, img
+}
+
+func TestFakeSayaImageAndVmLifecycle(t *testing.T) {
+	ctx := context.Background()
+	httpRepo, img := givenHttpRepoWithImg(t, true)
+	sayaCtx := saya.RequestSayaCtx{Exe: "saya", Forge: filepath.Join(t.TempDir(), "forge"), Executor: inProcessExecutor()}
+
+	pulled, err := saya.Pull(ctx, saya.PullRequest{
+		Name: "ubuntu:v1", ImgType: "ova", Platform: "linux/arm64", RepoType: "http",
+		HttpRepo: httpRepo.AsRepos().Http, RequestSayaCtx: sayaCtx,
+	})
+
+	require.NoError(t, err)
+	wantPlatform := saya.PlatformSw{Platform: saya.Platform{Os: "linux", Arch: "arm64"}, OsVariant: "ubuntu"}
+	require.Equal(t, &saya.PullResult{
+		Name: "ubuntu", Version: "v1", Sha256: img.Sha256, Type: "ova", Platform: wantPlatform, SrcType: "http",
+	}, pulled)
+
+	listed, err := saya.Ls(ctx, saya.LsRequest{Name: "ubuntu:v1", Platform: "linux/arm64", RequestSayaCtx: sayaCtx})
+	require.NoError(t, err)
+	require.Equal(t, []saya.LsResult{{
+		Name: "ubuntu", Version: "v1", Sha256: img.Sha256, Type: "ova", Platform: wantPlatform, SrcType: "http",
+	}}, listed)
+
+	vm, err := saya.VmRun(ctx, saya.VmRunRequest{ImgRef: "ubuntu:v1", Name: "web", RequestSayaCtx: sayaCtx})
+	require.NoError(t, err)
+	require.Equal(t, "web", vm.Name)
+	require.Equal(t, "root", vm.Ssh.User)
+
+	vms, err := saya.VmLs(ctx, saya.VmLsRequest{Id: vm.Id, RequestSayaCtx: sayaCtx})
+	require.NoError(t, err)
+	require.Equal(t, []saya.VmLsResult{{
+		Id: vm.Id, Name: "web", Arch: "arm64", Os: "linux", OsVariant: "ubuntu",
+		BaseImg: "ubuntu:v1:ova", ComputeType: "qemu", State: "running",
+	}}, vms)
+
+	_, err = saya.VmStop(ctx, saya.VmStopRequest{Id: vm.Id, RequestSayaCtx: sayaCtx})
+	require.NoError(t, err)
+	_, err = saya.VmRm(ctx, saya.VmRmRequest{Id: vm.Id, RequestSayaCtx: sayaCtx})
+	require.NoError(t, err)
+	_, err = saya.VmRm(ctx, saya.VmRmRequest{Id: vm.Id, RequestSayaCtx: sayaCtx})
+	require.ErrorContains(t, err, "vm not found", "removed vm must not be removable again")
+	vms, err = saya.VmLs(ctx, saya.VmLsRequest{Id: vm.Id, RequestSayaCtx: sayaCtx})
+	require.NoError(t, err)
+	require.Empty(t, vms)
+
+	err = saya.ImageRm(ctx, saya.ImageDeleteRequest{Name: "ubuntu:v1", ImgType: "ova", RequestSayaCtx: sayaCtx})
+	require.NoError(t, err)
+	listed, err = saya.Ls(ctx, saya.LsRequest{Name: "ubuntu:v1", RequestSayaCtx: sayaCtx})
+	require.NoError(t, err)
+	require.Nil(t, listed)
+	err = saya.ImageRm(ctx, saya.ImageDeleteRequest{Name: "ubuntu:v1", ImgType: "ova", RequestSayaCtx: sayaCtx})
+	require.ErrorContains(t, err, "image not found", "removed image must not be removable again")
+}
+
+func TestFakeSayaPull(t *testing.T) {
+	testCases := []struct {
+		name       string
+		withMeta   bool
+		imgType    string
+		hash       string
+		fault      *repos.Fault
+		wantErr    string
+		wantResult func(img *repos.ImgInRepo) *saya.PullResult
+	}{
+		{
+			name:     "image type discovered and meta derived without meta in repo",
+			withMeta: false,
+			wantResult: func(img *repos.ImgInRepo) *saya.PullResult {
+				return &saya.PullResult{
+					Name: "ubuntu", Version: "v1", Sha256: img.Sha256, Type: "ova",
+					Platform: saya.PlatformSw{Platform: saya.Platform{Os: "linux", Arch: "arm64"}}, SrcType: "http",
+				}
+			},
+		},
+		{
+			name:     "hash mismatch",
+			withMeta: true,
+			imgType:  "ova",
+			hash:     "0000",
+			wantErr:  "image hash mismatch",
+		},
+		{
+			name:     "corrupted image",
+			withMeta: true,
+			imgType:  "ova",
+			fault:    &repos.Fault{Kind: repos.FaultCorrupt, PathSuffix: "img.ova", AfterBytes: 3},
+			wantErr:  "image corrupted",
+		},
+		{
+			name:     "wrong meta",
+			withMeta: true,
+			imgType:  "ova",
+			fault:    &repos.Fault{Kind: repos.FaultWrongMeta},
+			wantErr:  "image corrupted",
+		},
+		{
+			name:     "repository unavailable",
+			withMeta: true,
+			imgType:  "ova",
+			fault:    &repos.Fault{Kind: repos.FaultStatus},
+			wantErr:  "503",
+		},
+		{
+			name:     "credentials rejected",
+			withMeta: true,
+			imgType:  "ova",
+			fault:    &repos.Fault{Kind: repos.FaultAuth},
+			wantErr:  "unexpected status",
+		},
+		{
+			name:     "image type not in repo",
+			withMeta: true,
+			imgType:  "qcow2",
+			wantErr:  "not found in repository",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			httpRepo, img := givenHttpRepoWithImg(t, tc.withMeta)
+			if tc.fault != nil {
+				require.NoError(t, httpRepo.Faults().Add(*tc.fault))
+			}
+			sayaCtx := saya.RequestSayaCtx{Exe: "saya", Forge: filepath.Join(t.TempDir(), "forge"), Executor: inProcessExecutor()}
+
+			pulled, err := saya.Pull(context.Background(), saya.PullRequest{
+				Name: "ubuntu:v1", ImgType: tc.imgType, Platform: "linux/arm64", Hash: tc.hash,
+				HttpRepo: httpRepo.AsRepos().Http, RequestSayaCtx: sayaCtx,
+			})
+
+			if tc.wantErr != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.wantResult(img), pulled)
+		})
+	}
+}
+
+func TestFakeSayaPullFromS3Repo(t *testing.T) {
+	s3Repo := repos.NewRepoS3()
+	require.NoError(t, s3Repo.Start())
+	t.Cleanup(func() { _ = s3Repo.Close() })
+	img, err := repos.GivenImgInRemoteRepoBySpec(s3Repo.RegisterDummyImg, repos.PullImgSpecData{
+		Tag:       saya.Reference{Original: "alpine:v1", Name: "alpine", Version: "v1"},
+		OsVariant: "alpine",
+		Platform:  saya.Platform{Os: "linux", Arch: "amd64"},
+		RepoType:  "s3",
+		ImgType:   "qcow2",
+	}, true)
+	require.NoError(t, err)
+	repoSpec := s3Repo.AsRepos().S3
+	repoSpec.UsePathStyle = true
+	sayaCtx := saya.RequestSayaCtx{Exe: "saya", Forge: filepath.Join(t.TempDir(), "forge"), Executor: inProcessExecutor()}
+
+	pulled, err := saya.Pull(context.Background(), saya.PullRequest{
+		Name: "alpine:v1", Platform: "linux/amd64", RepoType: "s3", S3Repo: repoSpec, RequestSayaCtx: sayaCtx,
+	})
+
+	require.NoError(t, err)
+	require.Equal(t, &saya.PullResult{
+		Name: "alpine", Version: "v1", Sha256: img.Sha256, Type: "qcow2",
+		Platform: saya.PlatformSw{Platform: saya.Platform{Os: "linux", Arch: "amd64"}, OsVariant: "alpine"}, SrcType: "s3",
+	}, pulled)
+}
+
+func TestFakeSayaRejectsInvalidCommandLines(t *testing.T) {
+	testCases := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{name: "unknown command", args: []string{"vm", "pause", "vm-1"}, wantErr: "unknown command"},
+		{name: "unknown flag", args: []string{"vm", "run", "ubuntu:v1", "--cpus", "2"}, wantErr: "unknown flag"},
+		{name: "single flag repeated", args: []string{"vm", "run", "ubuntu:v1", "--name", "a", "--name", "b"}, wantErr: "more than once"},
+		{name: "flag without value", args: []string{"image", "ls", "--format"}, wantErr: "needs a value"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			args := append(append(slices.Clone(tc.args[:2]), "--forge", filepath.Join(t.TempDir(), "forge")), tc.args[2:]...)
+			stdout, stderr := bytes.Buffer{}, bytes.Buffer{}
+
+			exitCode := run(context.Background(), args, func(string) (string, bool) { return "", false }, &stdout, &stderr)
+
+			require.Equal(t, exitCodeUsage, exitCode)
+			require.Contains(t, stderr.String(), tc.wantErr)
+		})
+	}
+}
@@ -0,0 +1,223 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+
+	stderrors "errors"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/congop/terraform-provider-saya/internal/saya"
+	repos "github.com/congop/terraform-provider-saya/internal/stubrepo"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// errNotInRepo is returned if the image or its meta data is not in the repository.
+var errNotInRepo = stderrors.New("not found in repository")
+
+// repoFetcher fetches files from an image repository, keys being the / separated path relative to the repository base.
+type repoFetcher interface {
+	fetch(ctx context.Context, relKey string) ([]byte, error)
+	repoType() string
+}
+
+// imgRelKey returns the key of the image relative to the repository base, e.g. ubuntu/v1/linux/arm64/img.ova.
+func imgRelKey(platform *saya.Platform, ref *saya.Reference, imgType string) (string, error) {
+	segs, err := repos.ImageRepoRelUrlSegments(nil, platform, ref.Name, ref.Version, imgType)
+	if err != nil {
+		return "", err
+	}
+	return path.Join(segs...), nil
+}
+
+// fetchImg fetches the image content and its meta data.
+// The meta data are derived from the request if the repository does not provide them.
+func fetchImg(
+	ctx context.Context, fetcher repoFetcher, platform *saya.Platform, ref *saya.Reference, imgType string,
+) ([]byte, *saya.ImageTagMetaData, error) {
+	relKey, err := imgRelKey(platform, ref, imgType)
+	if err != nil {
+		return nil, nil, err
+	}
+	content, err := fetcher.fetch(ctx, relKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	meta := &saya.ImageTagMetaData{
+		Name:     ref.Name,
+		Version:  ref.Version,
+		Type:     imgType,
+		Platform: saya.PlatformSw{Platform: *platform},
+	}
+	switch metaYaml, err := fetcher.fetch(ctx, relKey+".meta"); {
+	case stderrors.Is(err, errNotInRepo):
+		break
+	case err != nil:
+		return nil, nil, err
+	default:
+		if err := yaml.Unmarshal(metaYaml, meta); err != nil {
+			return nil, nil, errors.Wrapf(err, "fetchImg -- fail to unmarshal image meta data: key=%s.meta err=%v", relKey, err)
+		}
+	}
+	meta.SrcType = fetcher.repoType()
+	return content, meta, nil
+}
+
+// httpRepoFetcher fetches files from a http repository, set with the --http-* flags.
+type httpRepoFetcher struct {
+	baseUrl string
+	auth    saya.AuthHttpBasic
+	client  *http.Client
+}
+
+func newHttpRepoFetcher(args *cliArgs) (*httpRepoFetcher, error) {
+	repoUrl := strings.TrimRight(args.Value("--http-repo-url"), "/")
+	if repoUrl == "" {
+		return nil, errors.Errorf("newHttpRepoFetcher -- http repository url not set, use --http-repo-url")
+	}
+	if basePath := strings.Trim(args.Value("--http-base-path"), "/"); basePath != "" {
+		repoUrl = repoUrl + "/" + basePath
+	}
+	fetcher := &httpRepoFetcher{baseUrl: repoUrl, client: http.DefaultClient}
+	fetcher.auth.Username = args.Value("--http-auth-basic-username")
+	fetcher.auth.Pwd.SetValue(args.Value("--http-auth-basic-password"))
+	return fetcher, nil
+}
+
+func (fetcher *httpRepoFetcher) repoType() string {
+	return saya.RepoTypeHttp
+}
+
+func (fetcher *httpRepoFetcher) fetch(ctx context.Context, relKey string) ([]byte, error) {
+	url := fetcher.baseUrl + "/" + relKey
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "httpRepoFetcher.fetch -- fail to create request: url=%s err=%v", url, err)
+	}
+	if fetcher.auth.Username != "" {
+		req.SetBasicAuth(fetcher.auth.Username, fetcher.auth.Pwd.Value())
+	}
+	resp, err := fetcher.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "httpRepoFetcher.fetch -- fail to get: url=%s err=%v", url, err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, errors.Wrapf(errNotInRepo, "httpRepoFetcher.fetch -- not found: url=%s", url)
+	case resp.StatusCode != http.StatusOK:
+		return nil, errors.Errorf("httpRepoFetcher.fetch -- unexpected status: url=%s status=%s", url, resp.Status)
+	}
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "httpRepoFetcher.fetch -- fail to read body: url=%s err=%v", url, err)
+	}
+	return content, nil
+}
+
+// s3RepoFetcher fetches files from a s3 repository, set with the --s3-* and --aws-* flags.
+// Credentials not given as flags are resolved by the aws default chain, e.g. from AWS_ACCESS_KEY_ID.
+type s3RepoFetcher struct {
+	bucket       string
+	baseKey      string
+	usePathStyle bool
+	client       *s3.Client
+}
+
+func newS3RepoFetcher(args *cliArgs) (*s3RepoFetcher, error) {
+	bucket := args.Value("--s3-bucket")
+	if bucket == "" {
+		return nil, errors.Errorf("newS3RepoFetcher -- s3 bucket not set, use --s3-bucket")
+	}
+	var endpoint *repos.AwsEndpointSpec
+	if epUrl, epUrlS3 := args.Value("--aws-ep-url"), args.Value("--aws-ep-url-s3"); epUrl != "" || epUrlS3 != "" {
+		endpoint = &repos.AwsEndpointSpec{Url: epUrl, S3Url: epUrlS3}
+	}
+	var creds *awssdk.Credentials
+	if accessKeyId := args.Value("--aws-access-key-id"); accessKeyId != "" {
+		creds = &awssdk.Credentials{
+			AccessKeyID:     accessKeyId,
+			SecretAccessKey: args.Value("--aws-secret-access-key"),
+			SessionToken:    args.Env("AWS_SESSION_TOKEN"),
+		}
+	}
+	client, err := repos.NewS3Client(endpoint, creds, args.Value("--aws-region"))
+	if err != nil {
+		return nil, err
+	}
+	return &s3RepoFetcher{
+		bucket:       bucket,
+		baseKey:      strings.Trim(args.Value("--s3-base-key"), "/"),
+		usePathStyle: args.Bool("--s3-use-path-style"),
+		client:       client,
+	}, nil
+}
+
+func (fetcher *s3RepoFetcher) repoType() string {
+	return saya.RepoTypeS3
+}
+
+func (fetcher *s3RepoFetcher) fetch(ctx context.Context, relKey string) ([]byte, error) {
+	key := path.Join(fetcher.baseKey, relKey)
+	out, err := fetcher.client.GetObject(ctx, &s3.GetObjectInput{Bucket: &fetcher.bucket, Key: &key}, func(o *s3.Options) {
+		o.UsePathStyle = fetcher.usePathStyle
+	})
+	if err != nil {
+		var noSuchKey *s3types.NoSuchKey
+		var respErr *awshttp.ResponseError
+		if stderrors.As(err, &noSuchKey) || (stderrors.As(err, &respErr) && respErr.HTTPStatusCode() == http.StatusNotFound) {
+			return nil, errors.Wrapf(errNotInRepo, "s3RepoFetcher.fetch -- not found: bucket=%s key=%s", fetcher.bucket, key)
+		}
+		return nil, errors.Wrapf(err, "s3RepoFetcher.fetch -- fail to get object: bucket=%s key=%s err=%v", fetcher.bucket, key, err)
+	}
+	defer out.Body.Close()
+	content, err := io.ReadAll(out.Body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "s3RepoFetcher.fetch -- fail to read object: bucket=%s key=%s err=%v", fetcher.bucket, key, err)
+	}
+	return content, nil
+}
+
+// newRepoFetcher returns the fetcher of the repository type given by --repo-type,
+// or the one of the repository set with flags if the type is not given.
+func newRepoFetcher(args *cliArgs) (repoFetcher, error) {
+	repoType := args.Value("--repo-type")
+	if repoType == "" {
+		switch {
+		case args.Value("--http-repo-url") != "":
+			repoType = saya.RepoTypeHttp
+		case args.Value("--s3-bucket") != "":
+			repoType = saya.RepoTypeS3
+		}
+	}
+	switch {
+	case saya.IsRepoTypeHttp(repoType):
+		return newHttpRepoFetcher(args)
+	case saya.IsRepoTypeS3(repoType):
+		return newS3RepoFetcher(args)
+	default:
+		return nil, errors.Errorf("newRepoFetcher -- repository type not supported: repo-type=%q supported=%v",
+			repoType, []string{saya.RepoTypeHttp, saya.RepoTypeS3})
+	}
+}
@@ -0,0 +1,223 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/congop/terraform-provider-saya/internal/random"
+	"github.com/congop/terraform-provider-saya/internal/saya"
+	"github.com/pkg/errors"
+	"golang.org/x/exp/slices"
+)
+
+const (
+	vmStatusRunning = "running"
+	vmStatusStopped = "stopped"
+
+	vmSshIp       = "127.0.0.1"
+	vmSshBasePort = 2200
+	vmSshUser     = "root"
+)
+
+var vmRunFlags = map[string]flagKind{
+	"--name":         flagSingle,
+	"--compute-type": flagSingle,
+	"--platform":     flagSingle,
+	"--img-type":     flagSingle,
+	"--result-dst":   flagSingle,
+}
+
+var vmLsFlags = map[string]flagKind{
+	"--filter":     flagMulti,
+	"--format":     flagSingle,
+	"--result-dst": flagSingle,
+}
+
+var vmIdFlags = map[string]flagKind{}
+
+// vmRun simulates running a vm from an image of the forge; no vm is actually started.
+func vmRun(ctx context.Context, f *forge, args *cliArgs, stdout io.Writer) error {
+	if err := args.maxPositional(1); err != nil {
+		return err
+	}
+	ref, err := saya.ParseReference(args.Positional(0))
+	if err != nil {
+		return err
+	}
+	var platform *saya.Platform
+	if platformStr := args.Value("--platform"); platformStr != "" {
+		if platform, err = saya.PlatformNormalized(platformStr); err != nil {
+			return err
+		}
+	}
+	imgType := args.Value("--img-type")
+	computeType := args.Value("--compute-type")
+	if computeType == "" {
+		computeType = saya.ComputeTypeQemu
+	}
+	idSuffix, err := random.String(16)
+	if err != nil {
+		return err
+	}
+
+	res := saya.VmRunResultCmd{}
+	err = f.update(func(state *forgeState) error {
+		found := []saya.ImageTagMetaData{}
+		for _, img := range state.Images {
+			switch {
+			case ref.Name != img.Name || ref.Version != img.Version:
+			case imgType != "" && imgType != img.Type:
+			case platform != nil && platform.PlatformStr() != img.Platform.PlatformStr():
+			default:
+				found = append(found, img)
+			}
+		}
+		switch {
+		case len(found) == 0:
+			return errors.Errorf("vmRun -- image not found in forge: ref=%s img-type=%s platform=%v", ref.Normalized(), imgType, platform)
+		case len(found) > 1:
+			return errors.Errorf("vmRun -- image type or platform ambiguous, use --img-type or --platform: ref=%s found=%v",
+				ref.Normalized(), found)
+		}
+		img := found[0]
+
+		state.VmCount++
+		name := args.Value("--name")
+		if name == "" {
+			name = fmt.Sprintf("saya-vm-%d", state.VmCount)
+		}
+		for _, vm := range state.Vms {
+			if vm.Name == name {
+				return errors.Errorf("vmRun -- vm name already in use: name=%s id=%s", name, vm.Id)
+			}
+		}
+		vm := saya.VmLsResultCmd{
+			Id:          fmt.Sprintf("vm-%d-%s", state.VmCount, idSuffix),
+			Name:        name,
+			Arch:        img.Platform.ArchWithVariant(),
+			Os:          img.Platform.Os,
+			OsVariant:   img.Platform.OsVariant,
+			BaseImg:     strings.Join([]string{img.Name, img.Version, img.Type}, ":"),
+			ComputeType: computeType,
+			Status:      vmStatusRunning,
+		}
+		state.Vms = append(state.Vms, vm)
+
+		res = saya.VmRunResultCmd{
+			Id:        vm.Id,
+			Name:      vm.Name,
+			OsVariant: vm.OsVariant,
+			Ssh:       &saya.VmRunResultCmdSsh{Ip: vmSshIp, Port: uint16(vmSshBasePort + state.VmCount), User: vmSshUser},
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "INF Run -- vm running: id=%s name=%s\n", res.Id, res.Name)
+	return writeResult(args, res)
+}
+
+// vmLs writes the vms matching the id and filters as result.
+func vmLs(ctx context.Context, f *forge, args *cliArgs, stdout io.Writer) error {
+	if err := args.maxPositional(1); err != nil {
+		return err
+	}
+	if err := checkFormatJson(args); err != nil {
+		return err
+	}
+	id := args.Positional(0)
+	filters, err := args.Filters("name", "compute-type", "os-variant", "status")
+	if err != nil {
+		return err
+	}
+
+	found := []saya.VmLsResultCmd{}
+	err = f.read(func(state *forgeState) error {
+		for _, vm := range state.Vms {
+			switch {
+			case id != "" && id != vm.Id:
+			case !filterMatches(filters, "name", vm.Name):
+			case !filterMatches(filters, "compute-type", vm.ComputeType):
+			case !filterMatches(filters, "os-variant", vm.OsVariant):
+			case !filterMatches(filters, "status", vm.Status):
+			default:
+				found = append(found, vm)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "INF Ls -- vms found: count=%d\n", len(found))
+	return writeResult(args, found)
+}
+
+func vmStart(ctx context.Context, f *forge, args *cliArgs, stdout io.Writer) error {
+	return vmSetStatus(f, args, stdout, vmStatusRunning)
+}
+
+func vmStop(ctx context.Context, f *forge, args *cliArgs, stdout io.Writer) error {
+	return vmSetStatus(f, args, stdout, vmStatusStopped)
+}
+
+func vmSetStatus(f *forge, args *cliArgs, stdout io.Writer, status string) error {
+	id, err := vmIdArg(args)
+	if err != nil {
+		return err
+	}
+	return f.update(func(state *forgeState) error {
+		i := slices.IndexFunc(state.Vms, func(vm saya.VmLsResultCmd) bool { return vm.Id == id })
+		if i < 0 {
+			return errors.Errorf("vmSetStatus -- vm not found: id=%s", id)
+		}
+		state.Vms[i].Status = status
+		fmt.Fprintf(stdout, "INF vm %s: id=%s\n", status, id)
+		return nil
+	})
+}
+
+// vmRm removes the vm.
+func vmRm(ctx context.Context, f *forge, args *cliArgs, stdout io.Writer) error {
+	id, err := vmIdArg(args)
+	if err != nil {
+		return err
+	}
+	return f.update(func(state *forgeState) error {
+		i := slices.IndexFunc(state.Vms, func(vm saya.VmLsResultCmd) bool { return vm.Id == id })
+		if i < 0 {
+			return errors.Errorf("vmRm -- vm not found: id=%s", id)
+		}
+		state.Vms = slices.Delete(state.Vms, i, i+1)
+		fmt.Fprintf(stdout, "INF Rm -- vm removed: id=%s\n", id)
+		return nil
+	})
+}
+
+func vmIdArg(args *cliArgs) (string, error) {
+	if err := args.maxPositional(1); err != nil {
+		return "", err
+	}
+	id := args.Positional(0)
+	if id == "" {
+		return "", errors.Errorf("vmIdArg -- vm id must not be blank")
+	}
+	return id, nil
+}
@@ -0,0 +1,234 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// saya-stubrepo serves a directory of images as saya http or s3 repository, for local development.
+//
+// The directory is laid out as a repository, i.e. <name>/<version>/<os>/<arch>[/<arch-variant>]/img.<type>.
+// Meta data yaml files are generated for the images lacking one and a provider block using the repository
+// is printed, so that a local terraform configuration can pull from it.
+//
+//	saya-stubrepo -addr 127.0.0.1:10099 -username user -password pwd ./images
+//	saya-stubrepo -type s3 -addr 127.0.0.1:9000 ./images
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/template"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/congop/terraform-provider-saya/internal/opaque"
+	"github.com/congop/terraform-provider-saya/internal/saya"
+	repos "github.com/congop/terraform-provider-saya/internal/stubrepo"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+const (
+	repoTypeHttp = "http"
+	repoTypeS3   = "s3"
+)
+
+type options struct {
+	repoType        string
+	addr            string
+	dir             string
+	genMeta         bool
+	username        string
+	password        string
+	bucket          string
+	baseKey         string
+	region          string
+	accessKeyId     string
+	secretAccessKey string
+}
+
+func parseOptions(args []string, stderr io.Writer) (*options, error) {
+	opts := &options{}
+	flags := flag.NewFlagSet("saya-stubrepo", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: saya-stubrepo [flags] <dir>\n")
+		flags.PrintDefaults()
+	}
+	flags.StringVar(&opts.repoType, "type", repoTypeHttp, "repository type: http or s3")
+	flags.StringVar(&opts.addr, "addr", "127.0.0.1:10099", "address to listen at; port 0 for a random port")
+	flags.BoolVar(&opts.genMeta, "gen-meta", true, "generate the meta data yaml of the images lacking one")
+	flags.StringVar(&opts.username, "username", "", "http basic auth username; no authentication if blank")
+	flags.StringVar(&opts.password, "password", os.Getenv("SAYA_STUBREPO_PASSWORD"), "http basic auth password; defaults to SAYA_STUBREPO_PASSWORD")
+	flags.StringVar(&opts.bucket, "bucket", "repobucket", "s3 bucket")
+	flags.StringVar(&opts.baseKey, "base-key", "rbase", "s3 base key of the images")
+	flags.StringVar(&opts.region, "region", "us-east-1", "s3 region")
+	flags.StringVar(&opts.accessKeyId, "access-key-id", "test", "s3 access key id requests must be signed with")
+	flags.StringVar(&opts.secretAccessKey, "secret-access-key", "test", "s3 secret access key requests must be signed with")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case flags.NArg() != 1:
+		flags.Usage()
+		return nil, errors.Errorf("parseOptions -- exactly one directory expected: args=%v", flags.Args())
+	case opts.repoType != repoTypeHttp && opts.repoType != repoTypeS3:
+		return nil, errors.Errorf("parseOptions -- repository type not supported: type=%s supported=[http s3]", opts.repoType)
+	case opts.repoType == repoTypeHttp && (opts.username == "") != (opts.password == ""):
+		return nil, errors.Errorf("parseOptions -- username and password must be both given or both blank")
+	}
+	opts.dir = flags.Arg(0)
+	if fi, err := os.Stat(opts.dir); err != nil || !fi.IsDir() {
+		return nil, errors.Errorf("parseOptions -- not a directory: dir=%s err=%v", opts.dir, err)
+	}
+	return opts, nil
+}
+
+// servedRepo is a started repository.
+type servedRepo struct {
+	repos *saya.Repos
+	close func() error
+}
+
+func serve(opts *options, stderr io.Writer) (*servedRepo, error) {
+	if opts.genMeta {
+		generated, err := repos.GenerateMissingImgMeta(opts.dir, opts.repoType)
+		if err != nil {
+			return nil, err
+		}
+		for _, metaPath := range generated {
+			fmt.Fprintf(stderr, "generated meta data: %s\n", metaPath)
+		}
+	}
+	if opts.repoType == repoTypeS3 {
+		return serveS3(opts)
+	}
+	return serveHttp(opts)
+}
+
+func serveHttp(opts *options) (*servedRepo, error) {
+	repo := repos.NewDirHttpRepo(opts.dir).WithAddr(opts.addr)
+	var basicAuth *saya.AuthHttpBasic
+	if opts.username != "" {
+		basicAuth = &saya.AuthHttpBasic{Username: opts.username, Pwd: *opaque.NewString(opts.password)}
+		repo.WithBasicAuth(basicAuth)
+	}
+	if err := repo.Start(); err != nil {
+		return nil, err
+	}
+	served := &servedRepo{repos: repo.AsRepos(), close: repo.Close}
+	if basicAuth != nil {
+		served.repos.Http.AuthHttpBasic = *basicAuth
+	}
+	return served, nil
+}
+
+// serveS3 serves the directory files as objects of the bucket; they are streamed from the directory.
+func serveS3(opts *options) (*servedRepo, error) {
+	server := repos.NewS3Server(awssdk.Credentials{AccessKeyID: opts.accessKeyId, SecretAccessKey: opts.secretAccessKey}).WithAddr(opts.addr)
+	server.ServeDir(opts.bucket, opts.baseKey, opts.dir)
+	if err := server.Start(); err != nil {
+		return nil, err
+	}
+	epUrl := "http://" + server.Addr()
+	return &servedRepo{
+		repos: &saya.Repos{S3: &saya.S3Repo{
+			Bucket:       opts.bucket,
+			BaseKey:      opts.baseKey,
+			EpUrl:        epUrl,
+			EpUrlS3:      epUrl + "/",
+			Region:       opts.region,
+			UsePathStyle: true,
+			AuthAwsCreds: &saya.AwsCredentials{
+				AccessKeyID:     opts.accessKeyId,
+				SecretAccessKey: *opaque.NewString(opts.secretAccessKey),
+			},
+		}},
+		close: server.Close,
+	}, nil
+}
+
+var providerBlockTmpl = template.Must(template.New("provider").Parse(`provider "saya" {
+{{- with .Http }}
+  http_repo = {
+    url       = "{{ .RepoUrl }}"
+    base_path = "{{ .BasePath }}"
+    {{- if .AuthHttpBasic.Username }}
+    basic_auth = {
+      username = "{{ .AuthHttpBasic.Username }}"
+      password = "{{ .AuthHttpBasic.Pwd.Value }}"
+    }
+    {{- end }}
+  }
+{{- end }}
+{{- with .S3 }}
+  s3_repo = {
+    bucket         = "{{ .Bucket }}"
+    base_key       = "{{ .BaseKey }}"
+    region         = "{{ .Region }}"
+    ep_url_s3      = "{{ .EpUrlS3 }}"
+    use_path_style = true
+    credentials = {
+      access_key_id     = "{{ .AuthAwsCreds.AccessKeyID }}"
+      secret_access_key = "{{ .AuthAwsCreds.SecretAccessKey.Value }}"
+    }
+  }
+{{- end }}
+}
+`))
+
+// providerBlock returns a provider block using the repository, ready to be pasted into a terraform configuration.
+func providerBlock(served *servedRepo) (string, error) {
+	buf := bytes.Buffer{}
+	if err := providerBlockTmpl.Execute(&buf, served.repos); err != nil {
+		return "", errors.Wrapf(err, "providerBlock -- fail to render: err=%v", err)
+	}
+	return buf.String(), nil
+}
+
+func main() {
+	gin.SetMode(gin.ReleaseMode)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	os.Exit(run(ctx, os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run serves the repository until the context is done and returns the exit code.
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	opts, err := parseOptions(args, stderr)
+	if err != nil {
+		if err != flag.ErrHelp {
+			fmt.Fprintf(stderr, "ERR %v\n", err)
+		}
+		return 2
+	}
+	served, err := serve(opts, stderr)
+	if err != nil {
+		fmt.Fprintf(stderr, "ERR %v\n", err)
+		return 1
+	}
+	defer func() { _ = served.close() }()
+
+	block, err := providerBlock(served)
+	if err != nil {
+		fmt.Fprintf(stderr, "ERR %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "serving %s as %s repository, stop with Ctrl-C\n\n%s", opts.dir, opts.repoType, block)
+	<-ctx.Done()
+	return 0
+}
@@ -0,0 +1,160 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/congop/terraform-provider-saya/internal/saya"
+	repos "github.com/congop/terraform-provider-saya/internal/stubrepo"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+const imgRelPath = "alpine/v1/linux/amd64/img.qcow2"
+
+func givenImgDir(t *testing.T) (string, string) {
+	dir := t.TempDir()
+	imgPath := filepath.Join(dir, filepath.FromSlash(imgRelPath))
+	require.NoError(t, os.MkdirAll(filepath.Dir(imgPath), 0700))
+	require.NoError(t, os.WriteFile(imgPath, []byte("alpine image"), 0600))
+	sha256, err := repos.DigestSha256(bytes.NewReader([]byte("alpine image")))
+	require.NoError(t, err)
+	return dir, sha256
+}
+
+func givenServed(t *testing.T, args ...string) *servedRepo {
+	opts, err := parseOptions(args, io.Discard)
+	require.NoError(t, err)
+	served, err := serve(opts, io.Discard)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = served.close() })
+	return served
+}
+
+func TestServeHttpDirWithBasicAuth(t *testing.T) {
+	dir, sha256 := givenImgDir(t)
+
+	served := givenServed(t, "-addr", "127.0.0.1:0", "-username", "user", "-password", "pwd", dir)
+
+	block, err := providerBlock(served)
+	require.NoError(t, err)
+	require.Contains(t, block, `url       = "`+served.repos.Http.RepoUrl+`"`)
+	require.Contains(t, block, `base_path = "repo"`)
+	require.Contains(t, block, `username = "user"`)
+
+	req, err := http.NewRequest(http.MethodGet, served.repos.Http.RepoUrl+"/repo/"+imgRelPath+".meta", nil)
+	require.NoError(t, err)
+	req.SetBasicAuth("user", "pwd")
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	meta := saya.ImageTagMetaData{}
+	require.NoError(t, yaml.NewDecoder(res.Body).Decode(&meta))
+	require.Equal(t, sha256, meta.Sha256)
+	require.Equal(t, "alpine", meta.Name)
+	require.Equal(t, "linux/amd64", meta.Platform.PlatformStr())
+	require.FileExists(t, filepath.Join(dir, filepath.FromSlash(imgRelPath+".meta")), "meta must be generated in the directory")
+}
+
+func TestServeS3Dir(t *testing.T) {
+	dir, sha256 := givenImgDir(t)
+
+	served := givenServed(t, "-type", "s3", "-addr", "127.0.0.1:0", "-bucket", "images", dir)
+
+	block, err := providerBlock(served)
+	require.NoError(t, err)
+	require.Contains(t, block, `bucket         = "images"`)
+	require.Contains(t, block, `ep_url_s3      = "`+served.repos.S3.EpUrlS3+`"`)
+
+	s3Repo := served.repos.S3
+	cfg, err := repos.LoadConfig(context.Background(), &repos.AwsEndpointSpec{Url: s3Repo.EpUrl, S3Url: s3Repo.EpUrlS3},
+		&awssdk.Credentials{AccessKeyID: "test", SecretAccessKey: "test"}, s3Repo.Region)
+	require.NoError(t, err)
+	client := s3.NewFromConfig(*cfg, func(o *s3.Options) { o.UsePathStyle = true })
+	got, err := client.GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: awssdk.String("images"), Key: awssdk.String("rbase/" + imgRelPath + ".meta"),
+	})
+	require.NoError(t, err)
+	defer got.Body.Close()
+	meta := saya.ImageTagMetaData{}
+	require.NoError(t, yaml.NewDecoder(got.Body).Decode(&meta))
+	require.Equal(t, sha256, meta.Sha256)
+	require.Equal(t, "s3", meta.SrcType)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "added-after-start.txt"), []byte("streamed"), 0600))
+	listed, err := client.ListObjectsV2(context.Background(), &s3.ListObjectsV2Input{
+		Bucket: awssdk.String("images"), Prefix: awssdk.String("rbase/added"),
+	})
+	require.NoError(t, err)
+	require.Len(t, listed.Contents, 1, "files are served from the directory, not from a snapshot")
+	require.Equal(t, "rbase/added-after-start.txt", *listed.Contents[0].Key)
+	added, err := client.GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: awssdk.String("images"), Key: awssdk.String("rbase/added-after-start.txt"),
+	})
+	require.NoError(t, err)
+	defer added.Body.Close()
+	addedContent, err := io.ReadAll(added.Body)
+	require.NoError(t, err)
+	require.Equal(t, "streamed", string(addedContent))
+}
+
+func TestServeS3EndpointFromListenAddr(t *testing.T) {
+	dir, _ := givenImgDir(t)
+
+	served := givenServed(t, "-type", "s3", "-addr", "localhost:0", dir)
+
+	epUrl, err := url.Parse(served.repos.S3.EpUrl)
+	require.NoError(t, err)
+	require.NotEqual(t, "0", epUrl.Port())
+	conn, err := net.Dial("tcp", epUrl.Host)
+	require.NoError(t, err, "endpoint must be the address actually listened at")
+	require.NoError(t, conn.Close())
+}
+
+func TestParseOptionsRejectsInvalidArgs(t *testing.T) {
+	dir := t.TempDir()
+	testCases := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{name: "no directory", args: []string{}, wantErr: "exactly one directory"},
+		{name: "not a directory", args: []string{filepath.Join(dir, "missing")}, wantErr: "not a directory"},
+		{name: "unsupported type", args: []string{"-type", "ftp", dir}, wantErr: "not supported"},
+		{name: "username without password", args: []string{"-username", "user", dir}, wantErr: "both given"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("SAYA_STUBREPO_PASSWORD", "")
+
+			_, err := parseOptions(tc.args, io.Discard)
+
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.wantErr)
+		})
+	}
+}
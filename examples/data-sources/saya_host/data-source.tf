@@ -0,0 +1,5 @@
+data "saya_host" "this" {}
+
+output "saya_host_problems" {
+  value = data.saya_host.this.problems
+}
@@ -0,0 +1,11 @@
+resource "saya_host_setup" "qemu" {
+  compute_types = ["qemu"]
+  target_user   = "runner"
+}
+
+resource "saya_vm" "test" {
+  image        = "linux/amd64:webserver:v1:qcow2"
+  compute_type = "qemu"
+
+  depends_on = [saya_host_setup.qemu]
+}
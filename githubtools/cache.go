@@ -0,0 +1,110 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubtools
+
+import (
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultDownloadCacheDir returns the default directory where downloaded saya releases are cached.
+func DefaultDownloadCacheDir() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", errors.Wrapf(err, "DefaultDownloadCacheDir -- fail to get user cache dir: err=%v", err)
+	}
+	return filepath.Join(cacheDir, "terraform-provider-saya", "downloads"), nil
+}
+
+// releaseTag returns the tag of the release, the parent path segment of the release url,
+// e.g. saya_teaser-20231005T135240 for github releases; blank if the url has no parent path segment.
+func releaseTag(releaseUrl string) string {
+	versionDir := path.Base(path.Dir(mustUrlPath(releaseUrl)))
+	if versionDir == "." || versionDir == "/" {
+		return ""
+	}
+	return versionDir
+}
+
+// releaseCachePath returns the path of the release zip in the download cache.
+// The cache is organized by release tag,
+// e.g. <cache-dir>/saya_teaser-20231005T135240/saya_teaser-20231005T135240_linux_amd64.zip for github releases.
+func releaseCachePath(cacheDir string, releaseUrl string) string {
+	return filepath.Join(cacheDir, releaseTag(releaseUrl), path.Base(mustUrlPath(releaseUrl)))
+}
+
+// fetchRelease returns the path of the verified release zip in the download cache.
+// The release is only downloaded if the cached zip does not match the pinned or else the published checksum.
+// Without verification it is always downloaded, into tmpDir instead of the cache: only verified releases are cached.
+func fetchRelease(releaseUrl string, cacheDir string, tmpDir string, v ReleaseVerification) (string, error) {
+	zipPath := releaseCachePath(cacheDir, releaseUrl)
+
+	wantSha256 := strings.ToLower(strings.TrimSpace(v.Sha256))
+	switch {
+	case wantSha256 != "":
+	case !v.Skip:
+		publishedSha, err := publishedSha256(releaseUrl, v)
+		if err != nil {
+			return "", err
+		}
+		wantSha256 = publishedSha
+	default:
+		log.Printf("fetchRelease -- verification skipped, release not cached: url=%s", releaseUrl)
+		return downloadRelease(releaseUrl, tmpDir)
+	}
+	if cachedSha256, err := fileSha256(zipPath); err == nil && cachedSha256 == wantSha256 {
+		log.Printf("fetchRelease -- using cached saya release: path=%s sha256=%s", zipPath, cachedSha256)
+		return zipPath, nil
+	}
+
+	zipDir := filepath.Dir(zipPath)
+	if err := os.MkdirAll(zipDir, 0755); err != nil {
+		return "", errors.Wrapf(err, "fetchRelease -- fail to create cache dir: path=%s err=%v", zipDir, err)
+	}
+	dldDir, err := os.MkdirTemp(zipDir, ".dld-*")
+	if err != nil {
+		return "", errors.Wrapf(err, "fetchRelease -- fail to create download dir: dir=%s err=%v", zipDir, err)
+	}
+	defer func() {
+		if err := os.RemoveAll(dldDir); err != nil {
+			log.Printf("fetchRelease -- fail to remove download dir: path=%s err=%v", dldDir, err)
+		}
+	}()
+
+	log.Printf("fetchRelease -- getting saya release zip: at=%s", releaseUrl)
+	dldZipPath, err := downloadRelease(releaseUrl, dldDir)
+	if err != nil {
+		return "", err
+	}
+	actualSha256, err := fileSha256(dldZipPath)
+	if err != nil {
+		return "", err
+	}
+	if actualSha256 != wantSha256 {
+		return "", errors.Errorf(
+			"fetchRelease -- checksum mismatch: url=%s expected-sha256=%s actual-sha256=%s",
+			releaseUrl, wantSha256, actualSha256)
+	}
+	// only verified releases make it into the cache
+	if err := os.Rename(dldZipPath, zipPath); err != nil {
+		return "", errors.Wrapf(err, "fetchRelease -- fail to move release into cache: path=%s err=%v", zipPath, err)
+	}
+	return zipPath, nil
+}
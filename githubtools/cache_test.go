@@ -0,0 +1,83 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubtools
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetchReleaseUsesCache(t *testing.T) {
+	const zipName = "saya_teaser-20231005T135240_linux_arm64.zip"
+	mirrorDir := filepath.Join(t.TempDir(), "saya_teaser-20231005T135240")
+	require.NoError(t, os.MkdirAll(mirrorDir, 0755))
+	zipPath := filepath.Join(mirrorDir, zipName)
+	checksumsPath := filepath.Join(mirrorDir, checksumsFileName)
+	releaseUrl := "file://" + filepath.ToSlash(zipPath)
+	cacheDir := t.TempDir()
+
+	zipV1 := sayaReleaseZipStub(t)
+	require.NoError(t, os.WriteFile(zipPath, zipV1, 0600))
+	require.NoError(t, os.WriteFile(checksumsPath, sha256SumsOf(t, map[string][]byte{zipName: zipV1}), 0600))
+
+	cachedPath, err := fetchRelease(releaseUrl, cacheDir, t.TempDir(), ReleaseVerification{})
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(cacheDir, "saya_teaser-20231005T135240", zipName), cachedPath)
+
+	// the mirror zip is gone, the cached one matches the published checksum
+	require.NoError(t, os.Remove(zipPath))
+	cachedPathAgain, err := fetchRelease(releaseUrl, cacheDir, t.TempDir(), ReleaseVerification{})
+	require.NoError(t, err)
+	require.Equal(t, cachedPath, cachedPathAgain)
+
+	// a new checksum is published, the release is downloaded again
+	zipV2 := append(append([]byte{}, zipV1...), []byte("v2")...)
+	require.NoError(t, os.WriteFile(zipPath, zipV2, 0600))
+	require.NoError(t, os.WriteFile(checksumsPath, sha256SumsOf(t, map[string][]byte{zipName: zipV2}), 0600))
+	_, err = fetchRelease(releaseUrl, cacheDir, t.TempDir(), ReleaseVerification{})
+	require.NoError(t, err)
+	content, err := os.ReadFile(cachedPath)
+	require.NoError(t, err)
+	require.Equal(t, zipV2, content)
+
+	// a tampered download never makes it into the cache
+	require.NoError(t, os.WriteFile(zipPath, []byte("tampered"), 0600))
+	require.NoError(t, os.WriteFile(checksumsPath, sha256SumsOf(t, map[string][]byte{zipName: zipV1}), 0600))
+	_, err = fetchRelease(releaseUrl, cacheDir, t.TempDir(), ReleaseVerification{})
+	require.ErrorContains(t, err, "checksum mismatch")
+	content, err = os.ReadFile(cachedPath)
+	require.NoError(t, err)
+	require.Equal(t, zipV2, content)
+}
+
+func TestFetchReleaseDoesNotCacheUnverifiedRelease(t *testing.T) {
+	mirrorDir := filepath.Join(t.TempDir(), "r1")
+	require.NoError(t, os.MkdirAll(mirrorDir, 0755))
+	zipPath := filepath.Join(mirrorDir, "saya.zip")
+	require.NoError(t, os.WriteFile(zipPath, sayaReleaseZipStub(t), 0600))
+	cacheDir := t.TempDir()
+	tmpDir := t.TempDir()
+
+	fetchedPath, err := fetchRelease("file://"+filepath.ToSlash(zipPath), cacheDir, tmpDir, ReleaseVerification{Skip: true})
+
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(tmpDir, "saya.zip"), fetchedPath)
+	cached, err := os.ReadDir(cacheDir)
+	require.NoError(t, err)
+	require.Empty(t, cached, "unverified releases must not be cached")
+}
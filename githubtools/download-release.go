@@ -17,12 +17,11 @@ package githubtools
 import (
 	"archive/zip"
 	"encoding/json"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
-	"os/exec"
-	"path"
 	"path/filepath"
 	"strings"
 
@@ -32,107 +31,102 @@ import (
 	"golang.org/x/exp/slices"
 )
 
-func InstallSayaReleaseBin(releaseName string, binInstallDir string) error {
+// DownloadOptions specifies which saya release asset is downloaded, where it is cached and how it is verified.
+type DownloadOptions struct {
+	Platform     string // platform (os/arch) of the release asset; defaults to the host platform
+	CacheDir     string // directory where downloaded releases are cached; defaults to <user-cache-dir>/terraform-provider-saya/downloads
+	Verification ReleaseVerification
+}
+
+// InstallSayaReleaseBin downloads the saya release, verifies it and runs the setup of its saya binary.
+// In dry-run mode it only prints the plan: nothing is downloaded, extracted or run.
+func InstallSayaReleaseBin(
+	releaseName string, binInstallDir string, dlOpts DownloadOptions, setupOpts SetupOptions,
+) error {
 	releaseUrl := ""
 
+	platform, err := ParsePlatform(dlOpts.Platform)
+	if err != nil {
+		return err
+	}
+	if err := setupOpts.Validate(); err != nil {
+		return err
+	}
+
 	altReleaseUrl, avail := os.LookupEnv("SAYA_RELEASE_URL")
 	log.Printf("InstallSayaReleaseBin -- alternative setting by environment: avail=%t, altReleaseUrl=%s", avail, altReleaseUrl)
 	if altReleaseUrl = strings.TrimSpace(altReleaseUrl); avail && altReleaseUrl != "" {
 		log.Printf("InstallSayaReleaseBin -- using saya release url setting from environment: altReleaseUrl=%s", altReleaseUrl)
 		releaseUrl = altReleaseUrl
 	} else {
-		altReleaseUrl, err := getReleaseUrl(releaseName)
+		altReleaseUrl, err := getReleaseUrl(releaseName, platform)
 		if err != nil {
 			return err
 		}
 		releaseUrl = altReleaseUrl
 	}
 
-	tmpDir, err := os.MkdirTemp("", "dld-saya-release-*")
-	if err != nil {
-		return errors.Wrapf(err, "InstallSayaReleaseBin -- fail to create tempdir to download saya release: err=%v", err)
+	cacheDir := strings.TrimSpace(dlOpts.CacheDir)
+	if cacheDir == "" {
+		if cacheDir, err = DefaultDownloadCacheDir(); err != nil {
+			return err
+		}
 	}
 
-	releaseZipPath, err := func() (string, error) {
-		// "browser_download_url": "https://github.com/congop/saya-io/releases/download/saya-teaser-20230801T204622/saya-teaser-20230801T204622.zip"
-		log.Printf("InstallSayaReleaseBin -- getting saya release zip: at=%s", releaseUrl)
-		resp, err := http.Get(releaseUrl)
-		if err != nil {
-			return "", errors.Wrapf(err, "InstallSayaReleaseBin -- fail to get release: url=%s err=%v", releaseUrl, err)
-		}
-		defer resp.Body.Close()
+	if setupOpts.DryRun {
+		return printInstallPlan(releaseUrl, cacheDir, platform, dlOpts.Verification, setupOpts)
+	}
 
-		nameBse := path.Base(releaseUrl)
-		fileTarget, err := os.CreateTemp(tmpDir, nameBse)
-		if err != nil {
-			return "", errors.Wrapf(err, "InstallSayaReleaseBin -- fail to create file to save download: "+
-				"dir=%s, base-name=%s url=%s err=%v", tmpDir, nameBse, releaseUrl, err)
-		}
-		defer fileTarget.Close()
-		_, err = io.Copy(fileTarget, resp.Body)
-		if err != nil {
-			return "", errors.Wrapf(err, "InstallSayaReleaseBin -- fail to copy get body to file: "+
-				"dir=%s, base-name=%s url=%s err=%v", tmpDir, nameBse, releaseUrl, err)
+	tmpDir, err := os.MkdirTemp("", "dld-saya-release-*")
+	if err != nil {
+		return errors.Wrapf(err, "InstallSayaReleaseBin -- fail to create tempdir to extract saya release: err=%v", err)
+	}
+	defer func() {
+		if err := os.RemoveAll(tmpDir); err != nil {
+			log.Printf("InstallSayaReleaseBin -- fail to remove tempdir: path=%s err=%v", tmpDir, err)
 		}
-
-		return fileTarget.Name(), nil
 	}()
+
+	// "browser_download_url": "https://github.com/congop/saya-io/releases/download/saya-teaser-20230801T204622/saya-teaser-20230801T204622.zip"
+	// the release must be verified before anything gets extracted and run with sudo
+	releaseZipPath, err := fetchRelease(releaseUrl, cacheDir, tmpDir, dlOpts.Verification)
 	if err != nil {
 		return err
 	}
-
-	if err := extractSayaBinary(releaseZipPath, binInstallDir, tmpDir); err != nil {
+	if err := extractSayaBinary(releaseZipPath, platform, binInstallDir, tmpDir, setupOpts); err != nil {
 		return err
 	}
 	return nil
 }
 
-func extractSayaBinary(releaseZipPath string, binInstallDir string, tmpDir string) error {
-
-	r, err := zip.OpenReader(releaseZipPath)
-	if err != nil {
-		return errors.Wrapf(err, "extractSayaBinary -- fail to open saya distribution zip: dist-path=%s err=%s", releaseZipPath, err)
+// printInstallPlan prints what InstallSayaReleaseBin would do.
+func printInstallPlan(
+	releaseUrl string, cacheDir string, platform Platform, v ReleaseVerification, setupOpts SetupOptions,
+) error {
+	setupOpts = setupOpts.withDefaults()
+	verification := "published SHA256SUMS"
+	switch {
+	case strings.TrimSpace(v.Sha256) != "":
+		verification = "pinned sha256"
+	case v.Skip:
+		verification = "none (insecure)"
+	case strings.TrimSpace(v.PublicKey) != "":
+		verification = "signed SHA256SUMS"
 	}
-	defer r.Close()
-
-	var sayaExeFileExtractedPath string
-
-	entries := make([]string, 0, len(r.File))
-
-	for _, f := range r.File {
-		if strings.HasSuffix(f.Name, "/bin/saya") {
-			sayaExeFileExtractedPath, err = func(f *zip.File) (string, error) {
-				rc, err := f.Open()
-				if err != nil {
-					return "", errors.Wrapf(err,
-						"extractSayaBinary -- fail to open saya distribution zip entry: dist-path=%s entry=%s err=%s",
-						releaseZipPath, f.Name, err)
-				}
-				defer rc.Close()
-
-				sayaExeFile, err := os.Create(filepath.Join(tmpDir, "saya"))
-				if err != nil {
-					return "", errors.Wrapf(err, "extractSayaBinary -- fail to create file to extract binary: err=%s", err)
-				}
-
-				defer sayaExeFile.Close()
-
-				_, err = io.Copy(sayaExeFile, rc)
-				if err != nil {
-					return "", errors.Wrapf(err, "extractSayaBinary -- fail to copy saya executable data: err=%s", err)
-				}
-				return sayaExeFile.Name(), nil
-			}(f)
-			if err != nil {
-				return err
-			}
-			break
-		}
-		entries = append(entries, f.Name)
+	if _, err := fmt.Fprintf(setupOpts.Out,
+		"dry-run -- would fetch saya release: url=%s cache-dir=%s platform=%s verification=%s\n",
+		releaseUrl, cacheDir, platform, verification); err != nil {
+		return errors.Wrapf(err, "printInstallPlan -- fail to print plan: err=%v", err)
 	}
+	return RunSayaSetup(filepath.Join("<extracted-release>", platform.exeName()), setupOpts)
+}
 
-	if sayaExeFileExtractedPath == "" {
-		return errors.Errorf("extractSayaBinary -- saya binary not found: entry-path=xxx/bin/saya , entries=%q", entries)
+func extractSayaBinary(
+	releaseZipPath string, platform Platform, binInstallDir string, tmpDir string, setupOpts SetupOptions,
+) error {
+	sayaExeFileExtractedPath := filepath.Join(tmpDir, platform.exeName())
+	if err := extractSayaBinaryTo(releaseZipPath, platform, sayaExeFileExtractedPath); err != nil {
+		return err
 	}
 
 	// "rwxrwxrwx"
@@ -171,38 +165,88 @@ func extractSayaBinary(releaseZipPath string, binInstallDir string, tmpDir strin
 	// 		"extractSayBinary -- fail to file mode to 0755: finalDestination=%s",
 	// 		finalDestination)
 	// }
-	if err := runSayaSetup(sayaExeFileExtractedPath); err != nil {
+	if err := runSayaSetup(sayaExeFileExtractedPath, setupOpts); err != nil {
 		return err
 	}
 	return nil
 }
 
-func runSayaSetup(sayaExeFileExtractedPath string) error {
-	if err := os.Chmod(sayaExeFileExtractedPath, 0755); err != nil {
+// extractSayaBinaryTo extracts the saya binary of the saya release zip into dstPath.
+// The binary is looked up, in order of preference, at xxx/bin/saya, bin/saya, saya and xxx/saya
+// (saya.exe for windows).
+func extractSayaBinaryTo(releaseZipPath string, platform Platform, dstPath string) error {
+	r, err := zip.OpenReader(releaseZipPath)
+	if err != nil {
+		return errors.Wrapf(err, "extractSayaBinary -- fail to open saya distribution zip: dist-path=%s err=%s", releaseZipPath, err)
+	}
+	defer r.Close()
+
+	exeName := platform.exeName()
+	entries := make([]string, 0, len(r.File))
+	var found *zip.File
+	foundRank := -1
+	for _, f := range r.File {
+		entries = append(entries, f.Name)
+		if rank := sayaBinaryEntryRank(f.Name, exeName); rank > foundRank {
+			found, foundRank = f, rank
+		}
+	}
+	if found == nil {
+		return errors.Errorf("extractSayaBinary -- saya binary not found: entry-path=xxx/bin/%s , entries=%q", exeName, entries)
+	}
+
+	rc, err := found.Open()
+	if err != nil {
 		return errors.Wrapf(err,
-			"runSayaSetupVirtualBox -- fail to file mode to 0755: sayaExeFileExtractedPath=%s err=%v",
-			sayaExeFileExtractedPath, err)
+			"extractSayaBinary -- fail to open saya distribution zip entry: dist-path=%s entry=%s err=%s",
+			releaseZipPath, found.Name, err)
 	}
-	cmd := exec.Command("sudo", sayaExeFileExtractedPath, "setup",
-		"--compute-type", "localhost", "--target", "localhost",
-		"--want-compute-type", "qemu",
-		"--target-user", "runner",
-		"--log-level", "info",
-	)
-	cmd.Stderr = os.Stderr
-	cmd.Stdout = os.Stdout
-	err := cmd.Run()
+	defer rc.Close()
+
+	sayaExeFile, err := os.Create(dstPath)
 	if err != nil {
+		return errors.Wrapf(err, "extractSayaBinary -- fail to create file to extract binary: err=%s", err)
+	}
+	defer sayaExeFile.Close()
+
+	if _, err = io.Copy(sayaExeFile, rc); err != nil {
+		return errors.Wrapf(err, "extractSayaBinary -- fail to copy saya executable data: err=%s", err)
+	}
+	return nil
+}
+
+// sayaBinaryEntryRank returns how likely the zip entry is the saya binary, -1 if it is not.
+func sayaBinaryEntryRank(entryName string, exeName string) int {
+	segs := strings.Split(strings.TrimPrefix(entryName, "./"), "/")
+	if segs[len(segs)-1] != exeName {
+		return -1
+	}
+	switch {
+	case len(segs) >= 3 && segs[len(segs)-2] == "bin":
+		return 3
+	case len(segs) == 2 && segs[0] == "bin":
+		return 2
+	case len(segs) == 1:
+		return 1
+	case len(segs) == 2:
+		return 0
+	default:
+		return -1
+	}
+}
+
+func runSayaSetup(sayaExeFileExtractedPath string, setupOpts SetupOptions) error {
+	if err := os.Chmod(sayaExeFileExtractedPath, 0755); err != nil {
 		return errors.Wrapf(err,
-			"runSayaSetupVirtualBox -- fail to run setup: sayaExeFileExtractedPath=%s err=%v",
+			"runSayaSetup -- fail to file mode to 0755: sayaExeFileExtractedPath=%s err=%v",
 			sayaExeFileExtractedPath, err)
 	}
-	return nil
+	return RunSayaSetup(sayaExeFileExtractedPath, setupOpts)
 }
 
 const releaseEntryKeyName = "name"
 
-func getReleaseUrl(releaseName string) (string, error) {
+func getReleaseUrl(releaseName string, platform Platform) (string, error) {
 	releasesJsonBytes, err := getSayaIoReleases()
 	if err != nil {
 		return "", err
@@ -273,26 +317,10 @@ func getReleaseUrl(releaseName string) (string, error) {
 			maps.Keys(foundRelease))
 	}
 
-	foundIndex := slices.IndexFunc[[]map[string]any](assets, func(asset map[string]any) bool {
-		switch name, avail, err := MapValue[string, string](asset, "name"); {
-		case err != nil:
-			return false
-		case !avail:
-			return false
-		case strings.HasSuffix(name, "linux_amd64.zip"):
-			return true
-		default:
-			return false
-		}
-
-	})
-	if foundIndex == -1 {
-		return "", errors.Wrapf(err,
-			"getReleaseUrl -- fail to find linux amd64 release asset: assets=%v",
-			assets)
+	asset, err := selectReleaseAsset(assets, platform)
+	if err != nil {
+		return "", err
 	}
-
-	asset := assets[foundIndex]
 	browserUrl, avail, err := MapValue[string, string](asset, "browser_download_url")
 	if err != nil {
 		return "", errors.Wrapf(err,
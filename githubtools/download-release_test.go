@@ -26,6 +26,7 @@ import (
 
 	"github.com/congop/execstub"
 	"github.com/congop/execstub/pkg/comproto"
+	"github.com/congop/terraform-provider-saya/internal/saya"
 	"github.com/jarcoal/httpmock"
 	"github.com/stretchr/testify/require"
 )
@@ -62,7 +63,9 @@ func TestInstallSayaReleaseBin(t *testing.T) {
 		releaseName   string
 		binInstallDir string
 		altReleaseUrl *string
+		checksums     *string // published SHA256SUMS content; defaults to the checksum of the release zip stub
 	}
+	badChecksums := strings.Repeat("0", 64) + "  saya_teaser-20231005T135240_linux_amd64.zip\n"
 	tests := []struct {
 		name    string
 		args    args
@@ -78,10 +81,16 @@ func TestInstallSayaReleaseBin(t *testing.T) {
 			args:    args{releaseName: "", binInstallDir: t.TempDir(), altReleaseUrl: &altReleaseUrl},
 			wantErr: false,
 		},
+		{
+			name:    "should-abort-before-setup-on-checksum-mismatch",
+			args:    args{releaseName: "", binInstallDir: t.TempDir(), checksums: &badChecksums},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			//given
+			installCmd = ""
 			httpmock.Activate()
 			defer httpmock.DeactivateAndReset()
 			httpmock.RegisterResponder("GET", sayaIoReleaseJsonUrl,
@@ -92,6 +101,20 @@ func TestInstallSayaReleaseBin(t *testing.T) {
 				func(*http.Request) (*http.Response, error) {
 					return httpmock.NewBytesResponse(200, sayaReleaseZipStub(t)), nil
 				})
+			checksums := sha256SumsOf(t, map[string][]byte{
+				"saya_teaser-20231005T135240_linux_amd64.zip": sayaReleaseZipStub(t),
+				"dasasa": sayaReleaseZipStub(t),
+			})
+			if tt.args.checksums != nil {
+				checksums = []byte(*tt.args.checksums)
+			}
+			httpmock.RegisterResponder(
+				"GET",
+				"https://github.com/congop/saya-io/releases/download/saya_teaser-20231005T135240/SHA256SUMS",
+				httpmock.NewBytesResponder(200, checksums))
+			httpmock.RegisterResponder(
+				"GET", "http://localhost:1235/dasas/SHA256SUMS",
+				httpmock.NewBytesResponder(200, checksums))
 			require.NoErrorf(t, os.Unsetenv("SAYA_RELEASE_URL"), "fail to unset environment variable SAYA_RELEASE_URL")
 			if tt.args.altReleaseUrl != nil {
 				httpmock.RegisterResponder(
@@ -109,12 +132,18 @@ func TestInstallSayaReleaseBin(t *testing.T) {
 			givenSayaExeAlreadyInstalled(t, tt.args.binInstallDir)
 
 			// when
-			err := InstallSayaReleaseBin(tt.args.releaseName, tt.args.binInstallDir)
+			err := InstallSayaReleaseBin(
+				tt.args.releaseName, tt.args.binInstallDir,
+				DownloadOptions{Platform: "linux/amd64", CacheDir: t.TempDir()},
+				SetupOptions{Escalation: saya.EscalationSudo})
 
 			//then
 			if (err != nil) != tt.wantErr {
 				t.Errorf("InstallSayaReleaseBin() error = %v, wantErr %v", err, tt.wantErr)
 			}
+			if err != nil {
+				require.Emptyf(t, installCmd, "setup must not run for a release failing verification")
+			}
 			if err == nil {
 				expectedCmdParts := []string{
 					"/saya", "setup",
@@ -141,6 +170,11 @@ func givenSayaExeAlreadyInstalled(t *testing.T, binInstallDir string) {
 const fakeSayaExeFileContent = "#!/bin/bash\n echo 'fake saya cmd'\n exit 1"
 
 func sayaReleaseZipStub(t *testing.T) []byte {
+	return sayaReleaseZipStubWith(t, fakeSayaExeFileContent)
+}
+
+// sayaReleaseZipStubWith returns a saya release zip whose saya binary has the given content.
+func sayaReleaseZipStubWith(t *testing.T, exeContent string) []byte {
 	// Create a buffer to write our archive to.
 	buf := new(bytes.Buffer)
 
@@ -153,7 +187,7 @@ func sayaReleaseZipStub(t *testing.T) []byte {
 	}{
 		{
 			Name: "saya_teaser-20231005T135240_linux_amd64/bin/saya",
-			Body: fakeSayaExeFileContent,
+			Body: exeContent,
 		},
 		{
 			Name: "saya_teaser-20231005T135240_linux_amd64/THIRD-PARTY-NOTICES/THIRD-PARTY-NOTICES.txt",
@@ -0,0 +1,276 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubtools
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	sayaExeName          = "saya"
+	sayaReleaseLatestDir = "latest"
+	sayaReleasePinName   = "saya-release.pin"
+)
+
+// InstallOptions specifies the saya binary to install.
+type InstallOptions struct {
+	ReleaseName string // name of the saya release, e.g. saya_teaser-20231005T135240; blank for the latest one
+	DownloadUrl string // url of the release zip (http, https or file); defaults to SAYA_RELEASE_URL, then to the github release
+	Sha256      string // expected sha256 hex digest of the release zip; verified against the published SHA256SUMS if blank
+	InstallDir  string // directory where installed binaries are cached; defaults to <user-cache-dir>/terraform-provider-saya/bin
+	CacheDir    string // directory where downloaded releases are cached; defaults to <user-cache-dir>/terraform-provider-saya/downloads
+	Platform    string // platform (os/arch) of the binary to install; defaults to the host platform
+
+	Verification ReleaseVerification // how the release is verified when no sha256 is pinned
+}
+
+// DefaultInstallDir returns the default directory where installed saya binaries are cached.
+func DefaultInstallDir() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", errors.Wrapf(err, "DefaultInstallDir -- fail to get user cache dir: err=%v", err)
+	}
+	return filepath.Join(cacheDir, "terraform-provider-saya", "bin"), nil
+}
+
+// releasePin identifies the release an installed saya binary has been extracted from.
+type releasePin struct {
+	Tag    string // release tag, e.g. saya_teaser-20231005T135240
+	Sha256 string // sha256 hex digest of the release zip
+}
+
+func (pin releasePin) String() string {
+	return fmt.Sprintf("tag=%s\nsha256=%s\n", pin.Tag, pin.Sha256)
+}
+
+// InstallSayaBinary fetches the verified saya release (see fetchRelease) and extracts the saya binary
+// into <install-dir>/<release-name>/saya, or <install-dir>/<release-name>/<os>_<arch>/saya for a non host platform.
+// It returns the path of the saya binary.
+// The release tag and checksum are pinned next to the binary, which is only reused if both match the resolved release;
+// a binary extracted from an unverified release is never reused.
+func InstallSayaBinary(opts InstallOptions) (string, error) {
+	opts.ReleaseName = strings.TrimSpace(opts.ReleaseName)
+	opts.DownloadUrl = strings.TrimSpace(opts.DownloadUrl)
+	opts.InstallDir = strings.TrimSpace(opts.InstallDir)
+	opts.CacheDir = strings.TrimSpace(opts.CacheDir)
+	if sha256 := strings.TrimSpace(opts.Sha256); sha256 != "" {
+		opts.Verification.Sha256 = sha256
+	}
+
+	if opts.InstallDir == "" {
+		installDir, err := DefaultInstallDir()
+		if err != nil {
+			return "", err
+		}
+		opts.InstallDir = installDir
+	}
+	if opts.CacheDir == "" {
+		cacheDir, err := DefaultDownloadCacheDir()
+		if err != nil {
+			return "", err
+		}
+		opts.CacheDir = cacheDir
+	}
+	releaseDir := opts.ReleaseName
+	if releaseDir == "" {
+		releaseDir = sayaReleaseLatestDir
+	}
+	releaseDir = filepath.Join(opts.InstallDir, releaseDir)
+	platform, err := ParsePlatform(opts.Platform)
+	if err != nil {
+		return "", err
+	}
+	if !platform.IsHost() {
+		releaseDir = filepath.Join(releaseDir, platform.OS+"_"+platform.Arch)
+	}
+	exePath := filepath.Join(releaseDir, platform.exeName())
+	pinPath := filepath.Join(releaseDir, sayaReleasePinName)
+
+	releaseUrl, err := resolveReleaseUrl(opts, platform)
+	if err != nil {
+		return "", err
+	}
+	tmpDir, err := os.MkdirTemp("", "dld-saya-release-*")
+	if err != nil {
+		return "", errors.Wrapf(err, "InstallSayaBinary -- fail to create tempdir to download saya release: err=%v", err)
+	}
+	defer func() {
+		if err := os.RemoveAll(tmpDir); err != nil {
+			log.Printf("InstallSayaBinary -- fail to remove tempdir: path=%s err=%v", tmpDir, err)
+		}
+	}()
+	releaseZipPath, err := fetchRelease(releaseUrl, opts.CacheDir, tmpDir, opts.Verification)
+	if err != nil {
+		return "", err
+	}
+	zipSha256, err := fileSha256(releaseZipPath)
+	if err != nil {
+		return "", err
+	}
+	pin := releasePin{Tag: releaseTag(releaseUrl), Sha256: zipSha256}
+
+	verified := !opts.Verification.Skip || strings.TrimSpace(opts.Verification.Sha256) != ""
+	if installed, err := isInstalled(exePath, pinPath, pin); err != nil {
+		return "", err
+	} else if installed && verified {
+		log.Printf("InstallSayaBinary -- using installed saya binary: path=%s tag=%s sha256=%s", exePath, pin.Tag, pin.Sha256)
+		return exePath, nil
+	}
+
+	if err := os.MkdirAll(releaseDir, 0755); err != nil {
+		return "", errors.Wrapf(err, "InstallSayaBinary -- fail to create install dir: path=%s err=%v", releaseDir, err)
+	}
+	// the stale pin is removed first, so that an interrupted installation is not mistaken for a complete one
+	if err := os.Remove(pinPath); err != nil && !os.IsNotExist(err) {
+		return "", errors.Wrapf(err, "InstallSayaBinary -- fail to remove stale release pin: path=%s err=%v", pinPath, err)
+	}
+	// extracting next to the final destination and renaming makes the installation atomic
+	tmpExePath := exePath + ".tmp"
+	if err := extractSayaBinaryTo(releaseZipPath, platform, tmpExePath); err != nil {
+		return "", err
+	}
+	if err := os.Chmod(tmpExePath, 0755); err != nil {
+		return "", errors.Wrapf(err, "InstallSayaBinary -- fail to make saya executable: path=%s err=%v", tmpExePath, err)
+	}
+	if err := os.Rename(tmpExePath, exePath); err != nil {
+		return "", errors.Wrapf(err, "InstallSayaBinary -- fail to move saya binary in place: path=%s err=%v", exePath, err)
+	}
+	if verified {
+		if err := os.WriteFile(pinPath, []byte(pin.String()), 0644); err != nil {
+			return "", errors.Wrapf(err, "InstallSayaBinary -- fail to pin release: path=%s err=%v", pinPath, err)
+		}
+	}
+	log.Printf("InstallSayaBinary -- saya binary installed: path=%s url=%s sha256=%s", exePath, releaseUrl, zipSha256)
+	return exePath, nil
+}
+
+// isInstalled returns true if the saya binary exists and has been extracted from the pinned release.
+func isInstalled(exePath string, pinPath string, pin releasePin) (bool, error) {
+	if _, err := os.Stat(exePath); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, errors.Wrapf(err, "isInstalled -- fail to stat saya binary: path=%s err=%v", exePath, err)
+	}
+	recorded, err := os.ReadFile(pinPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, errors.Wrapf(err, "isInstalled -- fail to read release pin: path=%s err=%v", pinPath, err)
+	}
+	return string(recorded) == pin.String(), nil
+}
+
+func resolveReleaseUrl(opts InstallOptions, platform Platform) (string, error) {
+	if opts.DownloadUrl != "" {
+		return opts.DownloadUrl, nil
+	}
+	if altReleaseUrl := strings.TrimSpace(os.Getenv("SAYA_RELEASE_URL")); altReleaseUrl != "" {
+		log.Printf("resolveReleaseUrl -- using saya release url setting from environment: altReleaseUrl=%s", altReleaseUrl)
+		return altReleaseUrl, nil
+	}
+	return getReleaseUrl(opts.ReleaseName, platform)
+}
+
+// downloadRelease fetches the release zip into dir; file urls allow offline mirrors.
+func downloadRelease(releaseUrl string, dir string) (string, error) {
+	body, err := openUrl(releaseUrl)
+	if err != nil {
+		return "", errors.Wrapf(err, "downloadRelease -- fail to get release: url=%s err=%v", releaseUrl, err)
+	}
+	defer body.Close()
+
+	zipPath := filepath.Join(dir, path.Base(mustUrlPath(releaseUrl)))
+	zipFile, err := os.Create(zipPath)
+	if err != nil {
+		return "", errors.Wrapf(err, "downloadRelease -- fail to create file to save download: path=%s err=%v", zipPath, err)
+	}
+	defer zipFile.Close()
+	if _, err := io.Copy(zipFile, body); err != nil {
+		return "", errors.Wrapf(err, "downloadRelease -- fail to save download: url=%s path=%s err=%v", releaseUrl, zipPath, err)
+	}
+	return zipPath, nil
+}
+
+// fetchBytes returns the content at the given url.
+func fetchBytes(rawUrl string) ([]byte, error) {
+	body, err := openUrl(rawUrl)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fetchBytes -- fail to read content: url=%s err=%v", rawUrl, err)
+	}
+	return content, nil
+}
+
+// openUrl opens the content at a file, http or https url.
+func openUrl(rawUrl string) (io.ReadCloser, error) {
+	parsedUrl, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, errors.Wrapf(err, "openUrl -- bad url: url=%s err=%v", rawUrl, err)
+	}
+
+	switch parsedUrl.Scheme {
+	case "file":
+		f, err := os.Open(filepath.FromSlash(parsedUrl.Path))
+		if err != nil {
+			return nil, errors.Wrapf(err, "openUrl -- fail to open file: url=%s err=%v", rawUrl, err)
+		}
+		return f, nil
+	case "http", "https":
+		resp, err := http.Get(rawUrl)
+		if err != nil {
+			return nil, errors.Wrapf(err, "openUrl -- fail to get: url=%s err=%v", rawUrl, err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, errors.Errorf("openUrl -- fail to get: url=%s status=%s", rawUrl, resp.Status)
+		}
+		return resp.Body, nil
+	default:
+		return nil, errors.Errorf(
+			"openUrl -- unsupported url scheme: url=%s scheme=%s supported=%q",
+			rawUrl, parsedUrl.Scheme, []string{"file", "http", "https"})
+	}
+}
+
+func fileSha256(filePath string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", errors.Wrapf(err, "fileSha256 -- fail to open file: path=%s err=%v", filePath, err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", errors.Wrapf(err, "fileSha256 -- fail to read file: path=%s err=%v", filePath, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
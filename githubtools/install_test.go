@@ -0,0 +1,158 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubtools
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstallSayaBinaryFromFileMirror(t *testing.T) {
+	mirrorDir := t.TempDir()
+	zipBytes := sayaReleaseZipStub(t)
+	zipPath := filepath.Join(mirrorDir, "saya_teaser-20231005T135240_linux_amd64.zip")
+	require.NoError(t, os.WriteFile(zipPath, zipBytes, 0600))
+	zipSum := sha256.Sum256(zipBytes)
+	zipSha256 := hex.EncodeToString(zipSum[:])
+	mirrorUrl := "file://" + filepath.ToSlash(zipPath)
+	checksums := sha256SumsOf(t, map[string][]byte{filepath.Base(zipPath): zipBytes})
+	require.NoError(t, os.WriteFile(filepath.Join(mirrorDir, "SHA256SUMS"), checksums, 0600))
+
+	tests := []struct {
+		name    string
+		opts    InstallOptions
+		wantErr bool
+	}{
+		{
+			name: "should-install-with-matching-checksum",
+			opts: InstallOptions{ReleaseName: "saya_teaser-20231005T135240", DownloadUrl: mirrorUrl, Sha256: zipSha256},
+		},
+		{
+			name: "should-install-without-checksum",
+			opts: InstallOptions{DownloadUrl: mirrorUrl},
+		},
+		{
+			name: "should-reject-missing-published-checksums",
+			opts: InstallOptions{
+				DownloadUrl:  mirrorUrl,
+				Verification: ReleaseVerification{ChecksumsUrl: "file://" + filepath.ToSlash(filepath.Join(mirrorDir, "none"))},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "should-reject-checksum-mismatch",
+			opts:    InstallOptions{DownloadUrl: mirrorUrl, Sha256: "00" + zipSha256[2:]},
+			wantErr: true,
+		},
+		{
+			name:    "should-reject-missing-mirror-file",
+			opts:    InstallOptions{DownloadUrl: "file://" + filepath.ToSlash(filepath.Join(mirrorDir, "none.zip"))},
+			wantErr: true,
+		},
+		{
+			name:    "should-reject-unsupported-scheme",
+			opts:    InstallOptions{DownloadUrl: "ftp://mirror/saya.zip"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.InstallDir = t.TempDir()
+			tt.opts.CacheDir = t.TempDir()
+			exePath, err := InstallSayaBinary(tt.opts)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			content, err := os.ReadFile(exePath)
+			require.NoError(t, err)
+			require.Equal(t, fakeSayaExeFileContent, string(content))
+			stat, err := os.Stat(exePath)
+			require.NoError(t, err)
+			require.NotZero(t, stat.Mode()&0100, "saya binary must be executable")
+		})
+	}
+}
+
+func TestInstallSayaBinaryUsesCache(t *testing.T) {
+	mirrorDir := t.TempDir()
+	zipBytes := sayaReleaseZipStub(t)
+	zipPath := filepath.Join(mirrorDir, "saya.zip")
+	require.NoError(t, os.WriteFile(zipPath, zipBytes, 0600))
+	zipSum := sha256.Sum256(zipBytes)
+	opts := InstallOptions{
+		ReleaseName: "r1",
+		DownloadUrl: "file://" + filepath.ToSlash(zipPath),
+		Sha256:      hex.EncodeToString(zipSum[:]),
+		InstallDir:  t.TempDir(),
+		CacheDir:    t.TempDir(),
+	}
+
+	exePath, err := InstallSayaBinary(opts)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(opts.InstallDir, "r1", "saya"), exePath)
+
+	// the mirror is gone, the cached binary must be used
+	require.NoError(t, os.Remove(zipPath))
+	exePathCached, err := InstallSayaBinary(opts)
+	require.NoError(t, err)
+	require.Equal(t, exePath, exePathCached)
+
+	// a binary without release pin is not reused
+	require.NoError(t, os.WriteFile(exePath, []byte("stale"), 0755))
+	require.NoError(t, os.Remove(filepath.Join(opts.InstallDir, "r1", sayaReleasePinName)))
+	_, err = InstallSayaBinary(opts)
+	require.NoError(t, err)
+	content, err := os.ReadFile(exePath)
+	require.NoError(t, err)
+	require.Equal(t, fakeSayaExeFileContent, string(content))
+
+	// a different expected checksum invalidates the cache
+	opts.Sha256 = "00" + opts.Sha256[2:]
+	_, err = InstallSayaBinary(opts)
+	require.Error(t, err)
+}
+
+func TestInstallSayaBinaryReinstallsOtherRelease(t *testing.T) {
+	mirrorDir := t.TempDir()
+	opts := InstallOptions{InstallDir: t.TempDir(), CacheDir: t.TempDir()}
+	installFrom := func(tag string, exeContent string) string {
+		zipBytes := sayaReleaseZipStubWith(t, exeContent)
+		zipPath := filepath.Join(mirrorDir, tag, "saya.zip")
+		require.NoError(t, os.MkdirAll(filepath.Dir(zipPath), 0755))
+		require.NoError(t, os.WriteFile(zipPath, zipBytes, 0600))
+		require.NoError(t, os.WriteFile(
+			filepath.Join(filepath.Dir(zipPath), checksumsFileName), sha256SumsOf(t, map[string][]byte{"saya.zip": zipBytes}), 0600))
+		opts.DownloadUrl = "file://" + filepath.ToSlash(zipPath)
+		exePath, err := InstallSayaBinary(opts)
+		require.NoError(t, err)
+		return exePath
+	}
+
+	exePath := installFrom("r1", "r1-exe")
+	require.Equal(t, filepath.Join(opts.InstallDir, sayaReleaseLatestDir, "saya"), exePath)
+
+	// the latest release changed, the installed binary of the previous one must not be reused
+	exePath = installFrom("r2", "r2-exe")
+	content, err := os.ReadFile(exePath)
+	require.NoError(t, err)
+	require.Equal(t, "r2-exe", string(content))
+}
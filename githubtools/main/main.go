@@ -17,20 +17,55 @@ package main
 import (
 	"flag"
 	"log"
+	"strings"
 
 	"github.com/congop/terraform-provider-saya/githubtools"
+	"github.com/congop/terraform-provider-saya/internal/saya"
 )
 
+// stringsFlag is a repeatable flag, each occurrence may also be a comma separated list.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringsFlag) Set(value string) error {
+	*f = append(*f, strings.Split(value, ",")...)
+	return nil
+}
+
 func main() {
 	var binInstallDir string
 	var releaseName string
+	var dlOpts githubtools.DownloadOptions
+	verification := &dlOpts.Verification
+	var setupOpts githubtools.SetupOptions
+	var wantComputeTypes stringsFlag
 
 	flag.StringVar(&binInstallDir, "bin-install-dir", "/usr/bin/", "set the target saya binary installation directory; the default is /usr/bin")
 	flag.StringVar(&releaseName, "release-name", "", "set the name of the saya release to download")
 
+	flag.StringVar(&dlOpts.Platform, "platform", "", "set the platform (os/arch, e.g. linux/arm64) of the release to download; the default is the host platform")
+	flag.StringVar(&dlOpts.CacheDir, "download-cache-dir", "", "set the directory where downloaded releases are cached; the default is <user-cache-dir>/terraform-provider-saya/downloads")
+	flag.StringVar(&verification.ChecksumsUrl, "checksums-url", "", "set the url of the SHA256SUMS file; the default is SHA256SUMS next to the release zip")
+	flag.StringVar(&verification.SignatureUrl, "signature-url", "", "set the url of the SHA256SUMS signature; the default is SHA256SUMS.minisig or SHA256SUMS.sig")
+	flag.StringVar(&verification.PublicKey, "public-key", "", "set the pinned minisign or base64 ed25519 public key used to verify the SHA256SUMS signature")
+	flag.BoolVar(&verification.Skip, "insecure-skip-verify", false, "skip the release checksum and signature verification")
+
+	flag.StringVar(&setupOpts.ComputeType, "compute-type", "localhost", "set the compute type of the setup target")
+	flag.StringVar(&setupOpts.Target, "target", "localhost", "set the setup target")
+	flag.Var(&wantComputeTypes, "want-compute-type", "add compute types to set up (repeatable or comma separated); the default is qemu")
+	flag.StringVar(&setupOpts.TargetUser, "target-user", "runner", "set the user saya is set up for")
+	flag.StringVar(&setupOpts.LogLevel, "log-level", "info", "set the saya setup log level")
+	flag.StringVar(&setupOpts.Escalation, "escalation", saya.DefaultEscalation,
+		"set the privilege escalation of the setup: sudo, sudo-if-not-root or none")
+	flag.BoolVar(&setupOpts.DryRun, "dry-run", false, "only print the installation plan")
+
 	flag.Parse()
+	setupOpts.WantComputeTypes = wantComputeTypes
 
-	err := githubtools.InstallSayaReleaseBin(releaseName, binInstallDir)
+	err := githubtools.InstallSayaReleaseBin(releaseName, binInstallDir, dlOpts, setupOpts)
 	if err != nil {
 		log.Fatalf("%+v", err)
 	}
@@ -0,0 +1,123 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubtools
+
+import (
+	"runtime"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// Platform is the os and architecture a saya release asset is built for, using go naming (e.g. linux/arm64).
+type Platform struct {
+	OS   string
+	Arch string
+}
+
+// HostPlatform returns the platform of the running process.
+func HostPlatform() Platform {
+	return Platform{OS: runtime.GOOS, Arch: runtime.GOARCH}
+}
+
+// ParsePlatform parses a platform in the form os/arch or os_arch; a blank platform is the host platform.
+func ParsePlatform(platform string) (Platform, error) {
+	platform = strings.ToLower(strings.TrimSpace(platform))
+	if platform == "" {
+		return HostPlatform(), nil
+	}
+	sep := "/"
+	if !strings.Contains(platform, sep) {
+		sep = "_"
+	}
+	goos, arch, found := strings.Cut(platform, sep)
+	if !found || goos == "" || arch == "" || strings.ContainsAny(arch, "/_") {
+		return Platform{}, errors.Errorf(
+			"ParsePlatform -- bad platform, expected os/arch (e.g. linux/arm64): platform=%s", platform)
+	}
+	return Platform{OS: goos, Arch: arch}, nil
+}
+
+func (p Platform) String() string {
+	return p.OS + "/" + p.Arch
+}
+
+// IsHost returns true if p is the platform of the running process.
+func (p Platform) IsHost() bool {
+	return p == HostPlatform()
+}
+
+// assetSuffix is the suffix of the release asset names for the platform, e.g. _linux_arm64.zip.
+func (p Platform) assetSuffix() string {
+	return "_" + p.OS + "_" + p.Arch + ".zip"
+}
+
+// exeName is the name of the saya binary for the platform.
+func (p Platform) exeName() string {
+	if p.OS == "windows" {
+		return sayaExeName + ".exe"
+	}
+	return sayaExeName
+}
+
+// selectReleaseAsset returns the release asset built for the platform.
+// Releases prior to multi-platform support only have a single linux/amd64 asset without platform suffix.
+func selectReleaseAsset(assets []map[string]any, platform Platform) (map[string]any, error) {
+	names := make([]string, 0, len(assets))
+	for _, asset := range assets {
+		name, _, err := MapValue[string, string](asset, "name")
+		if err != nil {
+			return nil, errors.Wrapf(err, "selectReleaseAsset -- fail to get asset name: available-keys=%q err=%v",
+				maps.Keys(asset), err)
+		}
+		names = append(names, name)
+	}
+
+	if idx := slices.IndexFunc(names, func(name string) bool {
+		return strings.HasSuffix(name, platform.assetSuffix())
+	}); idx != -1 {
+		return assets[idx], nil
+	}
+
+	legacyPlatform := Platform{OS: "linux", Arch: "amd64"}
+	hasPlatformSuffix := func(name string) bool {
+		parts := strings.Split(strings.TrimSuffix(name, ".zip"), "_")
+		return len(parts) >= 3 && slices.Contains(knownGoOSes, parts[len(parts)-2])
+	}
+	if platform == legacyPlatform {
+		zipIdx := -1
+		for i, name := range names {
+			if !strings.HasSuffix(name, ".zip") || hasPlatformSuffix(name) {
+				continue
+			}
+			if zipIdx != -1 {
+				zipIdx = -1
+				break
+			}
+			zipIdx = i
+		}
+		if zipIdx != -1 {
+			return assets[zipIdx], nil
+		}
+	}
+
+	return nil, errors.Errorf(
+		"selectReleaseAsset -- no release asset for platform: platform=%s asset-suffix=%s assets=%q",
+		platform, platform.assetSuffix(), names)
+}
+
+var knownGoOSes = []string{"darwin", "freebsd", "linux", "netbsd", "openbsd", "windows"}
@@ -0,0 +1,183 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubtools
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePlatform(t *testing.T) {
+	tests := []struct {
+		platform string
+		want     Platform
+		wantErr  bool
+	}{
+		{platform: "", want: HostPlatform()},
+		{platform: "linux/arm64", want: Platform{OS: "linux", Arch: "arm64"}},
+		{platform: " Linux_AMD64 ", want: Platform{OS: "linux", Arch: "amd64"}},
+		{platform: "windows/amd64", want: Platform{OS: "windows", Arch: "amd64"}},
+		{platform: "linux", wantErr: true},
+		{platform: "linux/", wantErr: true},
+		{platform: "linux/arm/v7", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.platform, func(t *testing.T) {
+			got, err := ParsePlatform(tt.platform)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSelectReleaseAsset(t *testing.T) {
+	releases := []map[string]any{}
+	require.NoError(t, json.Unmarshal(getTestReleaseResp(t), &releases))
+	assetsOf := func(idx int) []map[string]any {
+		assets, _, err := MapArrayValue[string, map[string]any](releases[idx], "assets")
+		require.NoError(t, err)
+		return assets
+	}
+
+	tests := []struct {
+		name      string
+		assets    []map[string]any
+		platform  Platform
+		wantAsset string
+		wantErr   bool
+	}{
+		{
+			name:      "should-select-linux-amd64",
+			assets:    assetsOf(0),
+			platform:  Platform{OS: "linux", Arch: "amd64"},
+			wantAsset: "saya_teaser-20231005T135240_linux_amd64.zip",
+		},
+		{
+			name:      "should-select-windows-amd64",
+			assets:    assetsOf(0),
+			platform:  Platform{OS: "windows", Arch: "amd64"},
+			wantAsset: "saya_teaser-20231005T135240_windows_amd64.zip",
+		},
+		{
+			name:     "should-not-fallback-to-other-arch",
+			assets:   assetsOf(0),
+			platform: Platform{OS: "linux", Arch: "arm64"},
+			wantErr:  true,
+		},
+		{
+			name:      "should-select-legacy-asset-for-linux-amd64",
+			assets:    assetsOf(1),
+			platform:  Platform{OS: "linux", Arch: "amd64"},
+			wantAsset: "saya-teaser-20230816T075416.zip",
+		},
+		{
+			name:     "should-not-select-legacy-asset-for-linux-arm64",
+			assets:   assetsOf(1),
+			platform: Platform{OS: "linux", Arch: "arm64"},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			asset, err := selectReleaseAsset(tt.assets, tt.platform)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.wantAsset, asset["name"])
+		})
+	}
+}
+
+func TestExtractSayaBinaryToLayouts(t *testing.T) {
+	linux := Platform{OS: "linux", Arch: "arm64"}
+	windows := Platform{OS: "windows", Arch: "amd64"}
+	tests := []struct {
+		name     string
+		entries  map[string]string
+		platform Platform
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "should-prefer-release-dir-bin",
+			entries:  map[string]string{"saya_linux_arm64/bin/saya": "bin", "saya_linux_arm64/saya": "root"},
+			platform: linux,
+			want:     "bin",
+		},
+		{
+			name:     "should-extract-bin-at-zip-root",
+			entries:  map[string]string{"bin/saya": "bin", "LICENSE": "commercial."},
+			platform: linux,
+			want:     "bin",
+		},
+		{
+			name:     "should-extract-flat-binary",
+			entries:  map[string]string{"saya": "flat", "LICENSE": "commercial."},
+			platform: linux,
+			want:     "flat",
+		},
+		{
+			name:     "should-extract-windows-exe",
+			entries:  map[string]string{"saya_windows_amd64/bin/saya.exe": "exe"},
+			platform: windows,
+			want:     "exe",
+		},
+		{
+			name:     "should-fail-without-binary",
+			entries:  map[string]string{"saya_linux_arm64/doc/saya": "doc-dir-is-too-deep", "LICENSE": "commercial."},
+			platform: linux,
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := new(bytes.Buffer)
+			w := zip.NewWriter(buf)
+			for name, body := range tt.entries {
+				f, err := w.Create(name)
+				require.NoError(t, err)
+				_, err = f.Write([]byte(body))
+				require.NoError(t, err)
+			}
+			require.NoError(t, w.Close())
+			dir := t.TempDir()
+			zipPath := filepath.Join(dir, "saya.zip")
+			require.NoError(t, os.WriteFile(zipPath, buf.Bytes(), 0600))
+
+			dstPath := filepath.Join(dir, "extracted")
+			err := extractSayaBinaryTo(zipPath, tt.platform, dstPath)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			content, err := os.ReadFile(dstPath)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, string(content))
+		})
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubtools
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/congop/terraform-provider-saya/internal/saya"
+	"github.com/pkg/errors"
+	"golang.org/x/exp/slices"
+)
+
+// isLocalRoot is a variable so tests can simulate running as root.
+var isLocalRoot = saya.IsLocalRoot
+
+// SetupOptions specifies how saya setup is run after installation.
+type SetupOptions struct {
+	ComputeType      string    // compute type of the setup target; defaults to localhost
+	Target           string    // setup target; defaults to localhost
+	WantComputeTypes []string  // compute types to be set up; defaults to qemu
+	TargetUser       string    // user saya is set up for; defaults to runner
+	LogLevel         string    // saya log level; defaults to info
+	Escalation       string    // privilege escalation: sudo, sudo-if-not-root (default) or none, see saya.Escalations
+	DryRun           bool      // true to only print the plan
+	Out              io.Writer // where the dry-run plan and the setup output are written; defaults to stdout
+}
+
+// DefaultSetupOptions returns the options used to set up CI runners.
+func DefaultSetupOptions() SetupOptions {
+	return SetupOptions{}.withDefaults()
+}
+
+func (opts SetupOptions) withDefaults() SetupOptions {
+	defaultIfBlank := func(val *string, defaultVal string) {
+		if *val = strings.TrimSpace(*val); *val == "" {
+			*val = defaultVal
+		}
+	}
+	defaultIfBlank(&opts.ComputeType, "localhost")
+	defaultIfBlank(&opts.Target, "localhost")
+	defaultIfBlank(&opts.TargetUser, "runner")
+	defaultIfBlank(&opts.LogLevel, "info")
+	defaultIfBlank(&opts.Escalation, saya.DefaultEscalation)
+
+	wantComputeTypes := make([]string, 0, len(opts.WantComputeTypes))
+	for _, ct := range opts.WantComputeTypes {
+		if ct = strings.TrimSpace(ct); ct != "" && !slices.Contains(wantComputeTypes, ct) {
+			wantComputeTypes = append(wantComputeTypes, ct)
+		}
+	}
+	if len(wantComputeTypes) == 0 {
+		wantComputeTypes = []string{"qemu"}
+	}
+	opts.WantComputeTypes = wantComputeTypes
+
+	if opts.Out == nil {
+		opts.Out = os.Stdout
+	}
+	return opts
+}
+
+// Validate returns an error if the options are not valid once defaulted.
+func (opts SetupOptions) Validate() error {
+	_, err := saya.NormalizeEscalation(opts.Escalation)
+	return err
+}
+
+// Command returns the setup command line for the saya executable at sayaExe.
+func (opts SetupOptions) Command(sayaExe string) []string {
+	opts = opts.withDefaults()
+	cmd := saya.EscalationPrefix(opts.Escalation, isLocalRoot())
+	cmd = append(cmd, sayaExe, "setup", "--compute-type", opts.ComputeType, "--target", opts.Target)
+	for _, ct := range opts.WantComputeTypes {
+		cmd = append(cmd, "--want-compute-type", ct)
+	}
+	cmd = append(cmd, "--target-user", opts.TargetUser, "--log-level", opts.LogLevel)
+	return cmd
+}
+
+// RunSayaSetup runs saya setup with the saya executable at sayaExe, or only prints the plan in dry-run mode.
+func RunSayaSetup(sayaExe string, opts SetupOptions) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	opts = opts.withDefaults()
+	cmdLine := opts.Command(sayaExe)
+	if opts.DryRun {
+		_, err := fmt.Fprintf(opts.Out, "dry-run -- would run saya setup: %s\n", strings.Join(cmdLine, " "))
+		return errors.Wrapf(err, "RunSayaSetup -- fail to print plan: err=%v", err)
+	}
+
+	cmd := exec.Command(cmdLine[0], cmdLine[1:]...)
+	cmd.Stderr = os.Stderr
+	cmd.Stdout = opts.Out
+	if err := cmd.Run(); err != nil {
+		return errors.Wrapf(err,
+			"RunSayaSetup -- fail to run setup: cmd=%q err=%v",
+			cmdLine, err)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubtools
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/congop/terraform-provider-saya/internal/saya"
+	"github.com/stretchr/testify/require"
+)
+
+// sudoPrefix only preserves the allow-listed variables of the minimal saya environment.
+const sudoPrefix = "sudo --non-interactive --preserve-env=HOME,LANG,LC_ALL,LOGNAME,PATH,SHELL,SSL_CERT_DIR,SSL_CERT_FILE," +
+	"TEMP,TMP,TMPDIR,TZ,USER,XDG_CACHE_HOME,XDG_CONFIG_HOME,XDG_RUNTIME_DIR"
+
+func TestSetupOptionsCommand(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  SetupOptions
+		root  bool
+		wantC string
+	}{
+		{
+			name:  "should-default-to-ci-runner-setup",
+			opts:  SetupOptions{},
+			wantC: sudoPrefix + " /x/saya setup --compute-type localhost --target localhost --want-compute-type qemu --target-user runner --log-level info",
+		},
+		{
+			name: "should-support-multiple-compute-types-and-custom-user",
+			opts: SetupOptions{
+				WantComputeTypes: []string{"qemu", " virtualbox ", "qemu", ""},
+				TargetUser:       "dev",
+				LogLevel:         "debug",
+			},
+			wantC: sudoPrefix + " /x/saya setup --compute-type localhost --target localhost " +
+				"--want-compute-type qemu --want-compute-type virtualbox --target-user dev --log-level debug",
+		},
+		{
+			name:  "should-skip-sudo-when-root",
+			opts:  SetupOptions{Escalation: saya.EscalationSudoIfNotRoot},
+			root:  true,
+			wantC: "/x/saya setup --compute-type localhost --target localhost --want-compute-type qemu --target-user runner --log-level info",
+		},
+		{
+			name:  "should-sudo-when-not-root",
+			opts:  SetupOptions{Escalation: saya.EscalationSudoIfNotRoot},
+			wantC: sudoPrefix + " /x/saya setup --compute-type localhost --target localhost --want-compute-type qemu --target-user runner --log-level info",
+		},
+		{
+			name:  "should-never-escalate",
+			opts:  SetupOptions{Escalation: saya.EscalationNone},
+			wantC: "/x/saya setup --compute-type localhost --target localhost --want-compute-type qemu --target-user runner --log-level info",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func(orig func() bool) { isLocalRoot = orig }(isLocalRoot)
+			isLocalRoot = func() bool { return tt.root }
+
+			require.Equal(t, tt.wantC, strings.Join(tt.opts.Command("/x/saya"), " "))
+		})
+	}
+}
+
+func TestRunSayaSetupDryRun(t *testing.T) {
+	out := new(bytes.Buffer)
+	opts := SetupOptions{Escalation: saya.EscalationNone, DryRun: true, Out: out}
+
+	// the executable does not exist, nothing must be run
+	err := RunSayaSetup("/does/not/exist/saya", opts)
+
+	require.NoError(t, err)
+	require.Equal(t,
+		"dry-run -- would run saya setup: /does/not/exist/saya setup --compute-type localhost --target localhost "+
+			"--want-compute-type qemu --target-user runner --log-level info\n",
+		out.String())
+}
+
+func TestSetupOptionsValidate(t *testing.T) {
+	require.NoError(t, SetupOptions{}.Validate())
+	require.Error(t, SetupOptions{Escalation: "doas"}.Validate())
+	require.Error(t, RunSayaSetup("/x/saya", SetupOptions{Escalation: "doas", DryRun: true}))
+}
+
+func TestInstallSayaReleaseBinDryRunHasNoSideEffects(t *testing.T) {
+	// the release does not exist, nothing must be fetched
+	t.Setenv("SAYA_RELEASE_URL", "file:///does/not/exist/r1/saya.zip")
+	cacheDir := filepath.Join(t.TempDir(), "downloads")
+	out := new(bytes.Buffer)
+
+	err := InstallSayaReleaseBin("", "/does/not/exist/bin",
+		DownloadOptions{Platform: "linux/amd64", CacheDir: cacheDir},
+		SetupOptions{Escalation: saya.EscalationNone, DryRun: true, Out: out})
+
+	require.NoError(t, err)
+	require.Equal(t,
+		"dry-run -- would fetch saya release: url=file:///does/not/exist/r1/saya.zip cache-dir="+cacheDir+
+			" platform=linux/amd64 verification=published SHA256SUMS\n"+
+			"dry-run -- would run saya setup: <extracted-release>/saya setup --compute-type localhost --target localhost "+
+			"--want-compute-type qemu --target-user runner --log-level info\n",
+		out.String())
+	_, err = os.Stat(cacheDir)
+	require.True(t, os.IsNotExist(err), "dry-run must not create the download cache")
+}
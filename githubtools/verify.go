@@ -0,0 +1,232 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubtools
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/blake2b"
+)
+
+const (
+	checksumsFileName      = "SHA256SUMS"
+	minisignSigExt         = ".minisig"
+	rawSigExt              = ".sig"
+	minisignAlgEd          = "Ed" // signature over the message
+	minisignAlgEdPrehashed = "ED" // signature over the blake2b-512 hash of the message
+	minisignKeyIdLen       = 8
+)
+
+// ReleaseVerification specifies how a downloaded release is verified before being extracted.
+type ReleaseVerification struct {
+	ChecksumsUrl string // url of the SHA256SUMS file; defaults to SHA256SUMS next to the release zip
+	SignatureUrl string // url of the detached signature of the SHA256SUMS file; defaults to <checksums-url>.minisig or .sig
+	PublicKey    string // pinned minisign public key or base64 encoded ed25519 public key; the signature is not verified if blank
+	Sha256       string // pinned sha256 hex digest of the release zip; takes precedence over the published SHA256SUMS
+	Skip         bool   // true to skip the verification, e.g. for development mirrors; insecure
+}
+
+func (v ReleaseVerification) checksumsUrl(releaseUrl string) (string, error) {
+	if checksumsUrl := strings.TrimSpace(v.ChecksumsUrl); checksumsUrl != "" {
+		return checksumsUrl, nil
+	}
+	return siblingUrl(releaseUrl, checksumsFileName)
+}
+
+func (v ReleaseVerification) signatureUrl(checksumsUrl string, minisign bool) string {
+	if signatureUrl := strings.TrimSpace(v.SignatureUrl); signatureUrl != "" {
+		return signatureUrl
+	}
+	if minisign {
+		return checksumsUrl + minisignSigExt
+	}
+	return checksumsUrl + rawSigExt
+}
+
+// siblingUrl returns the url of the file named name in the same directory as the file at fileUrl.
+func siblingUrl(fileUrl string, name string) (string, error) {
+	parsedUrl, err := url.Parse(fileUrl)
+	if err != nil {
+		return "", errors.Wrapf(err, "siblingUrl -- bad url: url=%s err=%v", fileUrl, err)
+	}
+	parsedUrl.Path = path.Join(path.Dir(parsedUrl.Path), name)
+	parsedUrl.RawPath = ""
+	parsedUrl.RawQuery = ""
+	parsedUrl.Fragment = ""
+	return parsedUrl.String(), nil
+}
+
+// publishedSha256 returns the checksum of the release zip published in SHA256SUMS,
+// after having verified the signature of the latter if a public key is pinned.
+func publishedSha256(releaseUrl string, v ReleaseVerification) (string, error) {
+	checksumsUrl, err := v.checksumsUrl(releaseUrl)
+	if err != nil {
+		return "", err
+	}
+	checksums, err := fetchBytes(checksumsUrl)
+	if err != nil {
+		return "", errors.Wrapf(err,
+			"publishedSha256 -- fail to get checksums file: url=%s err=%v", checksumsUrl, err)
+	}
+
+	if publicKey := strings.TrimSpace(v.PublicKey); publicKey != "" {
+		pubKey, err := parsePublicKey(publicKey)
+		if err != nil {
+			return "", err
+		}
+		signatureUrl := v.signatureUrl(checksumsUrl, pubKey.minisign)
+		signature, err := fetchBytes(signatureUrl)
+		if err != nil {
+			return "", errors.Wrapf(err,
+				"publishedSha256 -- fail to get checksums signature: url=%s err=%v", signatureUrl, err)
+		}
+		if err := pubKey.verify(checksums, signature); err != nil {
+			return "", errors.Wrapf(err,
+				"publishedSha256 -- bad checksums signature: checksums-url=%s signature-url=%s err=%v",
+				checksumsUrl, signatureUrl, err)
+		}
+	}
+
+	releaseZipName := path.Base(mustUrlPath(releaseUrl))
+	wantSha256, err := lookupChecksum(checksums, releaseZipName)
+	if err != nil {
+		return "", errors.Wrapf(err, "publishedSha256 -- checksums-url=%s err=%v", checksumsUrl, err)
+	}
+	return wantSha256, nil
+}
+
+func mustUrlPath(rawUrl string) string {
+	parsedUrl, err := url.Parse(rawUrl)
+	if err != nil {
+		return rawUrl
+	}
+	return parsedUrl.Path
+}
+
+// lookupChecksum returns the checksum of the named file from a sha256sum formatted content.
+func lookupChecksum(checksums []byte, name string) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(checksums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		// sha256sum marks binary mode with a leading *
+		if strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	return "", errors.Errorf("lookupChecksum -- no checksum for file: name=%s", name)
+}
+
+type publicKey struct {
+	key      ed25519.PublicKey
+	minisign bool
+	keyId    []byte // minisign key id
+}
+
+// parsePublicKey parses a minisign public key (the base64 line of a minisign .pub file) or a base64 encoded ed25519 key.
+func parsePublicKey(publicKeyStr string) (*publicKey, error) {
+	lines := strings.Split(strings.TrimSpace(publicKeyStr), "\n")
+	keyBytes, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[len(lines)-1]))
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsePublicKey -- public key is not base64 encoded: err=%v", err)
+	}
+	switch {
+	case len(keyBytes) == ed25519.PublicKeySize:
+		return &publicKey{key: keyBytes}, nil
+	case len(keyBytes) == 2+minisignKeyIdLen+ed25519.PublicKeySize && string(keyBytes[:2]) == minisignAlgEd:
+		return &publicKey{
+			key:      keyBytes[2+minisignKeyIdLen:],
+			minisign: true,
+			keyId:    keyBytes[2 : 2+minisignKeyIdLen],
+		}, nil
+	default:
+		return nil, errors.Errorf(
+			"parsePublicKey -- neither a minisign nor an ed25519 public key: decoded-length=%d", len(keyBytes))
+	}
+}
+
+func (pubKey *publicKey) verify(message []byte, signature []byte) error {
+	if !pubKey.minisign {
+		sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+		if err != nil || len(sig) != ed25519.SignatureSize {
+			// the signature may also be the raw bytes
+			sig = signature
+		}
+		if !ed25519.Verify(pubKey.key, message, sig) {
+			return errors.Errorf("publicKey.verify -- ed25519 signature verification failed")
+		}
+		return nil
+	}
+	return pubKey.verifyMinisign(message, signature)
+}
+
+// verifyMinisign verifies a minisign signature file:
+//
+//	untrusted comment: <comment>
+//	base64(<alg:2><key-id:8><signature:64>)
+//	trusted comment: <comment>
+//	base64(<global-signature:64>) -- signature of <signature><trusted-comment>
+func (pubKey *publicKey) verifyMinisign(message []byte, signature []byte) error {
+	lines := strings.Split(strings.ReplaceAll(strings.TrimSpace(string(signature)), "\r\n", "\n"), "\n")
+	if len(lines) < 4 {
+		return errors.Errorf("publicKey.verifyMinisign -- bad minisign signature format: line-count=%d", len(lines))
+	}
+	sigBytes, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[1]))
+	if err != nil || len(sigBytes) != 2+minisignKeyIdLen+ed25519.SignatureSize {
+		return errors.Errorf("publicKey.verifyMinisign -- bad minisign signature line: err=%v", err)
+	}
+	alg, keyId, sig := string(sigBytes[:2]), sigBytes[2:2+minisignKeyIdLen], sigBytes[2+minisignKeyIdLen:]
+	if !bytes.Equal(keyId, pubKey.keyId) {
+		return errors.Errorf(
+			"publicKey.verifyMinisign -- signed with another key: key-id=%X signature-key-id=%X",
+			pubKey.keyId, keyId)
+	}
+
+	signed := message
+	switch alg {
+	case minisignAlgEd:
+	case minisignAlgEdPrehashed:
+		hash := blake2b.Sum512(message)
+		signed = hash[:]
+	default:
+		return errors.Errorf("publicKey.verifyMinisign -- unsupported signature algorithm: alg=%q", alg)
+	}
+	if !ed25519.Verify(pubKey.key, signed, sig) {
+		return errors.Errorf("publicKey.verifyMinisign -- signature verification failed")
+	}
+
+	const trustedCommentPrefix = "trusted comment: "
+	if !strings.HasPrefix(lines[2], trustedCommentPrefix) {
+		return errors.Errorf("publicKey.verifyMinisign -- trusted comment line missing")
+	}
+	trustedComment := strings.TrimPrefix(lines[2], trustedCommentPrefix)
+	globalSig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[3]))
+	if err != nil {
+		return errors.Wrapf(err, "publicKey.verifyMinisign -- bad global signature line: err=%v", err)
+	}
+	if !ed25519.Verify(pubKey.key, append(append([]byte{}, sig...), trustedComment...), globalSig) {
+		return errors.Errorf("publicKey.verifyMinisign -- trusted comment signature verification failed")
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubtools
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/blake2b"
+)
+
+func sha256SumsOf(t *testing.T, files map[string][]byte) []byte {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	sb := strings.Builder{}
+	for _, name := range names {
+		sum := sha256.Sum256(files[name])
+		sb.WriteString(fmt.Sprintf("%s  %s\n", hex.EncodeToString(sum[:]), name))
+	}
+	return []byte(sb.String())
+}
+
+type testMinisignKey struct {
+	keyId []byte
+	pub   ed25519.PublicKey
+	priv  ed25519.PrivateKey
+}
+
+func newTestMinisignKey(t *testing.T) testMinisignKey {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	keyId := make([]byte, minisignKeyIdLen)
+	_, err = rand.Read(keyId)
+	require.NoError(t, err)
+	return testMinisignKey{keyId: keyId, pub: pub, priv: priv}
+}
+
+func (k testMinisignKey) publicKey() string {
+	keyBytes := append(append([]byte(minisignAlgEd), k.keyId...), k.pub...)
+	return "untrusted comment: minisign public key\n" + base64.StdEncoding.EncodeToString(keyBytes)
+}
+
+func (k testMinisignKey) sign(message []byte, alg string) []byte {
+	signed := message
+	if alg == minisignAlgEdPrehashed {
+		hash := blake2b.Sum512(message)
+		signed = hash[:]
+	}
+	sig := ed25519.Sign(k.priv, signed)
+	trustedComment := "timestamp:1696513960\tfile:SHA256SUMS"
+	globalSig := ed25519.Sign(k.priv, append(append([]byte{}, sig...), trustedComment...))
+	return []byte(fmt.Sprintf(
+		"untrusted comment: signature from minisign secret key\n%s\ntrusted comment: %s\n%s\n",
+		base64.StdEncoding.EncodeToString(append(append([]byte(alg), k.keyId...), sig...)),
+		trustedComment,
+		base64.StdEncoding.EncodeToString(globalSig)))
+}
+
+func TestVerifyRelease(t *testing.T) {
+	const zipName = "saya_teaser-20231005T135240_linux_amd64.zip"
+	zipBytes := sayaReleaseZipStub(t)
+	checksums := sha256SumsOf(t, map[string][]byte{zipName: zipBytes, "other.zip": []byte("other")})
+
+	minisignKey := newTestMinisignKey(t)
+	otherMinisignKey := newTestMinisignKey(t)
+	edPub, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	edPubB64 := base64.StdEncoding.EncodeToString(edPub)
+
+	type mirror struct {
+		zip       []byte
+		checksums []byte
+		minisig   []byte
+		sig       []byte
+	}
+	tests := []struct {
+		name         string
+		mirror       mirror
+		verification ReleaseVerification
+		wantErr      string
+	}{
+		{
+			name:   "should-accept-matching-checksum",
+			mirror: mirror{zip: zipBytes, checksums: checksums},
+		},
+		{
+			name:    "should-reject-tampered-release",
+			mirror:  mirror{zip: append(append([]byte{}, zipBytes...), 'x'), checksums: checksums},
+			wantErr: "checksum mismatch",
+		},
+		{
+			name:    "should-reject-release-without-checksum-entry",
+			mirror:  mirror{zip: zipBytes, checksums: sha256SumsOf(t, map[string][]byte{"other.zip": []byte("other")})},
+			wantErr: "no checksum for file",
+		},
+		{
+			name:    "should-reject-missing-checksums-file",
+			mirror:  mirror{zip: zipBytes},
+			wantErr: "fail to get checksums file",
+		},
+		{
+			name:         "should-skip-verification-if-requested",
+			mirror:       mirror{zip: zipBytes},
+			verification: ReleaseVerification{Skip: true},
+		},
+		{
+			name:         "should-accept-good-minisign-signature",
+			mirror:       mirror{zip: zipBytes, checksums: checksums, minisig: minisignKey.sign(checksums, minisignAlgEd)},
+			verification: ReleaseVerification{PublicKey: minisignKey.publicKey()},
+		},
+		{
+			name:         "should-accept-good-prehashed-minisign-signature",
+			mirror:       mirror{zip: zipBytes, checksums: checksums, minisig: minisignKey.sign(checksums, minisignAlgEdPrehashed)},
+			verification: ReleaseVerification{PublicKey: minisignKey.publicKey()},
+		},
+		{
+			name:         "should-reject-minisign-signature-of-other-key",
+			mirror:       mirror{zip: zipBytes, checksums: checksums, minisig: otherMinisignKey.sign(checksums, minisignAlgEd)},
+			verification: ReleaseVerification{PublicKey: minisignKey.publicKey()},
+			wantErr:      "signed with another key",
+		},
+		{
+			name: "should-reject-minisign-signature-of-tampered-checksums",
+			mirror: mirror{
+				zip:       zipBytes,
+				checksums: checksums,
+				minisig:   minisignKey.sign(append(append([]byte{}, checksums...), '\n'), minisignAlgEd),
+			},
+			verification: ReleaseVerification{PublicKey: minisignKey.publicKey()},
+			wantErr:      "signature verification failed",
+		},
+		{
+			name:         "should-reject-missing-signature",
+			mirror:       mirror{zip: zipBytes, checksums: checksums},
+			verification: ReleaseVerification{PublicKey: minisignKey.publicKey()},
+			wantErr:      "fail to get checksums signature",
+		},
+		{
+			name: "should-accept-good-ed25519-signature",
+			mirror: mirror{
+				zip:       zipBytes,
+				checksums: checksums,
+				sig:       []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(edPriv, checksums))),
+			},
+			verification: ReleaseVerification{PublicKey: edPubB64},
+		},
+		{
+			name:         "should-accept-good-raw-ed25519-signature",
+			mirror:       mirror{zip: zipBytes, checksums: checksums, sig: ed25519.Sign(edPriv, checksums)},
+			verification: ReleaseVerification{PublicKey: edPubB64},
+		},
+		{
+			name:         "should-reject-ed25519-signature-of-other-key",
+			mirror:       mirror{zip: zipBytes, checksums: checksums, sig: ed25519.Sign(otherMinisignKey.priv, checksums)},
+			verification: ReleaseVerification{PublicKey: edPubB64},
+			wantErr:      "ed25519 signature verification failed",
+		},
+		{
+			name:         "should-reject-bad-public-key",
+			mirror:       mirror{zip: zipBytes, checksums: checksums},
+			verification: ReleaseVerification{PublicKey: base64.StdEncoding.EncodeToString([]byte("too-short"))},
+			wantErr:      "neither a minisign nor an ed25519 public key",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mirrorDir := t.TempDir()
+			writeIfNotNil := func(name string, content []byte) {
+				if content != nil {
+					require.NoError(t, os.WriteFile(filepath.Join(mirrorDir, name), content, 0600))
+				}
+			}
+			writeIfNotNil(zipName, tt.mirror.zip)
+			writeIfNotNil(checksumsFileName, tt.mirror.checksums)
+			writeIfNotNil(checksumsFileName+minisignSigExt, tt.mirror.minisig)
+			writeIfNotNil(checksumsFileName+rawSigExt, tt.mirror.sig)
+			releaseUrl := "file://" + filepath.ToSlash(filepath.Join(mirrorDir, zipName))
+
+			_, err := fetchRelease(releaseUrl, t.TempDir(), t.TempDir(), tt.verification)
+
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestSiblingUrl(t *testing.T) {
+	got, err := siblingUrl("https://github.com/congop/saya-io/releases/download/r1/saya_linux_amd64.zip?x=1", "SHA256SUMS")
+	require.NoError(t, err)
+	require.Equal(t, "https://github.com/congop/saya-io/releases/download/r1/SHA256SUMS", got)
+}
@@ -0,0 +1,42 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/congop/terraform-provider-saya/internal/saya"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+)
+
+// addErrorDiag adds an error diagnostic for err; saya failures get an actionable summary,
+// the detail starting with the saya error message and what can be done about it.
+func addErrorDiag(diags *diag.Diagnostics, err error) {
+	sayaErr, ok := saya.AsSayaError(err)
+	if !ok {
+		diags.AddError(err.Error(), fmt.Sprintf("%+v", err))
+		return
+	}
+	detail := strings.Builder{}
+	if sayaErr.Message != "" {
+		fmt.Fprintf(&detail, "%s\n\n", sayaErr.Message)
+	}
+	if hint := sayaErr.Hint(); hint != "" {
+		fmt.Fprintf(&detail, "%s\n\n", hint)
+	}
+	fmt.Fprintf(&detail, "%+v", err)
+	diags.AddError(sayaErr.Summary(), detail.String())
+}
@@ -0,0 +1,194 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/congop/terraform-provider-saya/internal/log"
+	"github.com/congop/terraform-provider-saya/internal/saya"
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/datasource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+// Ensure provider defined types fully satisfy framework interfaces.
+var _ datasource.DataSource = &HostDataSource{}
+
+func NewHostDataSource() datasource.DataSource {
+	return &HostDataSource{}
+}
+
+// HostDataSource reports whether the host is ready to run saya.
+type HostDataSource struct {
+	sayaExeCtx *SayaExecutionCtx
+}
+
+// HostDataSourceModel describes the data source data model.
+type HostDataSourceModel struct {
+	Id            types.String `tfsdk:"id"`
+	Exe           types.String `tfsdk:"exe"`
+	ExePath       types.String `tfsdk:"exe_path"`
+	ExeFound      types.Bool   `tfsdk:"exe_found"`
+	ExeExecutable types.Bool   `tfsdk:"exe_executable"`
+	Forge         types.String `tfsdk:"forge"`
+	ForgeExists   types.Bool   `tfsdk:"forge_exists"`
+	ForgeWritable types.Bool   `tfsdk:"forge_writable"`
+	ComputeTypes  types.List   `tfsdk:"compute_types"`
+	KvmAvailable  types.Bool   `tfsdk:"kvm_available"`
+	Platform      types.String `tfsdk:"platform"`
+	Problems      types.List   `tfsdk:"problems"`
+}
+
+func (d *HostDataSource) Metadata(ctx context.Context, req datasource.MetadataRequest, resp *datasource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_host"
+}
+
+func (d *HostDataSource) Schema(ctx context.Context, req datasource.SchemaRequest, resp *datasource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		MarkdownDescription: "Diagnostics of the host running saya: saya executable, forge, compute types, kvm and platform; not supported with a remote provider `host`",
+
+		Attributes: map[string]schema.Attribute{
+			"id": schema.StringAttribute{
+				Computed:            true,
+				MarkdownDescription: "host platform, used as identifier",
+			},
+			"exe": schema.StringAttribute{
+				Computed:            true,
+				MarkdownDescription: "saya exe command or path, as configured",
+			},
+			"exe_path": schema.StringAttribute{
+				Computed:            true,
+				MarkdownDescription: "resolved path of the saya exe; blank if not found",
+			},
+			"exe_found": schema.BoolAttribute{
+				Computed:            true,
+				MarkdownDescription: "true if the saya exe has been found",
+			},
+			"exe_executable": schema.BoolAttribute{
+				Computed:            true,
+				MarkdownDescription: "true if the saya exe is executable",
+			},
+			"forge": schema.StringAttribute{
+				Computed:            true,
+				MarkdownDescription: "forge location, as configured; blank for the saya default",
+			},
+			"forge_exists": schema.BoolAttribute{
+				Computed:            true,
+				MarkdownDescription: "true if the forge directory exists; null if the forge is not configured",
+			},
+			"forge_writable": schema.BoolAttribute{
+				Computed:            true,
+				MarkdownDescription: "true if the forge directory is writable; null if the forge is not configured",
+			},
+			"compute_types": schema.ListAttribute{
+				ElementType:         types.StringType,
+				Computed:            true,
+				MarkdownDescription: "installed compute types, e.g. qemu, virtualbox",
+			},
+			"kvm_available": schema.BoolAttribute{
+				Computed:            true,
+				MarkdownDescription: "true if kvm can be used for qemu hardware acceleration",
+			},
+			"platform": schema.StringAttribute{
+				Computed:            true,
+				MarkdownDescription: "host platform, e.g. linux/amd64",
+			},
+			"problems": schema.ListAttribute{
+				ElementType:         types.StringType,
+				Computed:            true,
+				MarkdownDescription: "problems found on the host, also reported as warnings",
+			},
+		},
+	}
+}
+
+func (d *HostDataSource) Configure(ctx context.Context, req datasource.ConfigureRequest, resp *datasource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+
+	sayaExeCtx, ok := req.ProviderData.(SayaExecutionCtx)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"HostDataSource.Configure -- unexpected provider data type",
+			fmt.Sprintf(
+				"HostDataSource.Configure -- unexpected provider data type: expected=%T got=%T",
+				SayaExecutionCtx{}, req.ProviderData))
+		return
+	}
+	d.sayaExeCtx = &sayaExeCtx
+}
+
+func (d *HostDataSource) Read(ctx context.Context, req datasource.ReadRequest, resp *datasource.ReadResponse) {
+	reqSayaCtx := d.sayaExeCtx.ToRequestSayaCtx()
+	if reqSayaCtx.IsRemote() {
+		// reporting the machine running terraform would describe the wrong host
+		resp.Diagnostics.AddError("saya_host not supported with a remote host",
+			fmt.Sprintf("saya runs over ssh on %s, but only the machine running terraform can be inspected", reqSayaCtx.Host.Address))
+		return
+	}
+	info := saya.InspectHost(ctx, reqSayaCtx)
+
+	data, diags := hostDataSourceModelFrom(ctx, info)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	// the data source is for diagnostics, problems must not fail the read
+	for _, problem := range info.Problems {
+		resp.Diagnostics.AddWarning(problem.Summary, problem.Detail)
+	}
+
+	log.Tracef(ctx, "HostDataSource.Read -- host inspected: info=%#v", info)
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func hostDataSourceModelFrom(ctx context.Context, info saya.HostInfo) (HostDataSourceModel, diag.Diagnostics) {
+	var diags diag.Diagnostics
+	computeTypes, d := types.ListValueFrom(ctx, types.StringType, nonNilStrings(info.ComputeTypes))
+	diags.Append(d...)
+	problems := make([]string, 0, len(info.Problems))
+	for _, problem := range info.Problems {
+		problems = append(problems, problem.String())
+	}
+	problemList, d := types.ListValueFrom(ctx, types.StringType, problems)
+	diags.Append(d...)
+
+	return HostDataSourceModel{
+		Id:            types.StringValue(info.Platform.PlatformStr()),
+		Exe:           types.StringValue(info.Exe),
+		ExePath:       types.StringValue(info.ExePath),
+		ExeFound:      types.BoolValue(info.ExeFound),
+		ExeExecutable: types.BoolValue(info.ExeExecutable),
+		Forge:         types.StringValue(info.Forge),
+		ForgeExists:   types.BoolPointerValue(info.ForgeExists),
+		ForgeWritable: types.BoolPointerValue(info.ForgeWritable),
+		ComputeTypes:  computeTypes,
+		KvmAvailable:  types.BoolValue(info.KvmAvailable),
+		Platform:      types.StringValue(info.Platform.PlatformStr()),
+		Problems:      problemList,
+	}, diags
+}
+
+func nonNilStrings(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
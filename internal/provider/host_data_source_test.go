@@ -0,0 +1,71 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/congop/terraform-provider-saya/internal/saya"
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHostDataSourceModelFrom(t *testing.T) {
+	ctx := context.Background()
+	info := saya.HostInfo{
+		Exe:          "saya",
+		Platform:     saya.Platform{Os: "linux", Arch: "arm64"},
+		ComputeTypes: nil,
+		Problems: []saya.HostProblem{
+			{Severity: saya.HostProblemError, Summary: "saya executable not found", Detail: "no saya in PATH"},
+		},
+	}
+
+	data, diags := hostDataSourceModelFrom(ctx, info)
+
+	require.False(t, diags.HasError(), "diags=%v", diags)
+	require.Equal(t, "linux/arm64", data.Platform.ValueString())
+	require.False(t, data.ExeFound.ValueBool())
+	require.True(t, data.ForgeExists.IsNull(), "unconfigured forge must not be reported as missing")
+	require.True(t, data.ForgeWritable.IsNull())
+	require.False(t, data.ComputeTypes.IsNull())
+	require.Empty(t, data.ComputeTypes.Elements())
+	problems := []string{}
+	require.False(t, data.Problems.ElementsAs(ctx, &problems, false).HasError())
+	require.Equal(t, []string{"error: saya executable not found -- no saya in PATH"}, problems)
+}
+
+func TestHostDataSourceReadRejectsRemoteHost(t *testing.T) {
+	ctx := context.Background()
+	d := &HostDataSource{sayaExeCtx: &SayaExecutionCtx{
+		SayaExe: "saya",
+		Host:    &saya.SshHost{Address: "192.168.56.10:22", User: "tester"},
+	}}
+	schemaResp := datasource.SchemaResponse{}
+	d.Schema(ctx, datasource.SchemaRequest{}, &schemaResp)
+	resp := datasource.ReadResponse{State: tfsdk.State{
+		Schema: schemaResp.Schema,
+		Raw:    tftypes.NewValue(schemaResp.Schema.Type().TerraformType(ctx), nil),
+	}}
+
+	d.Read(ctx, datasource.ReadRequest{}, &resp)
+
+	require.True(t, resp.Diagnostics.HasError(), "diags=%v", resp.Diagnostics)
+	require.Equal(t, "saya_host not supported with a remote host", resp.Diagnostics.Errors()[0].Summary())
+	require.True(t, resp.State.Raw.IsNull(), "the local host must not be reported")
+}
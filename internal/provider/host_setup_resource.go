@@ -0,0 +1,271 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"os/user"
+	"strings"
+
+	"github.com/congop/terraform-provider-saya/internal/log"
+	"github.com/congop/terraform-provider-saya/internal/saya"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringdefault"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"golang.org/x/exp/slices"
+)
+
+// Ensure provider defined types fully satisfy framework interfaces.
+var _ resource.Resource = &HostSetupResource{}
+
+func NewHostSetupResource() resource.Resource {
+	return &HostSetupResource{}
+}
+
+// HostSetupResource installs compute backends (e.g. qemu, virtualbox) by running saya setup.
+type HostSetupResource struct {
+	sayaExeCtx *SayaExecutionCtx
+}
+
+// HostSetupResourceModel describes the resource data model.
+type HostSetupResourceModel struct {
+	Id                    types.String `tfsdk:"id"`
+	ComputeTypes          types.Set    `tfsdk:"compute_types"`
+	TargetUser            types.String `tfsdk:"target_user"`
+	Target                types.String `tfsdk:"target"`
+	TargetComputeType     types.String `tfsdk:"target_compute_type"`
+	Escalation            types.String `tfsdk:"escalation"`
+	InstalledComputeTypes types.List   `tfsdk:"installed_compute_types"`
+}
+
+func (r *HostSetupResource) Metadata(ctx context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_host_setup"
+}
+
+func (r *HostSetupResource) Schema(ctx context.Context, req resource.SchemaRequest, resp *resource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		MarkdownDescription: "Install compute backends (e.g. qemu, virtualbox) on a host for a user by running `saya setup`. " +
+			"Deleting the resource does not uninstall anything.",
+
+		Attributes: map[string]schema.Attribute{
+			"id": schema.StringAttribute{
+				Computed:            true,
+				MarkdownDescription: "setup identifier, <target>/<target-user>",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"compute_types": schema.SetAttribute{
+				ElementType:         types.StringType,
+				Required:            true,
+				MarkdownDescription: "compute types to install, e.g. qemu, virtualbox",
+			},
+			"target_user": schema.StringAttribute{
+				Optional:            true,
+				Computed:            true,
+				MarkdownDescription: "user the compute types are set up for; defaults to the ssh user of the provider host or else the user running terraform",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"target": schema.StringAttribute{
+				Optional:            true,
+				Computed:            true,
+				Default:             stringdefault.StaticString(saya.SetupTargetLocalhost),
+				MarkdownDescription: "host to set up; defaults to localhost, the only target whose installation can be read back if saya is not run over ssh",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"target_compute_type": schema.StringAttribute{
+				Optional:            true,
+				Computed:            true,
+				Default:             stringdefault.StaticString(saya.SetupTargetLocalhost),
+				MarkdownDescription: "compute type of the host to set up; defaults to localhost",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"escalation": schema.StringAttribute{
+				Optional:            true,
+				Computed:            true,
+				Default:             stringdefault.StaticString(saya.EscalationSudoIfNotRoot),
+				MarkdownDescription: "privilege escalation of saya setup: sudo, sudo-if-not-root or none; sudo must not prompt for a password",
+			},
+			"installed_compute_types": schema.ListAttribute{
+				ElementType:         types.StringType,
+				Computed:            true,
+				MarkdownDescription: "compute types found installed on the host; only known for localhost",
+			},
+		},
+	}
+}
+
+func (r *HostSetupResource) Configure(ctx context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+
+	sayaExeCtx, ok := req.ProviderData.(SayaExecutionCtx)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"unexpected provider data type",
+			fmt.Sprintf(
+				"unexpected provider data type: expected=%T got=%T",
+				SayaExecutionCtx{}, req.ProviderData))
+		return
+	}
+	r.sayaExeCtx = &sayaExeCtx
+}
+
+func (r *HostSetupResource) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var data *HostSetupResourceModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if strings.TrimSpace(data.TargetUser.ValueString()) == "" && r.sayaExeCtx.Host != nil {
+		data.TargetUser = types.StringValue(strings.TrimSpace(r.sayaExeCtx.Host.User))
+	}
+	if strings.TrimSpace(data.TargetUser.ValueString()) == "" {
+		currentUser, err := user.Current()
+		if err != nil {
+			resp.Diagnostics.AddError("fail to get the current user as default target user", fmt.Sprintf("%+v", err))
+			return
+		}
+		data.TargetUser = types.StringValue(currentUser.Username)
+	}
+	data.Id = types.StringValue(data.Target.ValueString() + "/" + data.TargetUser.ValueString())
+
+	r.setup(ctx, data, &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *HostSetupResource) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var data *HostSetupResourceModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if !r.canReadBack(data) {
+		// nothing can be read back from remote targets
+		return
+	}
+	info := saya.InspectHost(ctx, r.sayaExeCtx.ToRequestSayaCtx())
+
+	// compute types gone missing drop out of the state, so that the next plan installs them again
+	wanted := []string{}
+	resp.Diagnostics.Append(data.ComputeTypes.ElementsAs(ctx, &wanted, false)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	stillInstalled := make([]string, 0, len(wanted))
+	for _, ct := range wanted {
+		if slices.Contains(info.ComputeTypes, ct) {
+			stillInstalled = append(stillInstalled, ct)
+		}
+	}
+	computeTypes, diags := types.SetValueFrom(ctx, types.StringType, stillInstalled)
+	resp.Diagnostics.Append(diags...)
+	data.InstalledComputeTypes = installedComputeTypesValue(ctx, info.ComputeTypes, &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	data.ComputeTypes = computeTypes
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *HostSetupResource) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	var data *HostSetupResourceModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	// saya setup is idempotent, already installed compute types are left as they are
+	r.setup(ctx, data, &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *HostSetupResource) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+	var data *HostSetupResourceModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	// saya setup has no uninstall; compute backends may be in use by vms not managed by terraform
+	log.Debugf(ctx, "HostSetupResource.Delete -- removed from state, nothing uninstalled: id=%s", data.Id.ValueString())
+}
+
+func (r *HostSetupResource) setup(ctx context.Context, data *HostSetupResourceModel, diagnostics *diag.Diagnostics) {
+	wanted := []string{}
+	diagnostics.Append(data.ComputeTypes.ElementsAs(ctx, &wanted, false)...)
+	if diagnostics.HasError() {
+		return
+	}
+	slices.Sort(wanted)
+
+	setupRes, err := saya.Setup(ctx, saya.SetupRequest{
+		ComputeType:      data.TargetComputeType.ValueString(),
+		Target:           data.Target.ValueString(),
+		WantComputeTypes: wanted,
+		TargetUser:       data.TargetUser.ValueString(),
+		Escalation:       data.Escalation.ValueString(),
+		RequestSayaCtx:   r.sayaExeCtx.ToRequestSayaCtx(),
+	})
+	if err != nil {
+		addErrorDiag(diagnostics, err)
+		return
+	}
+
+	if r.canReadBack(data) {
+		for _, ct := range wanted {
+			if !slices.Contains(setupRes.ComputeTypes, ct) {
+				diagnostics.AddError("compute type not installed after setup",
+					fmt.Sprintf("saya setup succeeded but the compute type cannot be found: compute-type=%s installed=%q",
+						ct, setupRes.ComputeTypes))
+			}
+		}
+	}
+	data.InstalledComputeTypes = installedComputeTypesValue(ctx, setupRes.ComputeTypes, diagnostics)
+}
+
+// canReadBack returns true if the installed compute types can be inspected, i.e. the provider runs on the target.
+func (r *HostSetupResource) canReadBack(data *HostSetupResourceModel) bool {
+	return data.Target.ValueString() == saya.SetupTargetLocalhost && !r.sayaExeCtx.ToRequestSayaCtx().IsRemote()
+}
+
+func installedComputeTypesValue(ctx context.Context, computeTypes []string, diagnostics *diag.Diagnostics) types.List {
+	installed, diags := types.ListValueFrom(ctx, types.StringType, nonNilStrings(computeTypes))
+	diagnostics.Append(diags...)
+	return installed
+}
@@ -0,0 +1,191 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/congop/terraform-provider-saya/internal/saya"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	fwresource "github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/stretchr/testify/require"
+)
+
+// hostSetupFixture runs saya setup through an executor, whose installations are fake qemu executables
+// in the PATH saya runs with.
+type hostSetupFixture struct {
+	binDir  string
+	argvs   []string
+	install bool // true if saya setup installs qemu
+}
+
+func givenHostSetupFixture(t *testing.T) *hostSetupFixture {
+	if runtime.GOOS != "linux" {
+		t.Skip("compute types are inspected on linux hosts")
+	}
+	return &hostSetupFixture{binDir: t.TempDir(), install: true}
+}
+
+func (f *hostSetupFixture) givenQemuInstalled(t *testing.T) {
+	qemuArch := map[string]string{"amd64": "x86_64", "arm64": "aarch64", "386": "i386"}[runtime.GOARCH]
+	if qemuArch == "" {
+		qemuArch = runtime.GOARCH
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(f.binDir, "qemu-system-"+qemuArch), nil, 0700))
+}
+
+func (f *hostSetupFixture) resource(t *testing.T, host *saya.SshHost) *HostSetupResource {
+	return &HostSetupResource{sayaExeCtx: &SayaExecutionCtx{
+		SayaExe: "saya",
+		Host:    host,
+		Env:     &saya.ExecEnv{Vars: map[string]string{"PATH": f.binDir}},
+		Executor: saya.ExecutorFunc(func(ctx context.Context, req saya.ExecRequest) (saya.ExecResult, error) {
+			f.argvs = append(f.argvs, strings.Join(req.Argv, " "))
+			if f.install {
+				f.givenQemuInstalled(t)
+			}
+			return saya.ExecResult{}, nil
+		}),
+	}}
+}
+
+func hostSetupModel(t *testing.T, target string, computeTypes ...string) *HostSetupResourceModel {
+	computeTypesSet, diags := types.SetValueFrom(context.Background(), types.StringType, computeTypes)
+	require.False(t, diags.HasError(), "diags=%v", diags)
+	installed, diags := types.ListValueFrom(context.Background(), types.StringType, []string{})
+	require.False(t, diags.HasError(), "diags=%v", diags)
+	return &HostSetupResourceModel{
+		Id:                    types.StringValue(target + "/tester"),
+		ComputeTypes:          computeTypesSet,
+		TargetUser:            types.StringValue("tester"),
+		Target:                types.StringValue(target),
+		TargetComputeType:     types.StringValue(saya.SetupTargetLocalhost),
+		Escalation:            types.StringValue(saya.EscalationNone),
+		InstalledComputeTypes: installed,
+	}
+}
+
+// stringElements returns the elements of a string set or list.
+func stringElements(t *testing.T, v interface {
+	ElementsAs(ctx context.Context, target interface{}, allowUnhandled bool) diag.Diagnostics
+}) []string {
+	elements := []string{}
+	diags := v.ElementsAs(context.Background(), &elements, false)
+	require.False(t, diags.HasError(), "diags=%v", diags)
+	return elements
+}
+
+func TestHostSetupResourceCreate(t *testing.T) {
+	tests := []struct {
+		name          string
+		target        string
+		host          *saya.SshHost
+		install       bool
+		wantErr       string
+		wantInstalled []string
+	}{
+		{
+			name: "should-read-installed-compute-types-back", target: saya.SetupTargetLocalhost, install: true,
+			wantInstalled: []string{saya.ComputeTypeQemu},
+		},
+		{
+			name: "should-fail-if-compute-type-missing-after-setup", target: saya.SetupTargetLocalhost,
+			wantErr: "compute type not installed after setup",
+		},
+		{
+			name: "should-not-read-remote-target-back", target: "192.168.56.10",
+			wantInstalled: []string{},
+		},
+		{
+			name: "should-not-read-back-over-ssh", target: saya.SetupTargetLocalhost,
+			host:          &saya.SshHost{Address: "192.168.56.10:22", User: "tester"},
+			wantInstalled: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			fixture := givenHostSetupFixture(t)
+			fixture.install = tt.install
+			r := fixture.resource(t, tt.host)
+
+			resp := fwresource.CreateResponse{State: testState(t, r)}
+			r.Create(ctx, fwresource.CreateRequest{Plan: testPlan(t, r, hostSetupModel(t, tt.target, saya.ComputeTypeQemu))}, &resp)
+
+			require.Len(t, fixture.argvs, 1)
+			require.Contains(t, fixture.argvs[0], "saya setup --compute-type localhost --target "+tt.target+
+				" --want-compute-type qemu --target-user tester")
+			if tt.wantErr != "" {
+				require.True(t, resp.Diagnostics.HasError())
+				require.Equal(t, tt.wantErr, resp.Diagnostics.Errors()[0].Summary())
+				return
+			}
+			require.False(t, resp.Diagnostics.HasError(), "diags=%v", resp.Diagnostics)
+			data := HostSetupResourceModel{}
+			require.False(t, resp.State.Get(ctx, &data).HasError())
+			require.Equal(t, tt.target+"/tester", data.Id.ValueString())
+			require.Equal(t, tt.wantInstalled, stringElements(t, data.InstalledComputeTypes))
+		})
+	}
+}
+
+func TestHostSetupResourceRead(t *testing.T) {
+	tests := []struct {
+		name             string
+		target           string
+		host             *saya.SshHost
+		wantComputeTypes []string
+		wantInstalled    []string
+	}{
+		{
+			name: "should-drop-compute-type-gone-missing", target: saya.SetupTargetLocalhost,
+			wantComputeTypes: []string{saya.ComputeTypeQemu}, wantInstalled: []string{saya.ComputeTypeQemu},
+		},
+		{
+			name: "should-keep-state-of-remote-target", target: "192.168.56.10",
+			wantComputeTypes: []string{saya.ComputeTypeQemu, saya.ComputeTypeVirtualbox}, wantInstalled: []string{},
+		},
+		{
+			name: "should-keep-state-over-ssh", target: saya.SetupTargetLocalhost,
+			host:             &saya.SshHost{Address: "192.168.56.10:22", User: "tester"},
+			wantComputeTypes: []string{saya.ComputeTypeQemu, saya.ComputeTypeVirtualbox}, wantInstalled: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			fixture := givenHostSetupFixture(t)
+			fixture.givenQemuInstalled(t)
+			r := fixture.resource(t, tt.host)
+			state := testStateOf(t, r, hostSetupModel(t, tt.target, saya.ComputeTypeQemu, saya.ComputeTypeVirtualbox))
+
+			resp := fwresource.ReadResponse{State: state}
+			r.Read(ctx, fwresource.ReadRequest{State: state}, &resp)
+
+			require.False(t, resp.Diagnostics.HasError(), "diags=%v", resp.Diagnostics)
+			require.Empty(t, fixture.argvs, "reading must not run saya setup")
+			data := HostSetupResourceModel{}
+			require.False(t, resp.State.Get(ctx, &data).HasError())
+			require.ElementsMatch(t, tt.wantComputeTypes, stringElements(t, data.ComputeTypes))
+			require.Equal(t, tt.wantInstalled, stringElements(t, data.InstalledComputeTypes))
+		})
+	}
+}
@@ -139,9 +139,9 @@ func (d *ImageDataSource) Read(ctx context.Context, req datasource.ReadRequest,
 		RequestSayaCtx: d.sayaExeCtx.ToRequestSayaCtx(),
 	}
 
-	switch lsResList, err := saya.Ls(ctx, lsReq); {
+	switch lsResList, err := d.sayaExeCtx.SayaClient().Ls(ctx, lsReq); {
 	case err != nil:
-		resp.Diagnostics.AddError(err.Error(), fmt.Sprintf("%+v", err))
+		addErrorDiag(&resp.Diagnostics, err)
 		return
 	case len(lsResList) == 1:
 		lsRes := lsResList[0]
@@ -159,11 +159,7 @@ func (r *ImageResource) Create(ctx context.Context, req resource.CreateRequest,
 		Hash:     data.Hash.ValueString(),
 		RepoType: data.RepoType.ValueString(),
 
-		Exe:        r.sayaExeCtx.SayaExe,
-		Config:     r.sayaExeCtx.Config,
-		Forge:      r.sayaExeCtx.Forge,
-		LicenseKey: r.sayaExeCtx.LicenseKey,
-		LogLevel:   r.sayaExeCtx.LogLevel,
+		RequestSayaCtx: r.sayaExeCtx.ToRequestSayaCtx(),
 	}
 
 	switch repoType := data.RepoType.ValueString(); {
@@ -190,9 +186,9 @@ func (r *ImageResource) Create(ctx context.Context, req resource.CreateRequest,
 
 	}
 
-	pullRes, err := saya.Pull(ctx, pullReq)
+	pullRes, err := r.sayaExeCtx.SayaClient().Pull(ctx, pullReq)
 	if err != nil {
-		resp.Diagnostics.AddError(err.Error(), fmt.Sprintf("%+v", err))
+		addErrorDiag(&resp.Diagnostics, err)
 		return
 	}
 	platformStr := pullRes.Platform.PlatformStr()
@@ -227,16 +223,12 @@ func pullImgAndUpdateData(
 		RepoType: data.RepoType.ValueString(),
 		HttpRepo: httpRepoSaya.NormalizeToNil(),
 
-		Exe:        r.sayaExeCtx.SayaExe,
-		Config:     r.sayaExeCtx.Config,
-		Forge:      r.sayaExeCtx.Forge,
-		LicenseKey: r.sayaExeCtx.LicenseKey,
-		LogLevel:   r.sayaExeCtx.LogLevel,
+		RequestSayaCtx: r.sayaExeCtx.ToRequestSayaCtx(),
 	}
 
-	pullRes, err := saya.Pull(ctx, pullReq)
+	pullRes, err := r.sayaExeCtx.SayaClient().Pull(ctx, pullReq)
 	if err != nil {
-		diags.AddError(err.Error(), fmt.Sprintf("%+v", err))
+		addErrorDiag(diags, err)
 		return
 	}
 	platformStr := pullRes.Platform.PlatformStr()
@@ -283,9 +275,9 @@ func (r *ImageResource) Read(ctx context.Context, req resource.ReadRequest, resp
 		lsReq.Platform = id.P.PlatformStr()
 	}
 
-	switch lsResList, err := saya.Ls(ctx, lsReq); {
+	switch lsResList, err := r.sayaExeCtx.SayaClient().Ls(ctx, lsReq); {
 	case err != nil:
-		resp.Diagnostics.AddError(err.Error(), fmt.Sprintf("%+v", err))
+		addErrorDiag(&resp.Diagnostics, err)
 		return
 	case len(lsResList) == 1:
 		lsRes := lsResList[0]
@@ -307,12 +299,9 @@ func (r *ImageResource) Read(ctx context.Context, req resource.ReadRequest, resp
 			data.RepoType = types.StringValue(lsRes.SrcType)
 		}
 	case len(lsResList) == 0:
-		resp.Diagnostics.AddError(
-			"ImageResource -- No image found in the forge",
-			fmt.Sprintf(
-				"ImageResource -- No image found in the forge(local image store):"+
-					" request-data=%#v",
-				lsReq))
+		// removed outside of terraform, e.g. with saya image rm; the next plan pulls it again
+		log.Infof(ctx, "ImageResource.Read -- image not found in the forge, removing it from state: id=%s", idStr)
+		resp.State.RemoveResource(ctx)
 		return
 	default:
 		lsResListStr := slices.MapMust(lsResList, saya.LsResult.PlatformNameVersionTypeTaglike)
@@ -361,8 +350,8 @@ func (r *ImageResource) Delete(ctx context.Context, req resource.DeleteRequest,
 		RequestSayaCtx: r.sayaExeCtx.ToRequestSayaCtx(),
 	}
 
-	if err := saya.ImageRm(ctx, delReq); err != nil {
-		resp.Diagnostics.AddError(err.Error(), fmt.Sprintf("%+v", err))
+	if err := r.sayaExeCtx.SayaClient().ImageRm(ctx, delReq); err != nil {
+		addErrorDiag(&resp.Diagnostics, err)
 		return
 	}
 }
@@ -388,9 +377,9 @@ func (r *ImageResource) ImportState(ctx context.Context, req resource.ImportStat
 		RequestSayaCtx: r.sayaExeCtx.ToRequestSayaCtx(),
 	}
 
-	switch lsResList, err := saya.Ls(ctx, lsReq); {
+	switch lsResList, err := r.sayaExeCtx.SayaClient().Ls(ctx, lsReq); {
 	case err != nil:
-		resp.Diagnostics.AddError(err.Error(), fmt.Sprintf("%+v", err))
+		addErrorDiag(&resp.Diagnostics, err)
 		return
 	case len(lsResList) == 1:
 		lsRes := lsResList[0]
@@ -16,11 +16,15 @@ package provider
 
 import (
 	"bytes"
+	"context"
 	"os"
 	"testing"
 	"text/template"
 
+	"github.com/congop/terraform-provider-saya/internal/saya"
 	repos "github.com/congop/terraform-provider-saya/internal/stubrepo"
+	fwresource "github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/types"
 	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
 	"github.com/stretchr/testify/require"
 )
@@ -141,8 +145,8 @@ func testProvider(t *testing.T, imgInRepo *repos.ImgInRepo, forge string) string
 		    {{ $Creds := .Repos.S3.AuthAwsCreds }}
 			credentials = {
 				access_key_id = "{{ $Creds.AccessKeyID }}"
-				secret_access_key  = "{{ $Creds.SecretAccessKey }}"
-				session_token  = "{{ $Creds.SessionToken }}"
+				secret_access_key  = "{{ $Creds.SecretAccessKey.Value }}"
+				session_token  = "{{ $Creds.SessionToken.Value }}"
 				source  = "{{ $Creds.Source}}"
 				CanExpire =  "{{ $Creds.CanExpire }}"
 				{{- if  $Creds.HasExpires }}
@@ -199,3 +203,84 @@ resource "saya_image" "readtest" {
 }
 `
 }
+
+func TestImageResourceWithInMemoryClient(t *testing.T) {
+	ctx := context.Background()
+	webserverV1 := saya.LsResult{
+		Name: "webserver", Version: "v1", Sha256: "sha-v1", Type: "ova",
+		Platform: saya.PlatformSw{Platform: saya.Platform{Os: "linux", Arch: "amd64"}, OsVariant: "alpine"},
+	}
+	client := saya.NewInMemorySayaClient(webserverV1)
+	exeCtx := &SayaExecutionCtx{SayaExe: "saya", Client: client}
+	exeCtx.setHttpRepo(&saya.HttpRepo{RepoUrl: "http://localhost:10099"})
+	r := &ImageResource{sayaExeCtx: exeCtx}
+
+	createResp := fwresource.CreateResponse{State: testState(t, r)}
+	r.Create(ctx, fwresource.CreateRequest{Plan: testPlan(t, r, &ImageResourceModel{
+		Name:     types.StringValue("webserver:v1"),
+		ImgType:  types.StringValue("ova"),
+		Platform: types.StringValue("linux/amd64"),
+		Id:       types.StringUnknown(),
+		Sha256:   types.StringUnknown(),
+	})}, &createResp)
+	require.False(t, createResp.Diagnostics.HasError(), "diags=%v", createResp.Diagnostics)
+	created := ImageResourceModel{}
+	require.False(t, createResp.State.Get(ctx, &created).HasError())
+	require.Equal(t, "linux/amd64:webserver:v1:ova", created.Id.ValueString())
+	require.Equal(t, "sha-v1", created.Sha256.ValueString())
+
+	// drift: the image has been re-pulled out of band with different content
+	driftedImg := webserverV1
+	driftedImg.Sha256 = "sha-v1-rebuilt"
+	driftedImg.SrcType = saya.RepoTypeHttp
+	client.AddToForge(driftedImg)
+	readResp := fwresource.ReadResponse{State: createResp.State}
+	r.Read(ctx, fwresource.ReadRequest{State: createResp.State}, &readResp)
+	require.False(t, readResp.Diagnostics.HasError(), "diags=%v", readResp.Diagnostics)
+	read := ImageResourceModel{}
+	require.False(t, readResp.State.Get(ctx, &read).HasError())
+	require.Equal(t, "sha-v1-rebuilt", read.Sha256.ValueString())
+
+	importResp := fwresource.ImportStateResponse{State: testState(t, r)}
+	r.ImportState(ctx, fwresource.ImportStateRequest{ID: created.Id.ValueString()}, &importResp)
+	require.False(t, importResp.Diagnostics.HasError(), "diags=%v", importResp.Diagnostics)
+	imported := ImageResourceModel{}
+	require.False(t, importResp.State.Get(ctx, &imported).HasError())
+	require.Equal(t, "webserver:v1", imported.Name.ValueString())
+	require.Equal(t, saya.RepoTypeHttp, imported.RepoType.ValueString())
+
+	deleteResp := fwresource.DeleteResponse{State: readResp.State}
+	r.Delete(ctx, fwresource.DeleteRequest{State: readResp.State}, &deleteResp)
+	require.False(t, deleteResp.Diagnostics.HasError(), "diags=%v", deleteResp.Diagnostics)
+	images, err := client.Ls(ctx, saya.LsRequest{})
+	require.NoError(t, err)
+	require.Empty(t, images)
+
+	goneResp := fwresource.ReadResponse{State: readResp.State}
+	r.Read(ctx, fwresource.ReadRequest{State: readResp.State}, &goneResp)
+	require.False(t, goneResp.Diagnostics.HasError(), "diags=%v", goneResp.Diagnostics)
+	require.True(t, goneResp.State.Raw.IsNull(), "image gone from the forge must be removed from state")
+
+	// saya failures are not classified, so that deleting an image already gone from the forge is reported
+	deleteResp = fwresource.DeleteResponse{State: readResp.State}
+	r.Delete(ctx, fwresource.DeleteRequest{State: readResp.State}, &deleteResp)
+	require.True(t, deleteResp.Diagnostics.HasError())
+	require.Equal(t, "saya image rm failed", deleteResp.Diagnostics.Errors()[0].Summary())
+}
+
+func TestImageResourceCreateReportsPullFailure(t *testing.T) {
+	exeCtx := &SayaExecutionCtx{SayaExe: "saya", Client: saya.NewInMemorySayaClient()}
+	exeCtx.setHttpRepo(&saya.HttpRepo{RepoUrl: "http://localhost:10099"})
+	r := &ImageResource{sayaExeCtx: exeCtx}
+
+	createResp := fwresource.CreateResponse{State: testState(t, r)}
+	r.Create(context.Background(), fwresource.CreateRequest{Plan: testPlan(t, r, &ImageResourceModel{
+		Name:   types.StringValue("webserver:v1"),
+		Id:     types.StringUnknown(),
+		Sha256: types.StringUnknown(),
+	})}, &createResp)
+
+	require.True(t, createResp.Diagnostics.HasError())
+	require.Equal(t, "saya image pull failed", createResp.Diagnostics.Errors()[0].Summary())
+	require.Contains(t, createResp.Diagnostics.Errors()[0].Detail(), "image not found in repository")
+}
@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/congop/terraform-provider-saya/githubtools"
 	"github.com/congop/terraform-provider-saya/internal/log"
 	"github.com/congop/terraform-provider-saya/internal/opaque"
 	"github.com/congop/terraform-provider-saya/internal/saya"
@@ -27,6 +28,7 @@ import (
 	"github.com/hashicorp/terraform-plugin-framework/provider"
 	"github.com/hashicorp/terraform-plugin-framework/provider/schema"
 	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/types"
 	"github.com/hashicorp/terraform-plugin-framework/types/basetypes"
 	"github.com/hashicorp/terraform-plugin-log/tfsdklog"
 )
@@ -50,6 +52,13 @@ type SayaExecutionCtx struct {
 	Forge      string        // forge(local image store+ work directory, etc.) path
 	LicenseKey opaque.String // License key
 	LogLevel   string
+	Env        *saya.ExecEnv   // environment of the saya process; nil to inherit the provider environment
+	Host       *saya.SshHost   // host saya is run on over ssh; nil to run saya locally
+	Executor   saya.Executor   // runs saya command lines; nil for a local process, or ssh if Host is set
+	Client     saya.SayaClient // manages images and vms; nil to execute saya commands
+
+	SecretsAsArgs bool              // true to pass secrets as command line args instead of environment variables
+	Version       *saya.SayaVersion // version of the saya executable, detected at configure time
 
 	repos *saya.Repos
 }
@@ -64,9 +73,22 @@ func (exeCtx *SayaExecutionCtx) ToRequestSayaCtx() saya.RequestSayaCtx {
 		Forge:      exeCtx.Forge,
 		LicenseKey: exeCtx.LicenseKey,
 		LogLevel:   exeCtx.LogLevel,
+		Env:        exeCtx.Env,
+		Host:       exeCtx.Host,
+		Executor:   exeCtx.Executor,
+
+		SecretsAsArgs: exeCtx.SecretsAsArgs,
 	}
 }
 
+// SayaClient returns the client managing images and vms, by default executing saya commands.
+func (exeCtx *SayaExecutionCtx) SayaClient() saya.SayaClient {
+	if exeCtx == nil || exeCtx.Client == nil {
+		return saya.CmdSayaClient{}
+	}
+	return exeCtx.Client
+}
+
 func (exeCtx *SayaExecutionCtx) setHttpRepo(httpRepo *saya.HttpRepo) {
 	if httpRepo == nil {
 		return
@@ -114,17 +136,114 @@ func (p *SayaProvider) Schema(ctx context.Context, req provider.SchemaRequest, r
 				Optional:            true,
 			},
 			"exe": schema.StringAttribute{
-				MarkdownDescription: "saya exe command or path; defaults to saya",
+				MarkdownDescription: "saya exe command or path; defaults to saya, or to the binary installed according to `saya_version`, `download_url` and `install_dir`",
 				Optional:            true,
 			},
+			"saya_version": schema.StringAttribute{
+				MarkdownDescription: "name of the saya release to install when `exe` is not set, e.g. saya_teaser-20231005T135240; " +
+					"defaults to the latest release",
+				Optional: true,
+			},
+			"install_dir": schema.StringAttribute{
+				MarkdownDescription: "directory where the installed saya binaries are cached; " +
+					"defaults to <user-cache-dir>/terraform-provider-saya/bin",
+				Optional: true,
+			},
+			"download_url": schema.StringAttribute{
+				MarkdownDescription: "url (http, https or file) of the saya release zip to install; " +
+					"defaults to `SAYA_RELEASE_URL`, then to the github release",
+				Optional: true,
+			},
+			"download_sha256": schema.StringAttribute{
+				MarkdownDescription: "expected sha256 hex digest of the saya release zip; " +
+					"if not set, the release zip is verified against the `SHA256SUMS` file published next to it",
+				Optional: true,
+			},
+			"download_public_key": schema.StringAttribute{
+				MarkdownDescription: "pinned minisign or base64 encoded ed25519 public key used to verify the signature " +
+					"(`SHA256SUMS.minisig` or `SHA256SUMS.sig`) of the published `SHA256SUMS` file",
+				Optional: true,
+			},
 			"forge": schema.StringAttribute{
 				MarkdownDescription: "forge location",
 				Optional:            true,
 			},
 			"license_key": schema.StringAttribute{
-				MarkdownDescription: "license key value or file",
+				MarkdownDescription: "license key value or file; conflicts with `license_key_file` and `license_key_env`. " +
+					"Saya documents no license key format, so the key is only validated by saya when used",
+				Optional:  true,
+				Sensitive: true,
+			},
+			"license_key_file": schema.StringAttribute{
+				MarkdownDescription: "path of the file containing the license key",
+				Optional:            true,
+			},
+			"license_key_env": schema.StringAttribute{
+				MarkdownDescription: "name of the environment variable containing the license key",
+				Optional:            true,
+			},
+			"environment": schema.MapAttribute{
+				ElementType:         types.StringType,
+				MarkdownDescription: "additional environment variables of the saya process",
+				Optional:            true,
+			},
+			"http_proxy": schema.StringAttribute{
+				MarkdownDescription: "proxy used by saya for http requests; sets `HTTP_PROXY` and `http_proxy`",
+				Optional:            true,
+			},
+			"https_proxy": schema.StringAttribute{
+				MarkdownDescription: "proxy used by saya for https requests; sets `HTTPS_PROXY` and `https_proxy`",
+				Optional:            true,
+			},
+			"no_proxy": schema.StringAttribute{
+				MarkdownDescription: "comma separated hosts not to be proxied, e.g. a local s3 gateway; sets `NO_PROXY` and `no_proxy`",
 				Optional:            true,
-				Sensitive:           true,
+			},
+			"secrets_as_args": schema.BoolAttribute{
+				MarkdownDescription: "true to pass secrets (license key, passwords, secret keys) as command line args, visible in the process list, " +
+					"instead of `SAYA_` environment variables; only for old saya versions not reading secrets from the environment",
+				Optional: true,
+			},
+			"minimal_environment": schema.BoolAttribute{
+				MarkdownDescription: "true to run saya with a minimal environment, only inheriting allow-listed variables " +
+					"(e.g. `PATH`, `HOME`, `TMPDIR`) from the provider environment",
+				Optional: true,
+			},
+			"host": schema.SingleNestedAttribute{
+				MarkdownDescription: "remote host saya is run on over ssh instead of the machine running terraform; " +
+					"paths (`exe`, `config`, `forge`, repository certificates) then refer to the remote host",
+				Attributes: map[string]schema.Attribute{
+					"address": schema.StringAttribute{
+						Description: "address of the ssh server, host[:port]; the port defaults to 22",
+						Required:    true,
+					},
+					"user": schema.StringAttribute{
+						Description: "the ssh user",
+						Required:    true,
+					},
+					"private_key": schema.StringAttribute{
+						Description: "PEM encoded private key of the user; conflicts with private_key_file",
+						Optional:    true,
+						Sensitive:   true,
+					},
+					"private_key_file": schema.StringAttribute{
+						Description: "path of the PEM encoded private key of the user",
+						Optional:    true,
+					},
+					"known_hosts": schema.StringAttribute{
+						Description: "known_hosts formatted keys of the host; conflicts with known_hosts_file",
+						Optional:    true,
+					},
+					"known_hosts_file": schema.StringAttribute{
+						Description: "path of the known_hosts file used to verify the host key; defaults to ~/.ssh/known_hosts",
+						Optional:    true,
+					},
+					"tmp_dir": schema.StringAttribute{
+						Description: "directory on the host where saya writes its result files; defaults to /tmp",
+						Optional:    true,
+					},
+				},
+				Optional: true,
 			},
 			"http_repo": schema.SingleNestedAttribute{
 				Attributes: map[string]schema.Attribute{
@@ -199,7 +318,7 @@ func (p *SayaProvider) Schema(ctx context.Context, req provider.SchemaRequest, r
 								Description: "the source of the credential",
 								Optional:    true,
 							},
-							"can_expire": schema.StringAttribute{
+							"can_expire": schema.BoolAttribute{
 								Description: "if the credential can expire",
 								Optional:    true,
 							},
@@ -207,6 +326,72 @@ func (p *SayaProvider) Schema(ctx context.Context, req provider.SchemaRequest, r
 								Description: "the time the credential will expire",
 								Optional:    true,
 							},
+							"profile": schema.StringAttribute{
+								Description: "the profile of the shared config/credentials files to use",
+								Optional:    true,
+							},
+							"shared_config_files": schema.ListAttribute{
+								ElementType: types.StringType,
+								Description: "the shared config files to use instead of the default ~/.aws/config",
+								Optional:    true,
+							},
+							"shared_credentials_files": schema.ListAttribute{
+								ElementType: types.StringType,
+								Description: "the shared credentials files to use instead of the default ~/.aws/credentials",
+								Optional:    true,
+							},
+							"assume_role": schema.SingleNestedAttribute{
+								Description: "the role to assume on top of the resolved credentials",
+								Attributes: map[string]schema.Attribute{
+									"role_arn": schema.StringAttribute{
+										Description: "the arn of the role to assume",
+										Required:    true,
+									},
+									"external_id": schema.StringAttribute{
+										Description: "the external id required by the role trust policy",
+										Optional:    true,
+									},
+									"session_name": schema.StringAttribute{
+										Description: "the name of the role session",
+										Optional:    true,
+									},
+									"duration": schema.StringAttribute{
+										Description: "the duration of the role session, e.g. 1h",
+										Optional:    true,
+									},
+								},
+								Optional: true,
+							},
+							"web_identity": schema.SingleNestedAttribute{
+								Description: "the role to assume using a web identity token",
+								Attributes: map[string]schema.Attribute{
+									"role_arn": schema.StringAttribute{
+										Description: "the arn of the role to assume",
+										Required:    true,
+									},
+									"token_file": schema.StringAttribute{
+										Description: "the path of the file containing the web identity token",
+										Required:    true,
+									},
+									"session_name": schema.StringAttribute{
+										Description: "the name of the role session",
+										Optional:    true,
+									},
+								},
+								Optional: true,
+							},
+							"ec2_metadata_endpoint": schema.StringAttribute{
+								Description: "the endpoint of the EC2 instance metadata service",
+								Optional:    true,
+							},
+							"container_credentials_endpoint": schema.StringAttribute{
+								Description: "the full uri of the container (ECS) credentials endpoint",
+								Optional:    true,
+							},
+							"sts_endpoint": schema.StringAttribute{
+								Description: "the endpoint of the sts service used to assume roles",
+								Optional:    true,
+							},
 						},
 						Optional: true,
 					},
@@ -227,17 +412,113 @@ func (p *SayaProvider) Configure(ctx context.Context, req provider.ConfigureRequ
 	}
 
 	exeCtx := SayaExecutionCtx{
-		SayaExe:    strings.TrimSpace(data.Exe.ValueString()),
-		Config:     strings.TrimSpace(data.Config.ValueString()),
-		Forge:      strings.TrimSpace(data.Forge.ValueString()),
-		LicenseKey: *opaque.NewString(strings.TrimSpace(data.LicenseKey.ValueString())),
-		LogLevel:   p.logLevel,
+		SayaExe:  strings.TrimSpace(data.Exe.ValueString()),
+		Config:   strings.TrimSpace(data.Config.ValueString()),
+		Forge:    strings.TrimSpace(data.Forge.ValueString()),
+		LogLevel: p.logLevel,
+
+		SecretsAsArgs: data.SecretsAsArgs.ValueBool(),
+	}
+
+	// the environment applies to all saya executions, including the version detection and the preflight below
+	environment := map[string]string{}
+	if !(data.Environment.IsNull() || data.Environment.IsUnknown()) {
+		resp.Diagnostics.Append(data.Environment.ElementsAs(ctx, &environment, false)...)
+		if resp.Diagnostics.HasError() {
+			return
+		}
+	}
+	exeCtx.Env = (&saya.ExecEnv{
+		Vars:       environment,
+		HttpProxy:  data.HttpProxy.ValueString(),
+		HttpsProxy: data.HttpsProxy.ValueString(),
+		NoProxy:    data.NoProxy.ValueString(),
+		Minimal:    data.MinimalEnvironment.ValueBool(),
+	}).NormalizeToNil()
+
+	// opts to avoid <<Received null value, however the target type cannot handle null values.>>
+	if !(data.Host.IsNull() || data.Host.IsUnknown()) {
+		hostTf := &SayaProviderModelHost{}
+		diagsMapping := data.Host.As(ctx, hostTf, basetypes.ObjectAsOptions{UnhandledNullAsEmpty: true, UnhandledUnknownAsEmpty: true})
+		if diagsMapping.HasError() {
+			resp.Diagnostics.Append(diagsMapping...)
+			return
+		}
+		host := (&saya.SshHost{
+			Address:        hostTf.Address,
+			User:           hostTf.User,
+			PrivateKey:     *opaque.NewString(hostTf.PrivateKey),
+			PrivateKeyFile: hostTf.PrivateKeyFile,
+			KnownHosts:     hostTf.KnownHosts,
+			KnownHostsFile: hostTf.KnownHostsFile,
+			TmpDir:         hostTf.TmpDir,
+		}).NormalizeToNil()
+		if err := host.Validate(); err != nil {
+			resp.Diagnostics.AddError(err.Error(), fmt.Sprintf("%+v", err))
+			return
+		}
+		exeCtx.Host = host
 	}
 
+	if exeCtx.Host != nil && data.WantsSayaInstall() {
+		// the installation is local, a local binary cannot be run on the remote host
+		resp.Diagnostics.AddError("saya installation not supported with a remote host",
+			"saya_version, install_dir and download_* install saya locally; set exe to the saya path on the remote host instead")
+		return
+	}
+	if exeCtx.SayaExe == "" && data.WantsSayaInstall() {
+		sayaExe, err := githubtools.InstallSayaBinary(githubtools.InstallOptions{
+			ReleaseName: data.SayaVersion.ValueString(),
+			DownloadUrl: data.DownloadUrl.ValueString(),
+			Sha256:      data.DownloadSha256.ValueString(),
+			InstallDir:  data.InstallDir.ValueString(),
+			Verification: githubtools.ReleaseVerification{
+				PublicKey: data.DownloadPubKey.ValueString(),
+			},
+		})
+		if err != nil {
+			resp.Diagnostics.AddError("fail to install saya", fmt.Sprintf("%+v", err))
+			return
+		}
+		exeCtx.SayaExe = sayaExe
+	}
 	if exeCtx.SayaExe == "" {
 		exeCtx.SayaExe = "saya"
 	}
 
+	// precise diagnostics instead of an opaque failure of the first saya execution;
+	// a remote host cannot be inspected, there the version detection below is the only check
+	if exeCtx.Host == nil {
+		hostInfo := saya.InspectHost(ctx, exeCtx.ToRequestSayaCtx())
+		for _, problem := range hostInfo.Problems {
+			if problem.Severity == saya.HostProblemError {
+				resp.Diagnostics.AddError(problem.Summary, problem.Detail)
+			} else {
+				log.Warnf(ctx, "Configure -- preflight: %s", problem)
+			}
+		}
+		if resp.Diagnostics.HasError() {
+			return
+		}
+	}
+
+	licenseKey, err := data.ResolveLicenseKey()
+	if err != nil {
+		resp.Diagnostics.AddError(err.Error(), fmt.Sprintf("%+v", err))
+		return
+	}
+	// neither the format nor an expiry of the license key is checked: saya documents no license key format
+	exeCtx.LicenseKey = licenseKey
+
+	// an unusable saya executable fails at configure time instead of deep inside an apply
+	sayaVersion, err := saya.Version(ctx, exeCtx.ToRequestSayaCtx())
+	if err != nil {
+		resp.Diagnostics.AddError("fail to detect the saya version", fmt.Sprintf("%+v", err))
+		return
+	}
+	log.Debugf(ctx, "Configure -- saya version detected: version=%s", sayaVersion)
+	exeCtx.Version = sayaVersion
+
 	// opts to avoid <<Received null value, however the target type cannot handle null values.>>
 	if !(data.HttpRepo.IsNull() || data.HttpRepo.IsUnknown()) {
 		httpRepoTf := &SayaProviderModelHttpRepo{}
@@ -252,7 +533,7 @@ func (p *SayaProvider) Configure(ctx context.Context, req provider.ConfigureRequ
 			UploadStrategy: httpRepoTf.UploadStrategy,
 			AuthHttpBasic: saya.AuthHttpBasic{
 				Username: httpRepoTf.AuthHttpBasic.Username,
-				Pwd:      httpRepoTf.AuthHttpBasic.Pwd,
+				Pwd:      *opaque.NewString(httpRepoTf.AuthHttpBasic.Pwd),
 			},
 		}
 
@@ -282,8 +563,24 @@ func (p *SayaProvider) Configure(ctx context.Context, req provider.ConfigureRequ
 			return
 		}
 		s3RepoSaya.AuthAwsCreds = sayaCred
+		credsChain, err := credTf.AsSayaCredChain()
+		if err != nil {
+			resp.Diagnostics.AddError(err.Error(), fmt.Sprintf("%+v", err))
+			return
+		}
+		s3RepoSaya.CredsChain = credsChain
 
-		exeCtx.setS3Repo(s3RepoSaya.NormalizeToNil())
+		s3RepoSayaNormalized := s3RepoSaya.NormalizeToNil()
+		if s3RepoSayaNormalized != nil && credsChain != nil {
+			// credentials resolved through the aws chain get refreshed before each saya invocation
+			credsProvider, err := saya.NewAwsCredentialsProvider(ctx, s3RepoSaya.Region, sayaCred, credsChain)
+			if err != nil {
+				resp.Diagnostics.AddError(err.Error(), fmt.Sprintf("%+v", err))
+				return
+			}
+			s3RepoSayaNormalized.WithCredentialsProvider(credsProvider)
+		}
+		exeCtx.setS3Repo(s3RepoSayaNormalized)
 	}
 
 	resp.DataSourceData = exeCtx
@@ -294,12 +591,14 @@ func (p *SayaProvider) Resources(ctx context.Context) []func() resource.Resource
 	return []func() resource.Resource{
 		NewImageResource,
 		NewVmResource,
+		NewHostSetupResource,
 	}
 }
 
 func (p *SayaProvider) DataSources(ctx context.Context) []func() datasource.DataSource {
 	return []func() datasource.DataSource{
 		NewExampleDataSource,
+		NewHostDataSource,
 	}
 }
 
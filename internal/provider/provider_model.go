@@ -1,9 +1,12 @@
 package provider
 
 import (
+	"os"
 	"strings"
+	"time"
 
-	"github.com/aws/smithy-go/time"
+	smithytime "github.com/aws/smithy-go/time"
+	"github.com/congop/terraform-provider-saya/internal/opaque"
 	"github.com/congop/terraform-provider-saya/internal/saya"
 	"github.com/hashicorp/terraform-plugin-framework/types"
 	"github.com/pkg/errors"
@@ -17,8 +20,86 @@ type SayaProviderModel struct {
 	Forge      types.String `tfsdk:"forge"`
 	LicenseKey types.String `tfsdk:"license_key"`
 
+	SayaVersion    types.String `tfsdk:"saya_version"`
+	InstallDir     types.String `tfsdk:"install_dir"`
+	DownloadUrl    types.String `tfsdk:"download_url"`
+	DownloadSha256 types.String `tfsdk:"download_sha256"`
+	DownloadPubKey types.String `tfsdk:"download_public_key"`
+
+	LicenseKeyFile types.String `tfsdk:"license_key_file"`
+	LicenseKeyEnv  types.String `tfsdk:"license_key_env"`
+
+	Environment        types.Map    `tfsdk:"environment"`
+	HttpProxy          types.String `tfsdk:"http_proxy"`
+	HttpsProxy         types.String `tfsdk:"https_proxy"`
+	NoProxy            types.String `tfsdk:"no_proxy"`
+	MinimalEnvironment types.Bool   `tfsdk:"minimal_environment"`
+	SecretsAsArgs      types.Bool   `tfsdk:"secrets_as_args"`
+
 	HttpRepo types.Object `tfsdk:"http_repo"`
 	S3Repo   types.Object `tfsdk:"s3_repo"`
+	Host     types.Object `tfsdk:"host"`
+}
+
+// WantsSayaInstall returns true if a saya installation setting is specified.
+func (data *SayaProviderModel) WantsSayaInstall() bool {
+	for _, v := range []types.String{data.SayaVersion, data.InstallDir, data.DownloadUrl, data.DownloadSha256, data.DownloadPubKey} {
+		if strings.TrimSpace(v.ValueString()) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveLicenseKey returns the license key specified by value, file or environment variable.
+// At most one of them may be specified. The value is forwarded as is, saya deciding how to interpret it.
+func (data *SayaProviderModel) ResolveLicenseKey() (opaque.String, error) {
+	lkVal := strings.TrimSpace(data.LicenseKey.ValueString())
+	lkFile := strings.TrimSpace(data.LicenseKeyFile.ValueString())
+	lkEnv := strings.TrimSpace(data.LicenseKeyEnv.ValueString())
+
+	specifiedCount := 0
+	for _, v := range []string{lkVal, lkFile, lkEnv} {
+		if v != "" {
+			specifiedCount++
+		}
+	}
+	if specifiedCount > 1 {
+		return opaque.String{}, errors.Errorf(
+			"SayaProviderModel.ResolveLicenseKey -- at most one of license_key, license_key_file, license_key_env allowed: "+
+				"license_key=%v license_key_file=%q license_key_env=%q",
+			*opaque.NewString(lkVal), lkFile, lkEnv)
+	}
+
+	switch {
+	case lkVal != "":
+		return *opaque.NewString(lkVal), nil
+	case lkFile != "":
+		lkBytes, err := os.ReadFile(lkFile)
+		if err != nil {
+			return opaque.String{}, errors.Wrapf(err,
+				"SayaProviderModel.ResolveLicenseKey -- fail to read license key file: path=%s err=%v",
+				lkFile, err)
+		}
+		lk := *opaque.NewString(string(lkBytes))
+		lk.Normalize()
+		if lk.Value() == "" {
+			return opaque.String{}, errors.Errorf(
+				"SayaProviderModel.ResolveLicenseKey -- license key file is empty: path=%s", lkFile)
+		}
+		return lk, nil
+	case lkEnv != "":
+		lk := *opaque.NewString(os.Getenv(lkEnv))
+		lk.Normalize()
+		if lk.Value() == "" {
+			return opaque.String{}, errors.Errorf(
+				"SayaProviderModel.ResolveLicenseKey -- license key environment variable not set or blank: name=%s",
+				lkEnv)
+		}
+		return lk, nil
+	default:
+		return opaque.String{}, nil
+	}
 }
 
 type SayaProviderModelHttpAuthBasic struct {
@@ -26,6 +107,16 @@ type SayaProviderModelHttpAuthBasic struct {
 	Pwd      string `tfsdk:"password"`
 }
 
+type SayaProviderModelHost struct {
+	Address        string `tfsdk:"address"`
+	User           string `tfsdk:"user"`
+	PrivateKey     string `tfsdk:"private_key"`
+	PrivateKeyFile string `tfsdk:"private_key_file"`
+	KnownHosts     string `tfsdk:"known_hosts"`
+	KnownHostsFile string `tfsdk:"known_hosts_file"`
+	TmpDir         string `tfsdk:"tmp_dir"`
+}
+
 type SayaProviderModelHttpRepo struct {
 	RepoUrl        string                         `tfsdk:"url"`
 	BasePath       string                         `tfsdk:"base_path"`
@@ -40,6 +131,77 @@ type SayaProviderModelS3RepoCred struct {
 	Source          string `tfsdk:"source"`
 	CanExpire       bool   `tfsdk:"can_expire"`
 	Expires         string `tfsdk:"expires"`
+
+	Profile                      string                              `tfsdk:"profile"`
+	SharedConfigFiles            []string                            `tfsdk:"shared_config_files"`
+	SharedCredentialsFiles       []string                            `tfsdk:"shared_credentials_files"`
+	AssumeRole                   *SayaProviderModelS3RepoAssumeRole  `tfsdk:"assume_role"`
+	WebIdentity                  *SayaProviderModelS3RepoWebIdentity `tfsdk:"web_identity"`
+	Ec2MetadataEndpoint          string                              `tfsdk:"ec2_metadata_endpoint"`
+	ContainerCredentialsEndpoint string                              `tfsdk:"container_credentials_endpoint"`
+	StsEndpoint                  string                              `tfsdk:"sts_endpoint"`
+}
+
+type SayaProviderModelS3RepoAssumeRole struct {
+	RoleArn     string `tfsdk:"role_arn"`
+	ExternalId  string `tfsdk:"external_id"`
+	SessionName string `tfsdk:"session_name"`
+	Duration    string `tfsdk:"duration"`
+}
+
+type SayaProviderModelS3RepoWebIdentity struct {
+	RoleArn     string `tfsdk:"role_arn"`
+	TokenFile   string `tfsdk:"token_file"`
+	SessionName string `tfsdk:"session_name"`
+}
+
+// AsSayaCredChain returns the credential chain settings, or nil if the static keys are to be used as is.
+func (credTf *SayaProviderModelS3RepoCred) AsSayaCredChain() (*saya.AwsCredentialChain, error) {
+	if credTf == nil {
+		return nil, nil
+	}
+	chain := saya.AwsCredentialChain{
+		Profile:                      credTf.Profile,
+		SharedConfigFiles:            credTf.SharedConfigFiles,
+		SharedCredentialsFiles:       credTf.SharedCredentialsFiles,
+		Ec2MetadataEndpoint:          credTf.Ec2MetadataEndpoint,
+		ContainerCredentialsEndpoint: credTf.ContainerCredentialsEndpoint,
+		StsEndpoint:                  credTf.StsEndpoint,
+	}
+	if roleTf := credTf.AssumeRole; roleTf != nil {
+		role := saya.AwsAssumeRole{
+			RoleArn:     roleTf.RoleArn,
+			ExternalId:  roleTf.ExternalId,
+			SessionName: roleTf.SessionName,
+		}
+		if durationTf := strings.TrimSpace(roleTf.Duration); durationTf != "" {
+			duration, err := time.ParseDuration(durationTf)
+			if err != nil {
+				return nil, errors.Wrapf(err,
+					"SayaProviderModelS3RepoCred.AsSayaCredChain -- bad duration format for assume_role.duration"+
+						"\n\texpected-format: go duration, e.g. 1h or 15m"+
+						"\n\tvalue-string=%s \n\tparse-issue=%s",
+					durationTf, err.Error())
+			}
+			role.Duration = duration
+		}
+		chain.AssumeRole = &role
+	}
+	if webIdTf := credTf.WebIdentity; webIdTf != nil {
+		chain.WebIdentity = &saya.AwsWebIdentity{
+			RoleArn:     webIdTf.RoleArn,
+			TokenFile:   webIdTf.TokenFile,
+			SessionName: webIdTf.SessionName,
+		}
+	}
+
+	chainNormalized := chain.NormalizeToNil()
+	hasStaticKeys := strings.TrimSpace(credTf.AccessKeyID) != ""
+	if hasStaticKeys && chainNormalized.AssumeRole == nil {
+		// static keys are handed over to saya as they are
+		return nil, nil
+	}
+	return chainNormalized, nil
 }
 
 func (credTf *SayaProviderModelS3RepoCred) AsSayaCred() (*saya.AwsCredentials, error) {
@@ -48,15 +210,15 @@ func (credTf *SayaProviderModelS3RepoCred) AsSayaCred() (*saya.AwsCredentials, e
 	}
 	sayaCred := saya.AwsCredentials{
 		AccessKeyID:     credTf.AccessKeyID,
-		SecretAccessKey: credTf.SecretAccessKey,
-		SessionToken:    credTf.SessionToken,
+		SecretAccessKey: *opaque.NewString(credTf.SecretAccessKey),
+		SessionToken:    *opaque.NewString(credTf.SessionToken),
 		Source:          credTf.Source,
 		CanExpire:       credTf.CanExpire,
 		Expires:         nil,
 	}
 
 	if expiresTf := strings.TrimSpace(credTf.Expires); expiresTf != "" {
-		expires, err := time.ParseDateTime(expiresTf)
+		expires, err := smithytime.ParseDateTime(expiresTf)
 		if err != nil {
 			return nil, errors.Wrapf(err,
 				"ImageResourceModelS3RepoCred.AsSayaCred -- bad date time format for expires"+
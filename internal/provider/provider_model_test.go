@@ -0,0 +1,66 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSayaProviderModelResolveLicenseKey(t *testing.T) {
+	dir := t.TempDir()
+	lkFile := filepath.Join(dir, "license.key")
+	require.NoError(t, os.WriteFile(lkFile, []byte(" lk-from-file\n"), 0600))
+	emptyFile := filepath.Join(dir, "empty.key")
+	require.NoError(t, os.WriteFile(emptyFile, []byte("\n"), 0600))
+	t.Setenv("SAYA_TEST_LICENSE_KEY", "lk-from-env")
+
+	tests := []struct {
+		name    string
+		data    SayaProviderModel
+		want    string
+		wantErr bool
+	}{
+		{name: "should-resolve-nothing", data: SayaProviderModel{}, want: ""},
+		{name: "should-resolve-value", data: SayaProviderModel{LicenseKey: types.StringValue(" lk-value ")}, want: "lk-value"},
+		{name: "should-forward-value-as-is", data: SayaProviderModel{LicenseKey: types.StringValue(lkFile)}, want: lkFile},
+		{name: "should-resolve-file", data: SayaProviderModel{LicenseKeyFile: types.StringValue(lkFile)}, want: "lk-from-file"},
+		{name: "should-resolve-env", data: SayaProviderModel{LicenseKeyEnv: types.StringValue("SAYA_TEST_LICENSE_KEY")}, want: "lk-from-env"},
+		{
+			name:    "should-reject-several-sources",
+			data:    SayaProviderModel{LicenseKey: types.StringValue("lk"), LicenseKeyEnv: types.StringValue("SAYA_TEST_LICENSE_KEY")},
+			wantErr: true,
+		},
+		{name: "should-reject-missing-file", data: SayaProviderModel{LicenseKeyFile: types.StringValue(filepath.Join(dir, "none"))}, wantErr: true},
+		{name: "should-reject-empty-file", data: SayaProviderModel{LicenseKeyFile: types.StringValue(emptyFile)}, wantErr: true},
+		{name: "should-reject-unset-env", data: SayaProviderModel{LicenseKeyEnv: types.StringValue("SAYA_TEST_LICENSE_KEY_UNSET")}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.data.ResolveLicenseKey()
+			if tt.wantErr {
+				require.Error(t, err)
+				require.NotContains(t, err.Error(), "lk-from")
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got.Value())
+		})
+	}
+}
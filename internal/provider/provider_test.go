@@ -15,10 +15,18 @@
 package provider
 
 import (
+	"context"
+	"fmt"
+	"os"
 	"testing"
 
 	"github.com/hashicorp/terraform-plugin-framework/providerserver"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
 	"github.com/hashicorp/terraform-plugin-go/tfprotov6"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
+	"github.com/stretchr/testify/require"
 )
 
 // testAccProtoV6ProviderFactories are used to instantiate a provider during
@@ -29,8 +37,47 @@ var testAccProtoV6ProviderFactories = map[string]func() (tfprotov6.ProviderServe
 	"saya": providerserver.NewProtocol6WithError(New("0.0.1", "info")()),
 }
 
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if err := removeFakeSayaExe(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	os.Exit(code)
+}
+
 func testAccPreCheck(t *testing.T) {
 	// You can add code here to run prior to any test case execution, for example assertions
 	// about the appropriate environment variables being set are common to see in a pre-check
 	// function.
 }
+
+// testResourceSchema returns the schema of the resource.
+func testResourceSchema(t *testing.T, r resource.Resource) schema.Schema {
+	resp := resource.SchemaResponse{}
+	r.Schema(context.Background(), resource.SchemaRequest{}, &resp)
+	require.False(t, resp.Diagnostics.HasError(), "diags=%v", resp.Diagnostics)
+	return resp.Schema
+}
+
+// testPlan returns a plan of the resource holding the model.
+func testPlan(t *testing.T, r resource.Resource, model any) tfsdk.Plan {
+	sch := testResourceSchema(t, r)
+	plan := tfsdk.Plan{Schema: sch, Raw: tftypes.NewValue(sch.Type().TerraformType(context.Background()), nil)}
+	diags := plan.Set(context.Background(), model)
+	require.False(t, diags.HasError(), "diags=%v", diags)
+	return plan
+}
+
+// testState returns an empty state of the resource.
+func testState(t *testing.T, r resource.Resource) tfsdk.State {
+	sch := testResourceSchema(t, r)
+	return tfsdk.State{Schema: sch, Raw: tftypes.NewValue(sch.Type().TerraformType(context.Background()), nil)}
+}
+
+// testStateOf returns a state of the resource holding the model.
+func testStateOf(t *testing.T, r resource.Resource, model any) tfsdk.State {
+	state := testState(t, r)
+	diags := state.Set(context.Background(), model)
+	require.False(t, diags.HasError(), "diags=%v", diags)
+	return state
+}
@@ -17,12 +17,15 @@ package provider
 import (
 	"os"
 	"os/exec"
+	"path/filepath"
+	"sync"
 	"testing"
 
 	"github.com/congop/terraform-provider-saya/internal/log"
 	"github.com/congop/terraform-provider-saya/internal/opaque"
 	"github.com/congop/terraform-provider-saya/internal/saya"
 	repos "github.com/congop/terraform-provider-saya/internal/stubrepo"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
 )
 
@@ -34,12 +37,51 @@ func sayaExe(t *testing.T) string {
 			return sayaInPath
 		}
 
-		// this is my owner local setup
-		return "../../../vmbuilder/saya/saya"
+		// no saya available, running tests with the fake saya cli which does not need virtualization
+		return fakeSayaExe(t)
 	}
 	return sayaExe
 }
 
+var (
+	fakeSayaBuild    sync.Once
+	fakeSayaBuildDir string
+	fakeSayaBuildExe string
+	fakeSayaBuildErr error
+)
+
+// fakeSayaExe builds cmd/fake-saya once per test run and returns the path of the executable.
+// The executable is removed by removeFakeSayaExe at the end of the test run.
+func fakeSayaExe(t *testing.T) string {
+	fakeSayaBuild.Do(func() {
+		dir, err := os.MkdirTemp("", "fake-saya")
+		if err != nil {
+			fakeSayaBuildErr = err
+			return
+		}
+		fakeSayaBuildDir = dir
+		exe := filepath.Join(dir, "fake-saya")
+		if out, err := exec.Command("go", "build", "-o", exe, "../../cmd/fake-saya").CombinedOutput(); err != nil {
+			fakeSayaBuildErr = errors.Wrapf(err, "fail to build fake-saya: out=%s err=%v", out, err)
+			return
+		}
+		fakeSayaBuildExe = exe
+	})
+	require.NoError(t, fakeSayaBuildErr, "fake saya must be available if saya is not")
+	return fakeSayaBuildExe
+}
+
+// removeFakeSayaExe removes the directory of the fake-saya executable, if it has been built.
+func removeFakeSayaExe() error {
+	if fakeSayaBuildDir == "" {
+		return nil
+	}
+	if err := os.RemoveAll(fakeSayaBuildDir); err != nil {
+		return errors.Wrapf(err, "removeFakeSayaExe -- fail to remove fake-saya dir: dir=%s err=%v", fakeSayaBuildDir, err)
+	}
+	return nil
+}
+
 // givenUbuntuVxOvaLinuxArmInForge ensures an image with the given specification is in the local db.
 // Note that a http repository is started and closed. But the corresponding http repo data are set.
 func givenUbuntuVxOvaLinuxArmInForge(
@@ -71,8 +113,10 @@ func givenUbuntuVxOvaLinuxArmInForge(
 		Hash:     "",
 		RepoType: "http",
 		HttpRepo: httpRepo.AsRepos().Http,
-		Exe:      sayaExe,
-		Forge:    forge,
+		RequestSayaCtx: saya.RequestSayaCtx{
+			Exe:   sayaExe,
+			Forge: forge,
+		},
 	}
 	_, err = saya.Pull(repos.StubLogCtx(), pullReq)
 	require.NoErrorf(t, err, "fail to pull image into forge")
@@ -113,17 +157,19 @@ func givenImageIsInForgeByPullingFn(
 		imgId, err := saya.ParseImgId(imgIdStr)
 		require.NoErrorf(t, err, "failed to parse image-id: imgId=%s", imgIdStr)
 		req := saya.PullRequest{
-			Name:       imgId.R.Normalized(),
-			ImgType:    imgId.ImgType,
-			Platform:   imgId.P.PlatformStr(),
-			Hash:       "",
-			RepoType:   "http",
-			HttpRepo:   remoteRepos.Http.AsRepos().Http,
-			Exe:        sayaExe,
-			Forge:      forge,
-			Config:     "",
-			LicenseKey: *opaque.NewString(""),
-			LogLevel:   "debug",
+			Name:     imgId.R.Normalized(),
+			ImgType:  imgId.ImgType,
+			Platform: imgId.P.PlatformStr(),
+			Hash:     "",
+			RepoType: "http",
+			HttpRepo: remoteRepos.Http.AsRepos().Http,
+			RequestSayaCtx: saya.RequestSayaCtx{
+				Exe:        sayaExe,
+				Forge:      forge,
+				Config:     "",
+				LicenseKey: *opaque.NewString(""),
+				LogLevel:   "debug",
+			},
 		}
 		t.Logf("in-http repo = %v", remoteRepos.Http.RepoContent())
 
@@ -155,14 +155,14 @@ func (r *VmResource) Create(ctx context.Context, req resource.CreateRequest, res
 		RequestSayaCtx: r.sayaExeCtx.ToRequestSayaCtx(),
 	}
 
-	pullRes, err := saya.VmRun(ctx, pullReq)
+	pullRes, err := r.sayaExeCtx.SayaClient().VmRun(ctx, pullReq)
 	if err != nil {
 		if pullRes != nil && pullRes.Id != "" {
-			if err := deleteVm("VmResource.Create-CleanupOnVmRunFailed", ctx, pullRes.Id, r.sayaExeCtx.ToRequestSayaCtx()); err != nil {
+			if err := deleteVm("VmResource.Create-CleanupOnVmRunFailed", ctx, pullRes.Id, r.sayaExeCtx.SayaClient(), r.sayaExeCtx.ToRequestSayaCtx()); err != nil {
 				log.Warnf(ctx, "%+v", err)
 			}
 		}
-		resp.Diagnostics.AddError(err.Error(), fmt.Sprintf("%+v", err))
+		addErrorDiag(&resp.Diagnostics, err)
 		return
 	}
 
@@ -180,15 +180,15 @@ func (r *VmResource) Create(ctx context.Context, req resource.CreateRequest, res
 			},
 			LastOutcome: nil,
 			OutcomeGetter: func() (*saya.VmStopResult, error) {
-				return saya.VmStop(ctx, saya.VmStopRequest{Id: id, RequestSayaCtx: r.sayaExeCtx.ToRequestSayaCtx()})
+				return r.sayaExeCtx.SayaClient().VmStop(ctx, saya.VmStopRequest{Id: id, RequestSayaCtx: r.sayaExeCtx.ToRequestSayaCtx()})
 			},
 		}
 		if err := poller.Poll(ctx); err != nil {
 			// TODO better message in case same ctx-issue (e.g. canceling) caused poll exit
-			if err := deleteVm("VmResource.Create-EnsureStateStoppedFailed", ctx, pullRes.Id, r.sayaExeCtx.ToRequestSayaCtx()); err != nil {
+			if err := deleteVm("VmResource.Create-EnsureStateStoppedFailed", ctx, pullRes.Id, r.sayaExeCtx.SayaClient(), r.sayaExeCtx.ToRequestSayaCtx()); err != nil {
 				log.Warnf(ctx, "%+v", err)
 			}
-			resp.Diagnostics.AddError(err.Error(), fmt.Sprintf("%+v", err))
+			addErrorDiag(&resp.Diagnostics, err)
 			return
 		}
 	}
@@ -199,15 +199,15 @@ func (r *VmResource) Create(ctx context.Context, req resource.CreateRequest, res
 	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
 }
 
-func deleteVm(actionCtx string, ctx context.Context, id string, sayaExeCtx saya.RequestSayaCtx) error {
+func deleteVm(actionCtx string, ctx context.Context, id string, client saya.SayaClient, sayaExeCtx saya.RequestSayaCtx) error {
 	// cleaning up
 
-	if _, err := saya.VmStop(ctx, saya.VmStopRequest{Id: id, RequestSayaCtx: sayaExeCtx}); err != nil {
+	if _, err := client.VmStop(ctx, saya.VmStopRequest{Id: id, RequestSayaCtx: sayaExeCtx}); err != nil {
 		log.Debugf(ctx,
 			"VmResource.Create -- fail to stop vm: action-ctx=%s id=%s err=%s",
 			actionCtx, id, stringutil.IndentN(2, fmt.Sprintf("%+v", err)))
 	}
-	if _, err := saya.VmRm(ctx, saya.VmRmRequest{Id: id, RequestSayaCtx: sayaExeCtx}); err != nil {
+	if _, err := client.VmRm(ctx, saya.VmRmRequest{Id: id, RequestSayaCtx: sayaExeCtx}); err != nil {
 		return err
 	}
 	return nil
@@ -220,10 +220,16 @@ func (r *VmResource) Read(ctx context.Context, req resource.ReadRequest, resp *r
 		return
 	}
 
-	updateVmResWithVmDataById(ctx, r, data, &resp.Diagnostics)
+	found := updateVmResWithVmDataById(ctx, r, data, &resp.Diagnostics)
 	if resp.Diagnostics.HasError() {
 		return
 	}
+	if !found {
+		// removed outside of terraform, e.g. with saya vm rm; the next plan recreates it
+		log.Infof(ctx, "VmResource.Read -- vm not found, removing it from state: id=%s", data.Id.ValueString())
+		resp.State.RemoveResource(ctx)
+		return
+	}
 
 	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
 }
@@ -236,10 +242,17 @@ func (r *VmResource) Update(ctx context.Context, req resource.UpdateRequest, res
 		return
 	}
 	// TODO this may be too easy to be true; test what update really means, tf-model change --?--> remove old vm start new one?
-	updateVmResWithVmDataById(ctx, r, data, &resp.Diagnostics)
+	found := updateVmResWithVmDataById(ctx, r, data, &resp.Diagnostics)
 	if resp.Diagnostics.HasError() {
 		return
 	}
+	if !found {
+		resp.Diagnostics.AddError(
+			"VM not found",
+			fmt.Sprintf("VmResource.Update -- vm not found in the forge, it may have been removed outside of terraform: id=%s",
+				data.Id.ValueString()))
+		return
+	}
 
 	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
 }
@@ -258,8 +271,8 @@ func (r *VmResource) Delete(ctx context.Context, req resource.DeleteRequest, res
 
 	id := data.Id.ValueString()
 
-	if err := deleteVm("VmResource.Delete", ctx, id, r.sayaExeCtx.ToRequestSayaCtx()); err != nil {
-		resp.Diagnostics.AddError(err.Error(), fmt.Sprintf("%+v", err))
+	if err := deleteVm("VmResource.Delete", ctx, id, r.sayaExeCtx.SayaClient(), r.sayaExeCtx.ToRequestSayaCtx()); err != nil {
+		addErrorDiag(&resp.Diagnostics, err)
 		return
 	}
 }
@@ -275,9 +288,9 @@ func (r *VmResource) ImportState(ctx context.Context, req resource.ImportStateRe
 		RequestSayaCtx: r.sayaExeCtx.ToRequestSayaCtx(),
 	}
 
-	switch lsResList, err := saya.VmLs(ctx, lsReq); {
+	switch lsResList, err := r.sayaExeCtx.SayaClient().VmLs(ctx, lsReq); {
 	case err != nil:
-		resp.Diagnostics.AddError(err.Error(), fmt.Sprintf("%+v", err))
+		addErrorDiag(&resp.Diagnostics, err)
 		return
 	case len(lsResList) == 1:
 		lsRes := lsResList[0]
@@ -308,17 +321,18 @@ func (r *VmResource) ImportState(ctx context.Context, req resource.ImportStateRe
 
 }
 
-func updateVmResWithVmDataById(ctx context.Context, r *VmResource, data *VmResourceModel, diagnostics *diag.Diagnostics) {
+// updateVmResWithVmDataById updates data with the vm listed by saya; it returns false if the vm is not found.
+func updateVmResWithVmDataById(ctx context.Context, r *VmResource, data *VmResourceModel, diagnostics *diag.Diagnostics) bool {
 	idStr := data.Id.ValueString()
 	lsReq := saya.VmLsRequest{
 		Id:             idStr,
 		RequestSayaCtx: r.sayaExeCtx.ToRequestSayaCtx(),
 	}
 
-	switch lsResList, err := saya.VmLs(ctx, lsReq); {
+	switch lsResList, err := r.sayaExeCtx.SayaClient().VmLs(ctx, lsReq); {
 	case err != nil:
-		diagnostics.AddError(err.Error(), fmt.Sprintf("%+v", err))
-		return
+		addErrorDiag(diagnostics, err)
+		return false
 	case len(lsResList) == 1:
 		lsRes := lsResList[0]
 		data.Id = types.StringValue(idStr)
@@ -327,20 +341,14 @@ func updateVmResWithVmDataById(ctx context.Context, r *VmResource, data *VmResou
 		data.ComputeType = types.StringValue(lsRes.ComputeType)
 		data.OsVariant = types.StringValue(lsRes.OsVariant)
 		data.State = types.StringValue(lsRes.State)
-		return
+		return true
 	case len(lsResList) == 0:
-		diagnostics.AddError(
-			"updateVmResWithVmDataById -- No vm found in the forge",
-			fmt.Sprintf(
-				"updateVmResWithVmDataById -- No vm found in the forge(local image store):"+
-					" request-data=%#v",
-				lsReq))
-		return
+		return false
 	default:
 		lsResListStr := slices.MapPMust(lsResList, (*saya.VmLsResult).LabelNameAndId)
 		diagnostics.AddError(
 			"updateVmResWithVmDataById -- Too many vm found",
 			fmt.Sprintf("updateVmResWithVmDataById -- Too many vm found: found=%v", lsResListStr))
-		return
+		return false
 	}
 }
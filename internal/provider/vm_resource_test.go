@@ -16,6 +16,7 @@ package provider
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"os"
 	"path/filepath"
@@ -23,10 +24,13 @@ import (
 	"testing"
 	"text/template"
 
+	"github.com/congop/terraform-provider-saya/internal/log"
 	"github.com/congop/terraform-provider-saya/internal/saya"
 	"github.com/congop/terraform-provider-saya/internal/slices"
 	"github.com/congop/terraform-provider-saya/internal/stringutil"
 	repos "github.com/congop/terraform-provider-saya/internal/stubrepo"
+	fwresource "github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/types"
 	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
 	"github.com/hashicorp/terraform-plugin-testing/terraform"
 	"github.com/stretchr/testify/require"
@@ -35,7 +39,7 @@ import (
 const EnvNameTfSayaForgeWithImg = "TF_SAYA_FORGE_WITH_IMG"
 const EnvNameTfSayaTestAccVmResArgs = "TF_SAYA_TEST_ACC_VM_RES_ARGS"
 
-func getForgeWithImgWebserverV1(t *testing.T) string {
+func getForgeWithImgWebserverV1(t *testing.T, args *tfTestAccVmResArgs) string {
 	forge, avail := os.LookupEnv(EnvNameTfSayaForgeWithImg)
 	if avail {
 		if forge = strings.TrimSpace(forge); forge != "" {
@@ -48,10 +52,45 @@ func getForgeWithImgWebserverV1(t *testing.T) string {
 	}
 	absPath, err := filepath.Abs("../../../vmbuilder/saya/.forge")
 	require.NoErrorf(t, err, "fail to get absolute path of local forge with image")
+	if _, err := os.Stat(absPath); os.IsNotExist(err) {
+		// no local forge, e.g. when running with the fake saya cli
+		return givenForgeWithImgWebserverV1(t, args)
+	}
 	require.DirExistsf(t, absPath, "local forge with image must exists: abs-path=%s", absPath)
 	return absPath
 }
 
+// givenForgeWithImgWebserverV1 pulls a dummy webserver:v1 image from a stub http repository into a new forge.
+func givenForgeWithImgWebserverV1(t *testing.T, args *tfTestAccVmResArgs) string {
+	httpRepo := repos.NewDummyHttpRepo()
+	require.NoErrorf(t, httpRepo.Start(), "fail to start http server")
+	defer func() {
+		if err := httpRepo.Close(); err != nil {
+			log.Errorf(repos.StubLogCtx(), "fail to stop http server: err=%+v ", err)
+		}
+	}()
+	specData := repos.PullImgSpecData{
+		Tag:       saya.Reference{Original: "webserver:v1", Name: "webserver", Version: "v1"},
+		OsVariant: "alpine",
+		Platform:  args.Platform,
+		RepoType:  "http",
+		ImgType:   args.ImgType,
+	}
+	_, err := repos.GivenImgInRemoteRepoBySpec(httpRepo.RegisterDummyImg, specData, true)
+	require.NoErrorf(t, err, "fail to put image in http repo")
+	forge := filepath.Join(t.TempDir(), "forge")
+	_, err = saya.Pull(repos.StubLogCtx(), saya.PullRequest{
+		Name:           specData.Tag.Normalized(),
+		ImgType:        specData.ImgType,
+		Platform:       specData.Platform.PlatformStr(),
+		RepoType:       "http",
+		HttpRepo:       httpRepo.AsRepos().Http,
+		RequestSayaCtx: saya.RequestSayaCtx{Exe: sayaExe(t), Forge: forge},
+	})
+	require.NoErrorf(t, err, "fail to pull image into forge")
+	return forge
+}
+
 func rmVmByName(t *testing.T, vmNames []string, forge string) {
 	errs := make([]error, 0, 8)
 	for _, vmName := range vmNames {
@@ -114,7 +153,7 @@ func TestAccVmRes(t *testing.T) {
 	}
 
 	args := loadTfTestAccVmResArgs(t)
-	forge := getForgeWithImgWebserverV1(t)
+	forge := getForgeWithImgWebserverV1(t, args)
 
 	t.Cleanup(
 		func() {
@@ -304,3 +343,81 @@ func findVmIdByName(t *testing.T, name string, forge string) []saya.VmLsResult {
 	require.NoErrorf(t, err, "fail to find vm with name: name=%s", name)
 	return vms
 }
+
+func TestVmResourceWithInMemoryClient(t *testing.T) {
+	ctx := context.Background()
+	client := saya.NewInMemorySayaClient()
+	client.AddToForge(saya.LsResult{
+		Name: "webserver", Version: "v1", Sha256: "sha-v1", Type: "ova",
+		Platform: saya.PlatformSw{Platform: saya.Platform{Os: "linux", Arch: "amd64"}, OsVariant: "alpine"},
+	})
+	r := &VmResource{sayaExeCtx: &SayaExecutionCtx{SayaExe: "saya", Client: client}}
+
+	createResp := fwresource.CreateResponse{State: testState(t, r)}
+	r.Create(ctx, fwresource.CreateRequest{Plan: testPlan(t, r, &VmResourceModel{
+		Name:      types.StringValue("web"),
+		Image:     types.StringValue("linux/amd64:webserver:v1:ova"),
+		State:     types.StringValue("stopped"),
+		Id:        types.StringUnknown(),
+		OsVariant: types.StringUnknown(),
+	})}, &createResp)
+	require.False(t, createResp.Diagnostics.HasError(), "diags=%v", createResp.Diagnostics)
+	created := VmResourceModel{}
+	require.False(t, createResp.State.Get(ctx, &created).HasError())
+	require.Equal(t, "alpine", created.OsVariant.ValueString())
+	vms, err := client.VmLs(ctx, saya.VmLsRequest{Id: created.Id.ValueString()})
+	require.NoError(t, err)
+	require.Len(t, vms, 1)
+	require.Equal(t, "stopped", vms[0].State)
+
+	// drift: the vm has been started out of band
+	require.NoError(t, client.SetVmState(created.Id.ValueString(), "running"))
+	readResp := fwresource.ReadResponse{State: createResp.State}
+	r.Read(ctx, fwresource.ReadRequest{State: createResp.State}, &readResp)
+	require.False(t, readResp.Diagnostics.HasError(), "diags=%v", readResp.Diagnostics)
+	read := VmResourceModel{}
+	require.False(t, readResp.State.Get(ctx, &read).HasError())
+	require.Equal(t, "running", read.State.ValueString())
+	require.Equal(t, "linux/amd64:webserver:v1:ova", read.Image.ValueString())
+
+	importResp := fwresource.ImportStateResponse{State: testState(t, r)}
+	r.ImportState(ctx, fwresource.ImportStateRequest{ID: created.Id.ValueString()}, &importResp)
+	require.False(t, importResp.Diagnostics.HasError(), "diags=%v", importResp.Diagnostics)
+	imported := VmResourceModel{}
+	require.False(t, importResp.State.Get(ctx, &imported).HasError())
+	require.Equal(t, read, imported)
+
+	// the running vm gets stopped before removal
+	deleteResp := fwresource.DeleteResponse{State: readResp.State}
+	r.Delete(ctx, fwresource.DeleteRequest{State: readResp.State}, &deleteResp)
+	require.False(t, deleteResp.Diagnostics.HasError(), "diags=%v", deleteResp.Diagnostics)
+	vms, err = client.VmLs(ctx, saya.VmLsRequest{})
+	require.NoError(t, err)
+	require.Empty(t, vms)
+
+	goneResp := fwresource.ReadResponse{State: readResp.State}
+	r.Read(ctx, fwresource.ReadRequest{State: readResp.State}, &goneResp)
+	require.False(t, goneResp.Diagnostics.HasError(), "diags=%v", goneResp.Diagnostics)
+	require.True(t, goneResp.State.Raw.IsNull(), "vm gone from the forge must be removed from state")
+
+	// saya failures are not classified, so that deleting a vm already gone from the forge is reported
+	deleteResp = fwresource.DeleteResponse{State: readResp.State}
+	r.Delete(ctx, fwresource.DeleteRequest{State: readResp.State}, &deleteResp)
+	require.True(t, deleteResp.Diagnostics.HasError())
+	require.Equal(t, "saya vm rm failed", deleteResp.Diagnostics.Errors()[0].Summary())
+}
+
+func TestVmResourceCreateReportsMissingImage(t *testing.T) {
+	r := &VmResource{sayaExeCtx: &SayaExecutionCtx{SayaExe: "saya", Client: saya.NewInMemorySayaClient()}}
+
+	createResp := fwresource.CreateResponse{State: testState(t, r)}
+	r.Create(context.Background(), fwresource.CreateRequest{Plan: testPlan(t, r, &VmResourceModel{
+		Image:     types.StringValue("linux/amd64:webserver:v1:ova"),
+		Id:        types.StringUnknown(),
+		OsVariant: types.StringUnknown(),
+	})}, &createResp)
+
+	require.True(t, createResp.Diagnostics.HasError())
+	require.Equal(t, "saya vm run failed", createResp.Diagnostics.Errors()[0].Summary())
+	require.Contains(t, createResp.Diagnostics.Errors()[0].Detail(), "image not found in forge")
+}
@@ -0,0 +1,226 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package saya
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/endpointcreds"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/congop/terraform-provider-saya/internal/opaque"
+	"github.com/congop/terraform-provider-saya/internal/slices"
+	"github.com/pkg/errors"
+)
+
+// awsCredsExpiryWindow is how long before their expiry credentials get refreshed.
+// A saya invocation may run for minutes, so the credentials handed over must outlive it.
+const awsCredsExpiryWindow = 5 * time.Minute
+
+// AwsAssumeRole models the role to assume on top of the base credentials.
+type AwsAssumeRole struct {
+	RoleArn     string
+	ExternalId  string
+	SessionName string
+	Duration    time.Duration
+}
+
+// AwsWebIdentity models the role to assume using a web identity token (e.g. OIDC token of a CI job).
+type AwsWebIdentity struct {
+	RoleArn     string
+	TokenFile   string
+	SessionName string
+}
+
+// AwsCredentialChain models how aws credentials are resolved when not specified as static keys.
+//
+// Without any setting the standard chain applies: environment variables, shared config/credentials files,
+// web identity from environment, ECS container endpoint and EC2 instance metadata service.
+type AwsCredentialChain struct {
+	Profile                string
+	SharedConfigFiles      []string
+	SharedCredentialsFiles []string
+
+	AssumeRole  *AwsAssumeRole
+	WebIdentity *AwsWebIdentity
+
+	Ec2MetadataEndpoint          string // overrides the EC2 instance metadata service endpoint
+	ContainerCredentialsEndpoint string // full uri of an ECS like container credentials endpoint
+	StsEndpoint                  string // overrides the STS endpoint used to assume roles
+}
+
+func (chain *AwsCredentialChain) NormalizeToNil() *AwsCredentialChain {
+	if chain == nil {
+		return nil
+	}
+	copy := *chain
+	copy.Profile = strings.TrimSpace(copy.Profile)
+	copy.SharedConfigFiles = slices.FilterMust(slices.MapMust(copy.SharedConfigFiles, strings.TrimSpace), StringNotEmpty)
+	copy.SharedCredentialsFiles = slices.FilterMust(slices.MapMust(copy.SharedCredentialsFiles, strings.TrimSpace), StringNotEmpty)
+	copy.Ec2MetadataEndpoint = strings.TrimSpace(copy.Ec2MetadataEndpoint)
+	copy.ContainerCredentialsEndpoint = strings.TrimSpace(copy.ContainerCredentialsEndpoint)
+	copy.StsEndpoint = strings.TrimSpace(copy.StsEndpoint)
+	if role := copy.AssumeRole; role != nil {
+		roleCopy := *role
+		roleCopy.RoleArn = strings.TrimSpace(roleCopy.RoleArn)
+		roleCopy.ExternalId = strings.TrimSpace(roleCopy.ExternalId)
+		roleCopy.SessionName = strings.TrimSpace(roleCopy.SessionName)
+		copy.AssumeRole = &roleCopy
+		if roleCopy.RoleArn == "" {
+			copy.AssumeRole = nil
+		}
+	}
+	if webId := copy.WebIdentity; webId != nil {
+		webIdCopy := *webId
+		webIdCopy.RoleArn = strings.TrimSpace(webIdCopy.RoleArn)
+		webIdCopy.TokenFile = strings.TrimSpace(webIdCopy.TokenFile)
+		webIdCopy.SessionName = strings.TrimSpace(webIdCopy.SessionName)
+		copy.WebIdentity = &webIdCopy
+		if webIdCopy.RoleArn == "" && webIdCopy.TokenFile == "" {
+			copy.WebIdentity = nil
+		}
+	}
+	return &copy
+}
+
+// NewAwsCredentialsProvider returns a caching credentials provider resolving credentials according to
+// the static credentials (if any) and the credential chain settings.
+// Credentials are refreshed when they are about to expire, so retrieving them before each saya invocation
+// hands over valid credentials.
+func NewAwsCredentialsProvider(
+	ctx context.Context, region string,
+	staticCreds *AwsCredentials, chain *AwsCredentialChain,
+) (aws.CredentialsProvider, error) {
+	chain = chain.NormalizeToNil()
+	if chain == nil {
+		chain = &AwsCredentialChain{}
+	}
+
+	optFns := make([]func(*config.LoadOptions) error, 0, 8)
+	optFns = append(optFns, config.WithCredentialsCacheOptions(func(o *aws.CredentialsCacheOptions) {
+		o.ExpiryWindow = awsCredsExpiryWindow
+	}))
+	if region = strings.TrimSpace(region); region != "" {
+		optFns = append(optFns, config.WithRegion(region))
+	}
+	if chain.Profile != "" {
+		optFns = append(optFns, config.WithSharedConfigProfile(chain.Profile))
+	}
+	if len(chain.SharedConfigFiles) != 0 {
+		optFns = append(optFns, config.WithSharedConfigFiles(chain.SharedConfigFiles))
+	}
+	if len(chain.SharedCredentialsFiles) != 0 {
+		optFns = append(optFns, config.WithSharedCredentialsFiles(chain.SharedCredentialsFiles))
+	}
+	if chain.Ec2MetadataEndpoint != "" {
+		optFns = append(optFns, config.WithEC2IMDSEndpoint(chain.Ec2MetadataEndpoint))
+	}
+
+	staticCreds = staticCreds.NormalizeToNil()
+	switch {
+	case staticCreds != nil && staticCreds.AccessKeyID != "":
+		optFns = append(optFns, config.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(
+				staticCreds.AccessKeyID, staticCreds.SecretAccessKey.Value(), staticCreds.SessionToken.Value())))
+	case chain.ContainerCredentialsEndpoint != "":
+		optFns = append(optFns, config.WithCredentialsProvider(
+			endpointcreds.New(chain.ContainerCredentialsEndpoint)))
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx, optFns...)
+	if err != nil {
+		return nil, errors.Wrapf(err,
+			"NewAwsCredentialsProvider -- fail to load aws config: profile=%q err=%v",
+			chain.Profile, err)
+	}
+
+	stsOptFn := func(o *sts.Options) {
+		if chain.StsEndpoint != "" {
+			o.BaseEndpoint = aws.String(chain.StsEndpoint)
+		}
+	}
+
+	credsProvider := cfg.Credentials
+	if webId := chain.WebIdentity; webId != nil {
+		if webId.RoleArn == "" || webId.TokenFile == "" {
+			return nil, errors.Errorf(
+				"NewAwsCredentialsProvider -- web identity requires role-arn and token-file: "+
+					"role-arn=%q token-file=%q",
+				webId.RoleArn, webId.TokenFile)
+		}
+		credsProvider = stscreds.NewWebIdentityRoleProvider(
+			sts.NewFromConfig(cfg, stsOptFn), webId.RoleArn, stscreds.IdentityTokenFile(webId.TokenFile),
+			func(o *stscreds.WebIdentityRoleOptions) {
+				if webId.SessionName != "" {
+					o.RoleSessionName = webId.SessionName
+				}
+			})
+	}
+
+	if role := chain.AssumeRole; role != nil {
+		baseCfg := cfg.Copy()
+		baseCfg.Credentials = credsProvider
+		credsProvider = stscreds.NewAssumeRoleProvider(
+			sts.NewFromConfig(baseCfg, stsOptFn), role.RoleArn,
+			func(o *stscreds.AssumeRoleOptions) {
+				if role.ExternalId != "" {
+					o.ExternalID = aws.String(role.ExternalId)
+				}
+				if role.SessionName != "" {
+					o.RoleSessionName = role.SessionName
+				}
+				if role.Duration > 0 {
+					o.Duration = role.Duration
+				}
+			})
+	}
+
+	if credsProvider == nil {
+		return nil, errors.Errorf("NewAwsCredentialsProvider -- no credentials provider resolved: chain=%#v", chain)
+	}
+
+	// LoadDefaultConfig already wrapped the resolved provider in a cache
+	if _, ok := credsProvider.(*aws.CredentialsCache); ok {
+		return credsProvider, nil
+	}
+	return aws.NewCredentialsCache(credsProvider, func(o *aws.CredentialsCacheOptions) {
+		o.ExpiryWindow = awsCredsExpiryWindow
+	}), nil
+}
+
+// AwsCredentialsFromProvider retrieves the credentials and maps them to saya credentials.
+func AwsCredentialsFromProvider(ctx context.Context, credsProvider aws.CredentialsProvider) (*AwsCredentials, error) {
+	awsCreds, err := credsProvider.Retrieve(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "AwsCredentialsFromProvider -- fail to retrieve aws credentials: err=%v", err)
+	}
+	cred := AwsCredentials{
+		AccessKeyID:     awsCreds.AccessKeyID,
+		SecretAccessKey: *opaque.NewString(awsCreds.SecretAccessKey),
+		SessionToken:    *opaque.NewString(awsCreds.SessionToken),
+		Source:          awsCreds.Source,
+		CanExpire:       awsCreds.CanExpire,
+	}
+	if awsCreds.CanExpire {
+		expires := awsCreds.Expires
+		cred.Expires = &expires
+	}
+	return &cred, nil
+}
@@ -0,0 +1,199 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package saya
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/congop/terraform-provider-saya/internal/opaque"
+	"github.com/stretchr/testify/require"
+)
+
+// isolateAwsEnv makes sure the aws settings of the machine running the tests do not leak in.
+func isolateAwsEnv(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "AWS_PROFILE",
+		"AWS_WEB_IDENTITY_TOKEN_FILE", "AWS_ROLE_ARN",
+		"AWS_CONTAINER_CREDENTIALS_FULL_URI", "AWS_CONTAINER_CREDENTIALS_RELATIVE_URI",
+	} {
+		t.Setenv(name, "")
+	}
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+}
+
+// newContainerCredsServer starts an ECS like container credentials endpoint stand-in,
+// handing out credentials expiring after the given duration.
+func newContainerCredsServer(t *testing.T, expiresIn time.Duration) (*httptest.Server, *int32) {
+	hits := new(int32)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hit := atomic.AddInt32(hits, 1)
+		w.Header().Set("Content-Type", "application/json")
+		err := json.NewEncoder(w).Encode(map[string]string{
+			"AccessKeyId":     fmt.Sprintf("AKID-%d", hit),
+			"SecretAccessKey": fmt.Sprintf("SECRET-%d", hit),
+			"Token":           fmt.Sprintf("TOKEN-%d", hit),
+			"Expiration":      time.Now().Add(expiresIn).UTC().Format(time.RFC3339),
+		})
+		require.NoError(t, err, "fail to write container credentials")
+	}))
+	t.Cleanup(srv.Close)
+	return srv, hits
+}
+
+func TestNewAwsCredentialsProviderContainerEndpointRefresh(t *testing.T) {
+	tests := []struct {
+		name      string
+		expiresIn time.Duration
+		wantHits  int32
+	}{
+		{
+			name:      "should-refresh-credentials-expiring-within-window",
+			expiresIn: time.Minute,
+			wantHits:  2,
+		},
+		{
+			name:      "should-cache-long-lived-credentials",
+			expiresIn: time.Hour,
+			wantHits:  1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isolateAwsEnv(t)
+			ctx := context.Background()
+			srv, hits := newContainerCredsServer(t, tt.expiresIn)
+
+			credsProvider, err := NewAwsCredentialsProvider(ctx, "us-east-1", nil,
+				&AwsCredentialChain{ContainerCredentialsEndpoint: srv.URL})
+			require.NoError(t, err, "fail to create credentials provider")
+
+			for i := 0; i < 2; i++ {
+				cred, err := AwsCredentialsFromProvider(ctx, credsProvider)
+				require.NoError(t, err, "fail to retrieve credentials")
+				require.True(t, cred.CanExpire)
+				require.NotNil(t, cred.Expires)
+				require.NotEmpty(t, cred.SessionToken.Value())
+			}
+			require.Equal(t, tt.wantHits, atomic.LoadInt32(hits))
+		})
+	}
+}
+
+func TestNewAwsCredentialsProviderSharedCredentialsProfile(t *testing.T) {
+	isolateAwsEnv(t)
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID-ENV")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "SECRET-ENV")
+	credsFile := writeTestFile(t, t.TempDir(), "credentials", []byte(
+		"[default]\naws_access_key_id = AKID-DEFAULT\naws_secret_access_key = SECRET-DEFAULT\n"+
+			"[ci]\naws_access_key_id = AKID-CI\naws_secret_access_key = SECRET-CI\n"))
+
+	tests := []struct {
+		name    string
+		chain   *AwsCredentialChain
+		wantKey string
+	}{
+		{
+			name:    "should-resolve-from-environment",
+			chain:   nil,
+			wantKey: "AKID-ENV",
+		},
+		{
+			name:    "should-resolve-from-profile",
+			chain:   &AwsCredentialChain{Profile: "ci", SharedCredentialsFiles: []string{credsFile}},
+			wantKey: "AKID-CI",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			credsProvider, err := NewAwsCredentialsProvider(ctx, "us-east-1", nil, tt.chain)
+			require.NoError(t, err, "fail to create credentials provider")
+			cred, err := AwsCredentialsFromProvider(ctx, credsProvider)
+			require.NoError(t, err, "fail to retrieve credentials")
+			require.Equal(t, tt.wantKey, cred.AccessKeyID)
+		})
+	}
+}
+
+func TestNewAwsCredentialsProviderAssumeRole(t *testing.T) {
+	isolateAwsEnv(t)
+	form := make(chan map[string]string, 1)
+	stsSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm(), "fail to parse sts request")
+		form <- map[string]string{
+			"Action":          r.PostForm.Get("Action"),
+			"RoleArn":         r.PostForm.Get("RoleArn"),
+			"ExternalId":      r.PostForm.Get("ExternalId"),
+			"RoleSessionName": r.PostForm.Get("RoleSessionName"),
+			"DurationSeconds": r.PostForm.Get("DurationSeconds"),
+		}
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprintf(w, `<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleResult>
+    <Credentials>
+      <AccessKeyId>AKID-ROLE</AccessKeyId>
+      <SecretAccessKey>SECRET-ROLE</SecretAccessKey>
+      <SessionToken>TOKEN-ROLE</SessionToken>
+      <Expiration>%s</Expiration>
+    </Credentials>
+    <AssumedRoleUser>
+      <Arn>arn:aws:sts::123456789012:assumed-role/saya/tf</Arn>
+      <AssumedRoleId>ARO123:tf</AssumedRoleId>
+    </AssumedRoleUser>
+  </AssumeRoleResult>
+  <ResponseMetadata><RequestId>req-1</RequestId></ResponseMetadata>
+</AssumeRoleResponse>`, time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+	}))
+	defer stsSrv.Close()
+
+	ctx := context.Background()
+	credsProvider, err := NewAwsCredentialsProvider(ctx, "us-east-1",
+		&AwsCredentials{AccessKeyID: "AKID-BASE", SecretAccessKey: *opaque.NewString("SECRET-BASE")},
+		&AwsCredentialChain{
+			StsEndpoint: stsSrv.URL,
+			AssumeRole: &AwsAssumeRole{
+				RoleArn:     "arn:aws:iam::123456789012:role/saya",
+				ExternalId:  "ext-42",
+				SessionName: "tf",
+				Duration:    30 * time.Minute,
+			},
+		})
+	require.NoError(t, err, "fail to create credentials provider")
+
+	cred, err := AwsCredentialsFromProvider(ctx, credsProvider)
+	require.NoError(t, err, "fail to retrieve credentials")
+	require.Equal(t, "AKID-ROLE", cred.AccessKeyID)
+	require.Equal(t, "TOKEN-ROLE", cred.SessionToken.Value())
+	require.Equal(t,
+		map[string]string{
+			"Action":          "AssumeRole",
+			"RoleArn":         "arn:aws:iam::123456789012:role/saya",
+			"ExternalId":      "ext-42",
+			"RoleSessionName": "tf",
+			"DurationSeconds": "1800",
+		},
+		<-form)
+}
@@ -0,0 +1,67 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package saya
+
+import "context"
+
+// SayaClient manages the images of the forge (local image store) and the vms run from them.
+type SayaClient interface {
+	Pull(ctx context.Context, req PullRequest) (*PullResult, error)
+	Ls(ctx context.Context, req LsRequest) ([]LsResult, error)
+	ImageRm(ctx context.Context, req ImageDeleteRequest) error
+
+	VmRun(ctx context.Context, req VmRunRequest) (*VmRunResult, error)
+	VmLs(ctx context.Context, req VmLsRequest) ([]VmLsResult, error)
+	VmStart(ctx context.Context, req VmStartRequest) (*VmStartResult, error)
+	VmStop(ctx context.Context, req VmStopRequest) (*VmStopResult, error)
+	VmRm(ctx context.Context, req VmRmRequest) (*VmRmResult, error)
+}
+
+// CmdSayaClient implements SayaClient by executing saya commands.
+type CmdSayaClient struct{}
+
+var _ SayaClient = CmdSayaClient{}
+
+func (CmdSayaClient) Pull(ctx context.Context, req PullRequest) (*PullResult, error) {
+	return Pull(ctx, req)
+}
+
+func (CmdSayaClient) Ls(ctx context.Context, req LsRequest) ([]LsResult, error) {
+	return Ls(ctx, req)
+}
+
+func (CmdSayaClient) ImageRm(ctx context.Context, req ImageDeleteRequest) error {
+	return ImageRm(ctx, req)
+}
+
+func (CmdSayaClient) VmRun(ctx context.Context, req VmRunRequest) (*VmRunResult, error) {
+	return VmRun(ctx, req)
+}
+
+func (CmdSayaClient) VmLs(ctx context.Context, req VmLsRequest) ([]VmLsResult, error) {
+	return VmLs(ctx, req)
+}
+
+func (CmdSayaClient) VmStart(ctx context.Context, req VmStartRequest) (*VmStartResult, error) {
+	return VmStart(ctx, req)
+}
+
+func (CmdSayaClient) VmStop(ctx context.Context, req VmStopRequest) (*VmStopResult, error) {
+	return VmStop(ctx, req)
+}
+
+func (CmdSayaClient) VmRm(ctx context.Context, req VmRmRequest) (*VmRmResult, error) {
+	return VmRm(ctx, req)
+}
@@ -0,0 +1,331 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package saya
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/exp/slices"
+)
+
+const (
+	inMemoryVmStateRunning = "running"
+	inMemoryVmStateStopped = "stopped"
+)
+
+// InMemorySayaClient simulates the forge and the vms of saya in memory, e.g. for provider unit tests.
+// Images are pulled from the simulated repository images; vms are run from the images in the forge.
+type InMemorySayaClient struct {
+	mu         sync.Mutex
+	repoImages []LsResult
+	forge      []LsResult
+	vms        map[string]*VmLsResult
+	vmCount    int
+}
+
+var _ SayaClient = &InMemorySayaClient{}
+
+// NewInMemorySayaClient returns a client with an empty forge, which can pull the given repository images.
+func NewInMemorySayaClient(repoImages ...LsResult) *InMemorySayaClient {
+	return &InMemorySayaClient{
+		repoImages: slices.Clone(repoImages),
+		vms:        map[string]*VmLsResult{},
+	}
+}
+
+// AddToForge adds the image to the forge as if it had been pulled out of band.
+func (c *InMemorySayaClient) AddToForge(img LsResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.putInForge(img)
+}
+
+// RemoveFromForge removes the image from the forge as if it had been removed out of band.
+func (c *InMemorySayaClient) RemoveFromForge(name, version string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.forge = slices.DeleteFunc(c.forge, func(img LsResult) bool {
+		return img.Name == name && img.Version == version
+	})
+}
+
+// SetVmState sets the state of the vm, e.g. to simulate a vm stopped out of band.
+func (c *InMemorySayaClient) SetVmState(id, state string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	vm, found := c.vms[id]
+	if !found {
+		return errors.Errorf("InMemorySayaClient.SetVmState -- vm not found: id=%s", id)
+	}
+	vm.State = state
+	return nil
+}
+
+func (c *InMemorySayaClient) putInForge(img LsResult) {
+	for i, inForge := range c.forge {
+		if inForge.PlatformNameVersionTypeTaglike() == img.PlatformNameVersionTypeTaglike() {
+			c.forge[i] = img
+			return
+		}
+	}
+	c.forge = append(c.forge, img)
+}
+
+// imageFilter matches images by reference, type, platform and sha256; blank criteria match any image.
+type imageFilter struct {
+	ref      *Reference
+	imgType  string
+	platform *Platform
+	sha256   string
+}
+
+func newImageFilter(name, imgType, platformStr, sha256 string) (imageFilter, error) {
+	filter := imageFilter{imgType: strings.TrimSpace(imgType), sha256: strings.TrimSpace(sha256)}
+	if strings.TrimSpace(name) != "" {
+		ref, err := ParseReference(name)
+		if err != nil {
+			return filter, err
+		}
+		filter.ref = ref
+	}
+	if strings.TrimSpace(platformStr) != "" {
+		platform, err := PlatformNormalized(platformStr)
+		if err != nil {
+			return filter, err
+		}
+		filter.platform = platform
+	}
+	return filter, nil
+}
+
+func (filter imageFilter) matches(img LsResult) bool {
+	switch {
+	case filter.ref != nil && (filter.ref.Name != img.Name || filter.ref.Version != img.Version):
+		return false
+	case filter.imgType != "" && filter.imgType != img.Type:
+		return false
+	case filter.platform != nil && filter.platform.PlatformStr() != img.Platform.PlatformStr():
+		return false
+	case filter.sha256 != "" && filter.sha256 != img.Sha256:
+		return false
+	}
+	return true
+}
+
+func (filter imageFilter) find(images []LsResult) []LsResult {
+	found := []LsResult{}
+	for _, img := range images {
+		if filter.matches(img) {
+			found = append(found, img)
+		}
+	}
+	return found
+}
+
+func (c *InMemorySayaClient) Pull(ctx context.Context, req PullRequest) (*PullResult, error) {
+	platform := req.Platform
+	if strings.TrimSpace(platform) == "" {
+		// saya defaults to the host platform
+		p, err := PlatformNormalized("")
+		if err != nil {
+			return nil, err
+		}
+		platform = p.PlatformStr()
+	}
+	filter, err := newImageFilter(req.Name, req.ImgType, platform, req.Hash)
+	if err != nil {
+		return nil, err
+	}
+	if filter.ref == nil {
+		return nil, errors.Errorf("InMemorySayaClient.Pull -- name must not be blank")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	found := filter.find(c.repoImages)
+	switch {
+	case len(found) == 0:
+		return nil, errors.WithStack(NewSayaError(ErrKindUnknown, CmdSpecImgPull.String(),
+			fmt.Sprintf("InMemorySayaClient.Pull -- image not found in repository: req=%#v", req)))
+	case len(found) > 1:
+		return nil, errors.Errorf("InMemorySayaClient.Pull -- image type or platform ambiguous: req=%#v found=%d", req, len(found))
+	}
+	img := found[0]
+	switch {
+	case strings.TrimSpace(req.RepoType) != "":
+		img.SrcType = strings.TrimSpace(req.RepoType)
+	case req.HttpRepo != nil:
+		img.SrcType = RepoTypeHttp
+	case req.S3Repo != nil:
+		img.SrcType = RepoTypeS3
+	}
+	c.putInForge(img)
+	return &PullResult{
+		Name:     img.Name,
+		Version:  img.Version,
+		Sha256:   img.Sha256,
+		Type:     img.Type,
+		Platform: img.Platform,
+		SrcType:  img.SrcType,
+	}, nil
+}
+
+func (c *InMemorySayaClient) Ls(ctx context.Context, req LsRequest) ([]LsResult, error) {
+	filter, err := newImageFilter(req.Name, req.ImgType, req.Platform, req.Sha256)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	found := []LsResult{}
+	for _, img := range filter.find(c.forge) {
+		if osVariant := strings.TrimSpace(req.OsVariant); osVariant == "" || osVariant == img.Platform.OsVariant {
+			found = append(found, img)
+		}
+	}
+	if len(found) == 0 {
+		// as saya ls
+		return nil, nil
+	}
+	return found, nil
+}
+
+func (c *InMemorySayaClient) ImageRm(ctx context.Context, req ImageDeleteRequest) error {
+	filter, err := newImageFilter(req.Name, req.ImgType, req.Platform, "")
+	if err != nil {
+		return err
+	}
+	if filter.ref == nil {
+		return errors.Errorf("InMemorySayaClient.ImageRm -- name must not be blank")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(filter.find(c.forge)) == 0 {
+		return errors.WithStack(NewSayaError(ErrKindUnknown, CmdSpecImgRm.String(),
+			fmt.Sprintf("InMemorySayaClient.ImageRm -- image not found in forge: req=%#v", req)))
+	}
+	c.forge = slices.DeleteFunc(c.forge, filter.matches)
+	return nil
+}
+
+func (c *InMemorySayaClient) VmRun(ctx context.Context, req VmRunRequest) (*VmRunResult, error) {
+	filter, err := newImageFilter(req.ImgRef, req.ImgType, req.Platform, "")
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	found := filter.find(c.forge)
+	switch {
+	case len(found) == 0:
+		return nil, errors.WithStack(NewSayaError(ErrKindUnknown, CmdSpecVmRun.String(),
+			fmt.Sprintf("InMemorySayaClient.VmRun -- image not found in forge: req=%#v", req)))
+	case len(found) > 1:
+		return nil, errors.Errorf("InMemorySayaClient.VmRun -- image type or platform ambiguous: req=%#v found=%d", req, len(found))
+	}
+	img := found[0]
+
+	c.vmCount++
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = fmt.Sprintf("saya-vm-%d", c.vmCount)
+	}
+	for _, vm := range c.vms {
+		if vm.Name == name {
+			return nil, errors.Errorf("InMemorySayaClient.VmRun -- vm name already in use: name=%s id=%s", name, vm.Id)
+		}
+	}
+	computeType := strings.TrimSpace(req.ComputeType)
+	if computeType == "" {
+		computeType = ComputeTypeQemu
+	}
+	vm := &VmLsResult{
+		Id:          fmt.Sprintf("vm-%d", c.vmCount),
+		Name:        name,
+		Arch:        img.Platform.ArchWithVariant(),
+		Os:          img.Platform.Os,
+		OsVariant:   img.Platform.OsVariant,
+		BaseImg:     strings.Join([]string{img.Name, img.Version, img.Type}, ":"),
+		ComputeType: computeType,
+		State:       inMemoryVmStateRunning,
+	}
+	c.vms[vm.Id] = vm
+
+	res := &VmRunResult{Id: vm.Id, Name: vm.Name, OsVariant: vm.OsVariant}
+	res.Ssh.Ip = "127.0.0.1"
+	res.Ssh.Port = uint16(2200 + c.vmCount)
+	res.Ssh.User = "root"
+	return res, nil
+}
+
+func (c *InMemorySayaClient) VmLs(ctx context.Context, req VmLsRequest) ([]VmLsResult, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	found := []VmLsResult{}
+	for _, vm := range c.vms {
+		switch {
+		case req.Id != "" && req.Id != vm.Id:
+		case req.Name != "" && req.Name != vm.Name:
+		case req.ComputeType != "" && req.ComputeType != vm.ComputeType:
+		case req.OsVariant != "" && req.OsVariant != vm.OsVariant:
+		default:
+			found = append(found, *vm)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].Id < found[j].Id })
+	return found, nil
+}
+
+func (c *InMemorySayaClient) VmStart(ctx context.Context, req VmStartRequest) (*VmStartResult, error) {
+	if err := c.setVmState("VmStart", CmdSpecVmStart, req.Id, inMemoryVmStateRunning); err != nil {
+		return nil, err
+	}
+	return &VmStartResult{Id: req.Id}, nil
+}
+
+func (c *InMemorySayaClient) VmStop(ctx context.Context, req VmStopRequest) (*VmStopResult, error) {
+	if err := c.setVmState("VmStop", CmdSpecVmStop, req.Id, inMemoryVmStateStopped); err != nil {
+		return nil, err
+	}
+	return &VmStopResult{Id: req.Id}, nil
+}
+
+func (c *InMemorySayaClient) setVmState(op string, spec *CmdSpec, id string, state string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	vm, found := c.vms[id]
+	if !found {
+		return errors.WithStack(NewSayaError(ErrKindUnknown, spec.String(),
+			fmt.Sprintf("InMemorySayaClient.%s -- vm not found: id=%s", op, id)))
+	}
+	vm.State = state
+	return nil
+}
+
+func (c *InMemorySayaClient) VmRm(ctx context.Context, req VmRmRequest) (*VmRmResult, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, found := c.vms[req.Id]; !found {
+		return nil, errors.WithStack(NewSayaError(ErrKindUnknown, CmdSpecVmRm.String(),
+			fmt.Sprintf("InMemorySayaClient.VmRm -- vm not found: id=%s", req.Id)))
+	}
+	delete(c.vms, req.Id)
+	return &VmRmResult{Id: req.Id}, nil
+}
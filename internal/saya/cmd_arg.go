@@ -15,13 +15,20 @@
 // taken from https://github.com/congop/go-virtualbox/blob/master/cmd_arg.go
 package saya
 
-import "github.com/congop/terraform-provider-saya/internal/opaque"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/congop/terraform-provider-saya/internal/opaque"
+)
 
 type ICmdArg interface {
 	Key() string
 	ToDel() bool
 	CmdArgs() []string
 	CmdArgsDisplay() []string
+	IsRepeatable() bool // true if the arg may occur multiple times, e.g. --filter; single-valued otherwise
 }
 
 // CmdArgStr models a command arg, which can be a flag or not.
@@ -30,12 +37,17 @@ type CmdArgStr struct {
 	V             *string                    // V value. nil if arg does not allow value specification. Note that empty string "" is a valid value, and different from nil.
 	ToCmdArgParts func(K, V string) []string //
 	Del           bool                       // if true deleted, the arg will not be part of the final command
+	Repeat        bool                       // true if the flag may occur multiple times, e.g. --filter
 }
 
 func (arg *CmdArgStr) Key() string {
 	return arg.K
 }
 
+func (arg *CmdArgStr) IsRepeatable() bool {
+	return arg.Repeat
+}
+
 func (arg *CmdArgStr) ToDel() bool {
 	return arg.Del
 }
@@ -52,9 +64,25 @@ func (arg *CmdArgStr) CmdArgs() []string {
 }
 
 func (arg *CmdArgStr) CmdArgsDisplay() []string {
+	if arg.V != nil && IsSecretFlag(arg.K) {
+		// secret added as plain arg, e.g. by Append; masked as CmdArgOpaqueStr would be
+		return (&CmdArgOpaqueStr{K: arg.K, V: opaque.NewString(*arg.V)}).CmdArgsDisplay()
+	}
 	return arg.CmdArgs()
 }
 
+// secretFlags lists the saya flags whose value is a secret.
+var secretFlags = map[string]bool{
+	"--license-key":              true,
+	"--http-auth-basic-password": true,
+	"--aws-secret-access-key":    true,
+}
+
+// IsSecretFlag returns true if the value of the flag is a secret, which must not be displayed.
+func IsSecretFlag(flag string) bool {
+	return secretFlags[strings.TrimSpace(flag)]
+}
+
 type CmdArgOpaqueStr struct {
 	K             string                                   //Args key. e.g. --accelerated
 	V             *opaque.String                           // V value. nil if arg does not allow value specification. Note that empty string "" is a valid value, and different from nil.
@@ -70,6 +98,10 @@ func (arg *CmdArgOpaqueStr) ToDel() bool {
 	return arg.Del
 }
 
+func (arg *CmdArgOpaqueStr) IsRepeatable() bool {
+	return false
+}
+
 func (arg *CmdArgOpaqueStr) CmdArgs() []string {
 	switch {
 	case arg.V == nil:
@@ -92,9 +124,13 @@ func (arg *CmdArgOpaqueStr) CmdArgsDisplay() []string {
 	}
 }
 
+// CmdArgs are the args of a command line.
+// Single-valued args occur at most once, appending one again is a conflict reported by Err instead of an override.
+// Repeatable args keep all their occurrences, in order. Overrides explicitly replace all occurrences of their key.
 type CmdArgs struct {
 	args      []ICmdArg
 	overrides []ICmdArg
+	conflicts []error // args rejected because they conflict with an already appended one
 }
 
 func NewCmdArgNoValue(k string) *CmdArgStr {
@@ -105,25 +141,57 @@ func NewCmdArg(k, v string) *CmdArgStr {
 	return &CmdArgStr{K: k, V: &v}
 }
 
+func NewCmdArgRepeatable(k, v string) *CmdArgStr {
+	return &CmdArgStr{K: k, V: &v, Repeat: true}
+}
+
 func NewCmdArgDeleted(k string) CmdArgStr {
 	return CmdArgStr{K: k, V: nil, Del: true}
 }
 
 func (cmdArgs *CmdArgs) AppendNoValue(key string) {
-	cmdArgs.args = append(cmdArgs.args, NewCmdArgNoValue(key))
+	cmdArgs.AppendCmdArgs(NewCmdArgNoValue(key))
 }
 
 func (cmdArgs *CmdArgs) Append(key, value string) {
-	cmdArgs.args = append(cmdArgs.args, NewCmdArg(key, value))
+	cmdArgs.AppendCmdArgs(NewCmdArg(key, value))
+}
+
+// AppendRepeatable appends an occurrence of a repeatable flag, e.g. --filter name=web.
+func (cmdArgs *CmdArgs) AppendRepeatable(key string, values ...string) {
+	for _, value := range values {
+		cmdArgs.AppendCmdArgs(NewCmdArgRepeatable(key, value))
+	}
 }
 
+// AppendCmdArgs appends the args; an arg conflicting with an appended one is rejected and reported by Err.
 func (cmdArgs *CmdArgs) AppendCmdArgs(arg ...ICmdArg) {
-	if len(arg) == 0 {
-		return
+	for _, cur := range arg {
+		if err := cmdArgs.conflict(cur); err != nil {
+			cmdArgs.conflicts = append(cmdArgs.conflicts, err)
+			continue
+		}
+		cmdArgs.args = append(cmdArgs.args, cur)
+	}
+}
+
+// conflict returns an error if the arg key is already used, unless all occurrences are repeatable.
+func (cmdArgs *CmdArgs) conflict(arg ICmdArg) error {
+	for _, appended := range cmdArgs.args {
+		if appended.Key() != arg.Key() {
+			continue
+		}
+		if appended.IsRepeatable() && arg.IsRepeatable() {
+			return nil
+		}
+		return fmt.Errorf(
+			"CmdArgs.AppendCmdArgs -- conflicting arg, single-valued args must occur once: key=%s appended=%q conflicting=%q",
+			arg.Key(), appended.CmdArgsDisplay(), arg.CmdArgsDisplay())
 	}
-	cmdArgs.args = append(cmdArgs.args, arg...)
+	return nil
 }
 
+// AppendOverride appends args replacing all occurrences of their key, e.g. to set or delete a flag deliberately.
 func (cmdArgs *CmdArgs) AppendOverride(arg ...ICmdArg) {
 	if len(arg) == 0 {
 		return
@@ -131,8 +199,19 @@ func (cmdArgs *CmdArgs) AppendOverride(arg ...ICmdArg) {
 	cmdArgs.overrides = append(cmdArgs.overrides, arg...)
 }
 
+// Err returns an error listing the conflicting args; nil if there is none.
+func (cmdArgs CmdArgs) Err() error {
+	if len(cmdArgs.conflicts) == 0 {
+		return nil
+	}
+	msgs := make([]string, 0, len(cmdArgs.conflicts))
+	for _, err := range cmdArgs.conflicts {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Errorf("CmdArgs.Err -- conflicting args: \n\t%s", strings.Join(msgs, "\n\t"))
+}
+
 // Args returns an slice containing the args which can be use in a command execution context.
-// Args with multiple occurrence are not supported we will be overriding values.
 func (cmdArgs CmdArgs) Args() []string {
 	return cmdArgs.argsByFn(ICmdArg.CmdArgs)
 }
@@ -142,26 +221,78 @@ func (cmdArgs CmdArgs) ArgsDisplay() []string {
 }
 
 func (cmdArgs CmdArgs) argsByFn(toCmdArgsFn func(ICmdArg) []string) []string {
-	m := make(map[string]ICmdArg, len(cmdArgs.args)+len(cmdArgs.overrides))
+	m := make(map[string][]ICmdArg, len(cmdArgs.args)+len(cmdArgs.overrides))
 	orderK := make([]string, 0, len(cmdArgs.args)+len(cmdArgs.overrides))
-	for _, curArgs := range [][]ICmdArg{cmdArgs.args, cmdArgs.overrides} {
-		for _, arg := range curArgs {
-			k := arg.Key()
-			_, contains := m[k]
-			if !contains {
-				orderK = append(orderK, k)
-			}
-			// yes we are always overriding --> multiple occurrences are not supported
-			m[k] = arg
+	addKey := func(k string) {
+		if _, contains := m[k]; !contains {
+			orderK = append(orderK, k)
 		}
 	}
+	for _, arg := range cmdArgs.args {
+		addKey(arg.Key())
+		// conflicts are rejected when appending, so only repeatable args occur more than once
+		m[arg.Key()] = append(m[arg.Key()], arg)
+	}
+	for _, arg := range cmdArgs.overrides {
+		addKey(arg.Key())
+		m[arg.Key()] = []ICmdArg{arg}
+	}
 	argStrs := make([]string, 0, len(orderK))
 	for _, k := range orderK {
-		arg := m[k]
-		if arg.ToDel() {
-			continue
+		for _, arg := range m[k] {
+			if arg.ToDel() {
+				continue
+			}
+			argStrs = append(argStrs, toCmdArgsFn(arg)...)
 		}
-		argStrs = append(argStrs, arg.CmdArgs()...)
 	}
 	return argStrs
 }
+
+// Value returns the value of the single value string arg, taking overrides and deletion into account.
+func (cmdArgs CmdArgs) Value(key string) (string, bool) {
+	value, found := "", false
+	for _, curArgs := range [][]ICmdArg{cmdArgs.args, cmdArgs.overrides} {
+		for _, arg := range curArgs {
+			if arg.Key() != key {
+				continue
+			}
+			strArg, isStr := arg.(*CmdArgStr)
+			if !isStr || strArg.Del || strArg.V == nil {
+				value, found = "", false
+				continue
+			}
+			value, found = *strArg.V, true
+		}
+	}
+	return value, found
+}
+
+// CmdArgPositional is a sub-command word or an operand, e.g. image, pull or the image reference.
+// It is keyed by its position, so that equal words, e.g. vm ls ls, are all kept.
+type CmdArgPositional struct {
+	Pos int    // position among the positional args
+	V   string // the word
+}
+
+var _ ICmdArg = (*CmdArgPositional)(nil)
+
+func (arg *CmdArgPositional) Key() string {
+	return "#" + strconv.Itoa(arg.Pos)
+}
+
+func (arg *CmdArgPositional) ToDel() bool {
+	return false
+}
+
+func (arg *CmdArgPositional) IsRepeatable() bool {
+	return false
+}
+
+func (arg *CmdArgPositional) CmdArgs() []string {
+	return []string{arg.V}
+}
+
+func (arg *CmdArgPositional) CmdArgsDisplay() []string {
+	return arg.CmdArgs()
+}
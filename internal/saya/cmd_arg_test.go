@@ -0,0 +1,142 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package saya
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCmdArgs(t *testing.T) {
+	deleted := NewCmdArgDeleted("--filter")
+	tests := []struct {
+		name          string
+		given         func(args *CmdArgs)
+		wantArgs      []string
+		wantConflicts []string
+	}{
+		{
+			name: "should-keep-all-occurrences-of-repeatable-flags-in-order",
+			given: func(args *CmdArgs) {
+				args.AppendRepeatable("--filter", "name=web")
+				args.Append("--format", "json")
+				args.AppendRepeatable("--filter", "os-variant=alpine", "compute-type=qemu")
+			},
+			wantArgs: []string{"--filter", "name=web", "--filter", "os-variant=alpine", "--filter", "compute-type=qemu", "--format", "json"},
+		},
+		{
+			name: "should-reject-single-valued-flag-given-twice",
+			given: func(args *CmdArgs) {
+				args.Append("--name", "web")
+				args.Append("--name", "db")
+			},
+			wantArgs:      []string{"--name", "web"},
+			wantConflicts: []string{`key=--name appended=["--name" "web"] conflicting=["--name" "db"]`},
+		},
+		{
+			name: "should-reject-single-valued-and-repeatable-occurrences-of-a-flag",
+			given: func(args *CmdArgs) {
+				args.AppendRepeatable("--filter", "name=web")
+				args.Append("--filter", "os-variant=alpine")
+				args.AppendNoValue("--s3-use-path-style")
+				args.AppendNoValue("--s3-use-path-style")
+			},
+			wantArgs:      []string{"--filter", "name=web", "--s3-use-path-style"},
+			wantConflicts: []string{"key=--filter", "key=--s3-use-path-style"},
+		},
+		{
+			name: "should-mask-secret-of-conflicting-flag",
+			given: func(args *CmdArgs) {
+				args.Append("--license-key", "lk-1")
+				args.Append("--license-key", "lk-2")
+			},
+			wantArgs:      []string{"--license-key", "lk-1"},
+			wantConflicts: []string{`appended=["--license-key" "********"] conflicting=["--license-key" "********"]`},
+		},
+		{
+			name: "should-replace-all-occurrences-by-override",
+			given: func(args *CmdArgs) {
+				args.AppendRepeatable("--filter", "name=web", "name=db")
+				args.Append("--format", "json")
+				args.AppendOverride(NewCmdArg("--format", "yaml"), &deleted)
+			},
+			wantArgs: []string{"--format", "yaml"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := CmdArgs{}
+
+			tt.given(&args)
+
+			require.Equal(t, tt.wantArgs, args.Args())
+			if len(tt.wantConflicts) == 0 {
+				require.NoError(t, args.Err())
+				return
+			}
+			require.Error(t, args.Err())
+			for _, conflict := range tt.wantConflicts {
+				require.Contains(t, args.Err().Error(), conflict)
+			}
+			require.NotContains(t, args.Err().Error(), "lk-")
+		})
+	}
+}
+
+func TestSayaCmdExecRefusesInvalidArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		given   func(cmd *SayaCmd)
+		wantErr string
+	}{
+		{
+			name:    "args-validation-error",
+			given:   func(cmd *SayaCmd) { cmd.appendFlagIfNotBlank("--compte-type", "qemu") },
+			wantErr: "flag not supported by command: cmd=vm run flag=--compte-type",
+		},
+		{
+			name: "conflicting-args",
+			given: func(cmd *SayaCmd) {
+				cmd.appendFlagIfNotBlank("--name", "web")
+				cmd.appendFlagIfNotBlank("--name", "db")
+			},
+			wantErr: "conflicting arg, single-valued args must occur once: key=--name",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executed := false
+			cmd, err := NewCmdVmRun("alpine:v1", RequestSayaCtx{
+				Exe: "saya",
+				Executor: ExecutorFunc(func(ctx context.Context, req ExecRequest) (ExecResult, error) {
+					executed = true
+					return ExecResult{}, nil
+				}),
+			})
+			require.NoError(t, err)
+			tt.given(cmd)
+
+			outcome, err := cmd.Exec(context.Background())
+
+			require.Error(t, err)
+			require.Contains(t, err.Error(), "saya not run, args are invalid")
+			require.Contains(t, err.Error(), tt.wantErr)
+			require.Equal(t, -777, outcome.ExitCode)
+			require.False(t, executed, "saya must not be executed with invalid args")
+		})
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package saya
+
+import (
+	"os"
+	"sort"
+	"strings"
+
+	"golang.org/x/exp/maps"
+)
+
+// minimalEnvAllowList lists the variables inherited from the provider environment when running
+// saya with a minimal environment.
+var minimalEnvAllowList = []string{
+	"HOME", "LANG", "LC_ALL", "LOGNAME", "PATH", "SHELL", "SSL_CERT_DIR", "SSL_CERT_FILE",
+	"TEMP", "TMP", "TMPDIR", "TZ", "USER", "XDG_CACHE_HOME", "XDG_CONFIG_HOME", "XDG_RUNTIME_DIR",
+}
+
+// ExecEnv models the environment of the saya process.
+type ExecEnv struct {
+	Vars       map[string]string // additional variables, overriding the inherited ones
+	HttpProxy  string            // proxy for http requests, sets HTTP_PROXY and http_proxy
+	HttpsProxy string            // proxy for https requests, sets HTTPS_PROXY and https_proxy
+	NoProxy    string            // hosts not to be proxied (e.g. local s3 gateway), sets NO_PROXY and no_proxy
+	Minimal    bool              // true to only inherit the allow-listed variables of the provider environment
+}
+
+func (env *ExecEnv) NormalizeToNil() *ExecEnv {
+	if env == nil {
+		return nil
+	}
+	copy := *env
+	copy.HttpProxy = strings.TrimSpace(copy.HttpProxy)
+	copy.HttpsProxy = strings.TrimSpace(copy.HttpsProxy)
+	copy.NoProxy = strings.TrimSpace(copy.NoProxy)
+	if len(copy.Vars) != 0 {
+		vars := make(map[string]string, len(copy.Vars))
+		for k, v := range copy.Vars {
+			if k = strings.TrimSpace(k); k != "" {
+				vars[k] = v
+			}
+		}
+		copy.Vars = vars
+	}
+	if len(copy.Vars) == 0 {
+		copy.Vars = nil
+	}
+
+	if copy.Vars == nil && copy.HttpProxy == "" && copy.HttpsProxy == "" && copy.NoProxy == "" && !copy.Minimal {
+		return nil
+	}
+	return &copy
+}
+
+// Environ returns the environment of the saya process in the form key=value, sorted by key.
+// Variables are applied in order: inherited (all or allow-listed), proxies, Vars and finally extra,
+// the latter being the variables set by the command itself (e.g. credentials).
+// It returns nil, meaning the provider environment is inherited as is, if there is nothing to customize.
+func (env *ExecEnv) Environ(extra map[string]string) []string {
+	env = env.NormalizeToNil()
+	if env == nil && len(extra) == 0 {
+		return nil
+	}
+	if env == nil {
+		env = &ExecEnv{}
+	}
+
+	vars := map[string]string{}
+	for _, kv := range os.Environ() {
+		k, v, found := strings.Cut(kv, "=")
+		if !found || (env.Minimal && !isMinimalEnvAllowed(k)) {
+			continue
+		}
+		vars[k] = v
+	}
+	for k, v := range env.Overrides(extra) {
+		vars[k] = v
+	}
+
+	keys := maps.Keys(vars)
+	sort.Strings(keys)
+	environ := make([]string, 0, len(keys))
+	for _, k := range keys {
+		environ = append(environ, k+"="+vars[k])
+	}
+	return environ
+}
+
+// Overrides returns the variables set on top of the inherited environment: proxies, Vars and finally extra.
+func (env *ExecEnv) Overrides(extra map[string]string) map[string]string {
+	vars := map[string]string{}
+	env = env.NormalizeToNil()
+	if env != nil {
+		setIfNotBlank := func(val string, keys ...string) {
+			if val == "" {
+				return
+			}
+			for _, k := range keys {
+				vars[k] = val
+			}
+		}
+		setIfNotBlank(env.HttpProxy, "HTTP_PROXY", "http_proxy")
+		setIfNotBlank(env.HttpsProxy, "HTTPS_PROXY", "https_proxy")
+		setIfNotBlank(env.NoProxy, "NO_PROXY", "no_proxy")
+		for k, v := range env.Vars {
+			vars[k] = v
+		}
+	}
+	for k, v := range extra {
+		vars[k] = v
+	}
+	return vars
+}
+
+func isMinimalEnvAllowed(key string) bool {
+	for _, allowed := range minimalEnvAllowList {
+		if key == allowed {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package saya
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecEnvEnviron(t *testing.T) {
+	t.Setenv("PATH", "/usr/bin")
+	t.Setenv("SAYA_TEST_INHERITED", "inherited")
+	t.Setenv("HTTP_PROXY", "http://provider-proxy:3128")
+
+	tests := []struct {
+		name    string
+		env     *ExecEnv
+		extra   map[string]string
+		want    map[string]string
+		wantNot []string
+		wantNil bool
+	}{
+		{
+			name:    "should-inherit-as-is-without-customization",
+			env:     &ExecEnv{Vars: map[string]string{" ": "ignored"}},
+			wantNil: true,
+		},
+		{
+			name: "should-set-proxies-and-vars",
+			env: &ExecEnv{
+				HttpProxy: "http://proxy:3128", HttpsProxy: "http://proxy:3129", NoProxy: "localhost,127.0.0.1",
+				Vars: map[string]string{"SAYA_TEST_VAR": "var"},
+			},
+			want: map[string]string{
+				"HTTP_PROXY": "http://proxy:3128", "http_proxy": "http://proxy:3128",
+				"HTTPS_PROXY": "http://proxy:3129", "https_proxy": "http://proxy:3129",
+				"NO_PROXY": "localhost,127.0.0.1", "no_proxy": "localhost,127.0.0.1",
+				"SAYA_TEST_VAR": "var", "SAYA_TEST_INHERITED": "inherited", "PATH": "/usr/bin",
+			},
+		},
+		{
+			name:    "should-only-inherit-allow-listed-when-minimal",
+			env:     &ExecEnv{Minimal: true},
+			want:    map[string]string{"PATH": "/usr/bin"},
+			wantNot: []string{"SAYA_TEST_INHERITED", "HTTP_PROXY"},
+		},
+		{
+			name:  "should-let-command-vars-win",
+			env:   &ExecEnv{Vars: map[string]string{"AWS_ACCESS_KEY_ID": "from-vars"}},
+			extra: map[string]string{"AWS_ACCESS_KEY_ID": "from-cmd"},
+			want:  map[string]string{"AWS_ACCESS_KEY_ID": "from-cmd"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			environ := tt.env.Environ(tt.extra)
+			if tt.wantNil {
+				require.Nil(t, environ)
+				return
+			}
+			got := map[string]string{}
+			for _, kv := range environ {
+				k, v, _ := strings.Cut(kv, "=")
+				got[k] = v
+			}
+			for k, v := range tt.want {
+				require.Equal(t, v, got[k], "unexpected value: key=%s", k)
+			}
+			for _, k := range tt.wantNot {
+				require.NotContains(t, got, k)
+			}
+		})
+	}
+}
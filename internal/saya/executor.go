@@ -0,0 +1,108 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package saya
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"os/exec"
+
+	stderrors "errors"
+
+	"github.com/pkg/errors"
+)
+
+// Executor runs saya command lines, e.g. as local process, over ssh or replaying recorded executions.
+type Executor interface {
+	// Exec runs the command line; the error is nil only if the command has run successfully.
+	Exec(ctx context.Context, req ExecRequest) (ExecResult, error)
+}
+
+// ExecutorFunc adapts a function to the Executor interface.
+type ExecutorFunc func(ctx context.Context, req ExecRequest) (ExecResult, error)
+
+func (fn ExecutorFunc) Exec(ctx context.Context, req ExecRequest) (ExecResult, error) {
+	return fn(ctx, req)
+}
+
+// ExecRequest is a saya command line execution request.
+type ExecRequest struct {
+	Argv      []string          // command line, including the privilege escalation prefix, e.g. sudo saya vm ls
+	Env       *ExecEnv          // customization of the inherited environment; nil to inherit as is
+	ExtraEnv  map[string]string // additional environment variables, e.g. secrets
+	Stdin     io.Reader         // standard input; nil for none
+	ResultDst string            // local path passed to saya as --result-dst; empty if saya writes no result file
+	Secrets   []string          // secret values handed over through args or environment, to be redacted from anything recorded
+}
+
+// ExecResult is the outcome of a saya execution before secrets are redacted.
+type ExecResult struct {
+	Stdout       string
+	Stderr       string
+	ExitCode     int    // -777 if saya could not be started
+	StartFailure string // why saya could not be started
+	Result       []byte // content of the result file; nil if none has been written
+}
+
+// LocalExecutor runs saya as process on the machine running the provider.
+type LocalExecutor struct{}
+
+func (LocalExecutor) Exec(ctx context.Context, req ExecRequest) (ExecResult, error) {
+	stdout := bytes.Buffer{}
+	stderr := bytes.Buffer{}
+	execCmd := exec.CommandContext(ctx, req.Argv[0], req.Argv[1:]...)
+	execCmd.Stderr = &stderr
+	execCmd.Stdout = &stdout
+	execCmd.Stdin = req.Stdin
+	execCmd.Env = req.Env.Environ(req.ExtraEnv)
+
+	err := execCmd.Run()
+	res := ExecResult{Stdout: stdout.String(), Stderr: stderr.String()}
+	if err != nil {
+		res.ExitCode = -777
+		var exitErr *exec.ExitError
+		if found := stderrors.As(err, &exitErr); found {
+			res.ExitCode = exitErr.ExitCode()
+		} else {
+			res.StartFailure = startFailureReason(err)
+		}
+		return res, err
+	}
+	if req.ResultDst != "" {
+		result, err := os.ReadFile(req.ResultDst)
+		if err != nil && !os.IsNotExist(err) {
+			return res, errors.Wrapf(err, "LocalExecutor.Exec -- fail to read result file: path=%s err=%v", req.ResultDst, err)
+		}
+		res.Result = result
+	}
+	return res, nil
+}
+
+// materializeResult writes the result to the local result destination, if the executor has not already done it,
+// so that it can be decoded from there independently of where saya has run.
+func materializeResult(resultDst string, result []byte) error {
+	if resultDst == "" || result == nil {
+		return nil
+	}
+	if _, err := os.Stat(resultDst); err == nil {
+		return nil
+	}
+	if err := os.WriteFile(resultDst, result, 0600); err != nil {
+		return errors.Wrapf(err, "materializeResult -- fail to write result file: path=%s err=%v", resultDst, err)
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package saya
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	stderrors "errors"
+
+	"github.com/pkg/errors"
+	"golang.org/x/exp/slices"
+)
+
+// ExecRecordResultDst replaces the result destination in recorded command lines, it is a random tmp path.
+const ExecRecordResultDst = "<result-dst>"
+
+// ExecRecord is a recorded saya execution.
+// The environment is not recorded; the secrets passed as args or environment are masked in everything recorded.
+type ExecRecord struct {
+	Argv         []string        `json:"argv"`
+	Stdin        string          `json:"stdin,omitempty"`
+	Stdout       string          `json:"stdout,omitempty"`
+	Stderr       string          `json:"stderr,omitempty"`
+	ExitCode     int             `json:"exit_code"`
+	StartFailure string          `json:"start_failure,omitempty"`
+	Result       json.RawMessage `json:"result,omitempty"` // saya result files are json
+	Err          string          `json:"err,omitempty"`
+}
+
+// recordArgv returns the command line with the result destination replaced by ExecRecordResultDst
+// and the secrets masked.
+func recordArgv(req ExecRequest) []string {
+	argv := make([]string, 0, len(req.Argv))
+	for _, arg := range req.Argv {
+		if req.ResultDst != "" && arg == req.ResultDst {
+			arg = ExecRecordResultDst
+		}
+		argv = append(argv, redactSecrets(arg, req.Secrets))
+	}
+	return argv
+}
+
+// RecordingExecutor records the executions of its delegate.
+type RecordingExecutor struct {
+	Delegate Executor
+
+	mu      sync.Mutex
+	records []ExecRecord
+}
+
+func (e *RecordingExecutor) Exec(ctx context.Context, req ExecRequest) (ExecResult, error) {
+	record := ExecRecord{Argv: recordArgv(req)}
+	if req.Stdin != nil {
+		stdin, err := io.ReadAll(req.Stdin)
+		if err != nil {
+			return ExecResult{ExitCode: -777, StartFailure: "stdin not readable"},
+				errors.Wrapf(err, "RecordingExecutor.Exec -- fail to read stdin: argv=%q err=%v", record.Argv, err)
+		}
+		record.Stdin = redactSecrets(string(stdin), req.Secrets)
+		req.Stdin = strings.NewReader(string(stdin))
+	}
+
+	res, err := e.Delegate.Exec(ctx, req)
+
+	// saya may echo secrets, e.g. in error messages, and the records are saved to disk
+	record.Stdout, record.Stderr = redactSecrets(res.Stdout, req.Secrets), redactSecrets(res.Stderr, req.Secrets)
+	record.ExitCode, record.StartFailure = res.ExitCode, res.StartFailure
+	if res.Result != nil {
+		record.Result = json.RawMessage(redactSecrets(string(res.Result), req.Secrets))
+	}
+	if err != nil {
+		record.Err = redactSecrets(err.Error(), req.Secrets)
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.records = append(e.records, record)
+	return res, err
+}
+
+// Records returns the executions recorded so far.
+func (e *RecordingExecutor) Records() []ExecRecord {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return slices.Clone(e.records)
+}
+
+// Save writes the recorded executions as json file, to be loaded by LoadExecRecords.
+func (e *RecordingExecutor) Save(path string) error {
+	recordsJson, err := json.MarshalIndent(e.Records(), "", "  ")
+	if err != nil {
+		return errors.Wrapf(err, "RecordingExecutor.Save -- fail to marshal records: path=%s err=%v", path, err)
+	}
+	if err := os.WriteFile(path, recordsJson, 0600); err != nil {
+		return errors.Wrapf(err, "RecordingExecutor.Save -- fail to write records: path=%s err=%v", path, err)
+	}
+	return nil
+}
+
+// LoadExecRecords reads executions saved by RecordingExecutor.Save.
+func LoadExecRecords(path string) ([]ExecRecord, error) {
+	recordsJson, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "LoadExecRecords -- fail to read records: path=%s err=%v", path, err)
+	}
+	records := []ExecRecord{}
+	if err := json.Unmarshal(recordsJson, &records); err != nil {
+		return nil, errors.Wrapf(err, "LoadExecRecords -- fail to unmarshal records: path=%s err=%v", path, err)
+	}
+	return records, nil
+}
+
+// ReplayExecutor replays recorded executions instead of running saya.
+// Each record is replayed once, for the first execution with the same command line and stdin.
+type ReplayExecutor struct {
+	mu       sync.Mutex
+	records  []ExecRecord
+	replayed []bool
+}
+
+func NewReplayExecutor(records ...ExecRecord) *ReplayExecutor {
+	return &ReplayExecutor{records: records, replayed: make([]bool, len(records))}
+}
+
+func (e *ReplayExecutor) Exec(ctx context.Context, req ExecRequest) (ExecResult, error) {
+	argv := recordArgv(req)
+	stdin := ""
+	if req.Stdin != nil {
+		stdinBytes, err := io.ReadAll(req.Stdin)
+		if err != nil {
+			return ExecResult{ExitCode: -777, StartFailure: "stdin not readable"},
+				errors.Wrapf(err, "ReplayExecutor.Exec -- fail to read stdin: argv=%q err=%v", argv, err)
+		}
+		stdin = redactSecrets(string(stdinBytes), req.Secrets)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for i, record := range e.records {
+		if e.replayed[i] || !slices.Equal(record.Argv, argv) || record.Stdin != stdin {
+			continue
+		}
+		e.replayed[i] = true
+		res := ExecResult{
+			Stdout:       record.Stdout,
+			Stderr:       record.Stderr,
+			ExitCode:     record.ExitCode,
+			StartFailure: record.StartFailure,
+		}
+		if record.Result != nil {
+			res.Result = slices.Clone([]byte(record.Result))
+		}
+		if record.Err != "" {
+			return res, stderrors.New(record.Err)
+		}
+		return res, nil
+	}
+	return ExecResult{ExitCode: -777, StartFailure: "no recorded execution"},
+		errors.Errorf("ReplayExecutor.Exec -- no recorded execution left for the command line: argv=%q", argv)
+}
+
+// Unreplayed returns the records not replayed yet, e.g. to check that all expected executions took place.
+func (e *ReplayExecutor) Unreplayed() []ExecRecord {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	unreplayed := []ExecRecord{}
+	for i, record := range e.records {
+		if !e.replayed[i] {
+			unreplayed = append(unreplayed, record)
+		}
+	}
+	return unreplayed
+}
@@ -0,0 +1,116 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package saya
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/congop/terraform-provider-saya/internal/opaque"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordAndReplayExecutions(t *testing.T) {
+	ctx := context.Background()
+	vmLsResult := `[{"id":"vm-1","name":"web","arch":"amd64","os":"linux","base_img":"webserver:v1:ova","compute_type":"qemu","status":"running"}]`
+	gotExtraEnv := map[string]string{}
+	recorder := &RecordingExecutor{Delegate: ExecutorFunc(func(ctx context.Context, req ExecRequest) (ExecResult, error) {
+		gotExtraEnv = req.ExtraEnv
+		return ExecResult{Stdout: "listed", Result: []byte(vmLsResult)}, nil
+	})}
+	req := VmLsRequest{
+		Name:           "web",
+		RequestSayaCtx: RequestSayaCtx{Exe: "saya", LicenseKey: *opaque.NewString("lk-secret"), Executor: recorder},
+	}
+
+	recorded, err := VmLs(ctx, req)
+
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"SAYA_LICENSE_KEY": "lk-secret"}, gotExtraEnv)
+	wantVms := []VmLsResult{{
+		Id: "vm-1", Name: "web", Arch: "amd64", Os: "linux", BaseImg: "webserver:v1:ova", ComputeType: "qemu", State: "running",
+	}}
+	require.Equal(t, wantVms, recorded)
+	recordsPath := filepath.Join(t.TempDir(), "records.json")
+	require.NoError(t, recorder.Save(recordsPath))
+	records, err := LoadExecRecords(recordsPath)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	require.Equal(t,
+		[]string{"saya", "vm", "ls", "--format", "json", "--result-dst", ExecRecordResultDst, "--filter", "name=web"},
+		records[0].Argv)
+
+	replayer := NewReplayExecutor(records...)
+	req.Executor = replayer
+
+	replayed, err := VmLs(ctx, req)
+
+	require.NoError(t, err)
+	require.Equal(t, wantVms, replayed)
+	require.Empty(t, replayer.Unreplayed())
+
+	_, err = VmLs(ctx, req)
+	require.Error(t, err, "each record must only be replayed once")
+	require.Contains(t, err.Error(), "no recorded execution left")
+}
+
+func TestReplayExecutorReplaysFailure(t *testing.T) {
+	replayer := NewReplayExecutor(ExecRecord{
+		Argv:     []string{"saya", "vm", "start", "web"},
+		Stderr:   "vm not found: lk-secret",
+		ExitCode: 3,
+		Err:      "exit status 3",
+	})
+	cmd, err := NewCmdVmStart("web", RequestSayaCtx{
+		Exe: "saya", LicenseKey: *opaque.NewString("lk-secret"), Executor: replayer,
+	})
+	require.NoError(t, err)
+
+	outcome, err := cmd.Exec(context.Background())
+
+	require.Error(t, err)
+	require.Equal(t, 3, outcome.ExitCode)
+	require.NotContains(t, outcome.Stderr, "lk-secret", "replayed outputs must be redacted as well")
+}
+
+func TestRecordingExecutorMasksSecrets(t *testing.T) {
+	recorder := &RecordingExecutor{Delegate: ExecutorFunc(func(ctx context.Context, req ExecRequest) (ExecResult, error) {
+		return ExecResult{Stdout: "using lk-secret", Stderr: "bad key: lk-secret", ExitCode: 1, Result: []byte(`{"key":"lk-secret"}`)},
+			errors.New("saya failed with lk-secret")
+	})}
+	cmd, err := NewCmdVmStart("web", RequestSayaCtx{
+		Exe: "saya", LicenseKey: *opaque.NewString("lk-secret"), SecretsAsArgs: true, Executor: recorder,
+	})
+	require.NoError(t, err)
+
+	_, err = cmd.Exec(context.Background())
+
+	require.Error(t, err)
+	records := recorder.Records()
+	require.Len(t, records, 1)
+	require.Equal(t, []string{"saya", "vm", "start", "web", "--license-key", "********"}, records[0].Argv)
+	recordJson, err := json.Marshal(records[0])
+	require.NoError(t, err)
+	require.NotContains(t, string(recordJson), "lk-secret", "secrets must not be recorded")
+
+	replayer := NewReplayExecutor(records...)
+	cmd.executor = replayer
+	_, err = cmd.Exec(context.Background())
+	require.Error(t, err)
+	require.Empty(t, replayer.Unreplayed(), "masked records must be replayed")
+}
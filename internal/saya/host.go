@@ -0,0 +1,262 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package saya
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/congop/terraform-provider-saya/internal/log"
+	"golang.org/x/exp/slices"
+)
+
+const (
+	ComputeTypeQemu       = "qemu"
+	ComputeTypeVirtualbox = "virtualbox"
+)
+
+// HostProblemSeverity tells whether a host problem prevents saya from working.
+type HostProblemSeverity string
+
+const (
+	HostProblemError   HostProblemSeverity = "error"
+	HostProblemWarning HostProblemSeverity = "warning"
+)
+
+// HostProblem is a problem found while inspecting the host.
+type HostProblem struct {
+	Severity HostProblemSeverity
+	Summary  string
+	Detail   string
+}
+
+func (p HostProblem) String() string {
+	return fmt.Sprintf("%s: %s -- %s", p.Severity, p.Summary, p.Detail)
+}
+
+// HostInfo reports whether the host is ready to run saya.
+type HostInfo struct {
+	Exe           string // saya exe command or path, as configured
+	ExePath       string // resolved path of the saya exe; blank if not found
+	ExeFound      bool
+	ExeExecutable bool
+
+	Forge         string // forge location, as configured; blank for the saya default
+	ForgeExists   *bool  // nil if the forge location is not configured
+	ForgeWritable *bool  // nil if the forge location is not configured
+
+	ComputeTypes []string // installed compute types, e.g. qemu, virtualbox
+	KvmAvailable bool     // true if /dev/kvm can be used for qemu hardware acceleration
+	Platform     Platform // host platform
+
+	Problems []HostProblem
+}
+
+// HasErrors returns true if a problem prevents saya from working.
+func (info *HostInfo) HasErrors() bool {
+	for _, p := range info.Problems {
+		if p.Severity == HostProblemError {
+			return true
+		}
+	}
+	return false
+}
+
+func (info *HostInfo) addProblem(severity HostProblemSeverity, summary string, detailFormat string, args ...any) {
+	info.Problems = append(info.Problems, HostProblem{
+		Severity: severity,
+		Summary:  summary,
+		Detail:   fmt.Sprintf(detailFormat, args...),
+	})
+}
+
+// variables so tests can simulate hosts
+var (
+	lookPath      = exec.LookPath
+	kvmDevicePath = "/dev/kvm"
+)
+
+// computeTypeExes lists, per compute type, the executables of which one must be found for the compute type
+// to be considered installed.
+func computeTypeExes(platform Platform) map[string][]string {
+	qemuArch, found := map[string]string{"amd64": "x86_64", "arm64": "aarch64", "386": "i386"}[platform.Arch]
+	if !found {
+		qemuArch = platform.Arch
+	}
+	return map[string][]string{
+		ComputeTypeQemu:       {"qemu-system-" + qemuArch},
+		ComputeTypeVirtualbox: {"VBoxManage", "vboxmanage"},
+	}
+}
+
+// InspectHost checks the saya exe, the forge, the installed compute types and kvm availability.
+// It never fails, problems are reported in HostInfo.Problems.
+func InspectHost(ctx context.Context, req RequestSayaCtx) HostInfo {
+	info := HostInfo{
+		Exe:   strings.TrimSpace(req.Exe),
+		Forge: strings.TrimSpace(req.Forge),
+	}
+	if info.Exe == "" {
+		info.Exe = "saya"
+	}
+
+	if platform, err := PlatformNormalized(""); err != nil {
+		info.addProblem(HostProblemWarning, "fail to detect the host platform", "%v", err)
+	} else {
+		info.Platform = *platform
+	}
+
+	inspectExe(&info)
+	inspectForge(&info)
+	inspectComputeTypes(&info, req.Env.Overrides(nil)["PATH"])
+	inspectKvm(&info)
+
+	log.Debugf(ctx, "InspectHost -- host inspected: info=%#v", info)
+	return info
+}
+
+func inspectExe(info *HostInfo) {
+	if !strings.ContainsRune(info.Exe, filepath.Separator) && !strings.ContainsRune(info.Exe, '/') {
+		exePath, err := lookPath(info.Exe)
+		if err != nil {
+			info.addProblem(HostProblemError, "saya executable not found",
+				"no executable named %s found in PATH: PATH=%s err=%v", info.Exe, os.Getenv("PATH"), err)
+			return
+		}
+		info.ExePath, info.ExeFound, info.ExeExecutable = exePath, true, true
+		return
+	}
+
+	stat, err := os.Stat(info.Exe)
+	if err != nil {
+		info.addProblem(HostProblemError, "saya executable not found",
+			"saya executable path cannot be accessed: path=%s err=%v", info.Exe, err)
+		return
+	}
+	info.ExePath, info.ExeFound = info.Exe, true
+	if stat.IsDir() {
+		info.addProblem(HostProblemError, "saya executable is a directory", "path=%s", info.Exe)
+		return
+	}
+	if runtime.GOOS != "windows" && stat.Mode().Perm()&0111 == 0 {
+		info.addProblem(HostProblemError, "saya executable is not executable",
+			"the file has no execute permission: path=%s mode=%s", info.Exe, stat.Mode())
+		return
+	}
+	info.ExeExecutable = true
+}
+
+func inspectForge(info *HostInfo) {
+	if info.Forge == "" {
+		return
+	}
+	exists, writable := false, false
+	info.ForgeExists, info.ForgeWritable = &exists, &writable
+
+	stat, err := os.Stat(info.Forge)
+	switch {
+	case os.IsNotExist(err):
+		// saya creates the forge, which requires the closest existing parent to be writable
+		parent := filepath.Dir(filepath.Clean(info.Forge))
+		for ; ; parent = filepath.Dir(parent) {
+			if _, err := os.Stat(parent); err == nil || parent == filepath.Dir(parent) {
+				break
+			}
+		}
+		if !isDirWritable(parent) {
+			info.addProblem(HostProblemError, "forge directory cannot be created",
+				"the forge does not exist and its parent directory is not writable: forge=%s parent=%s",
+				info.Forge, parent)
+		}
+		return
+	case err != nil:
+		info.addProblem(HostProblemError, "forge directory cannot be accessed", "forge=%s err=%v", info.Forge, err)
+		return
+	case !stat.IsDir():
+		info.addProblem(HostProblemError, "forge is not a directory", "forge=%s", info.Forge)
+		return
+	}
+	exists = true
+	writable = isDirWritable(info.Forge)
+	if !writable {
+		info.addProblem(HostProblemError, "forge directory is not writable", "forge=%s", info.Forge)
+	}
+}
+
+// isDirWritable checks writability by creating a file, permission bits do not tell the whole story (e.g. read-only mounts).
+func isDirWritable(dir string) bool {
+	f, err := os.CreateTemp(dir, ".saya-preflight-*")
+	if err != nil {
+		return false
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return true
+}
+
+// inspectComputeTypes looks the compute type executables up in pathEnv, the PATH saya runs with;
+// in the PATH of the provider if blank.
+func inspectComputeTypes(info *HostInfo, pathEnv string) {
+	exesByComputeType := computeTypeExes(info.Platform)
+	for _, computeType := range []string{ComputeTypeQemu, ComputeTypeVirtualbox} {
+		for _, exe := range exesByComputeType[computeType] {
+			if _, err := lookPathIn(exe, pathEnv); err == nil {
+				info.ComputeTypes = append(info.ComputeTypes, computeType)
+				break
+			}
+		}
+	}
+	if len(info.ComputeTypes) == 0 {
+		info.addProblem(HostProblemWarning, "no compute type installed",
+			"neither qemu nor virtualbox has been found, vms cannot be run: looked-up=%v", exesByComputeType)
+	}
+}
+
+// lookPathIn looks the executable up in the directories of pathEnv; in the PATH of the provider if blank.
+func lookPathIn(exe string, pathEnv string) (string, error) {
+	if pathEnv == "" {
+		return lookPath(exe)
+	}
+	for _, dir := range filepath.SplitList(pathEnv) {
+		if dir == "" {
+			continue
+		}
+		if exePath, err := lookPath(filepath.Join(dir, exe)); err == nil {
+			return exePath, nil
+		}
+	}
+	return "", &exec.Error{Name: exe, Err: exec.ErrNotFound}
+}
+
+func inspectKvm(info *HostInfo) {
+	if info.Platform.Os != "linux" {
+		return
+	}
+	f, err := os.OpenFile(kvmDevicePath, os.O_RDWR, 0)
+	if err != nil {
+		if slices.Contains(info.ComputeTypes, ComputeTypeQemu) {
+			info.addProblem(HostProblemWarning, "kvm not available",
+				"qemu vms will run without hardware acceleration: device=%s err=%v", kvmDevicePath, err)
+		}
+		return
+	}
+	f.Close()
+	info.KvmAvailable = true
+}
@@ -0,0 +1,184 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package saya
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func givenHost(t *testing.T, exes map[string]string, kvm bool) {
+	origLookPath, origKvmDevicePath := lookPath, kvmDevicePath
+	t.Cleanup(func() { lookPath, kvmDevicePath = origLookPath, origKvmDevicePath })
+
+	lookPath = func(file string) (string, error) {
+		if p, found := exes[file]; found {
+			return p, nil
+		}
+		return "", &exec.Error{Name: file, Err: exec.ErrNotFound}
+	}
+	kvmDevicePath = filepath.Join(t.TempDir(), "kvm")
+	if kvm {
+		require.NoError(t, os.WriteFile(kvmDevicePath, nil, 0600))
+	}
+}
+
+func problemSummaries(info HostInfo) []string {
+	summaries := []string{}
+	for _, p := range info.Problems {
+		summaries = append(summaries, string(p.Severity)+": "+p.Summary)
+	}
+	return summaries
+}
+
+func TestInspectHost(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("host inspection tests simulate a linux host")
+	}
+	dir := t.TempDir()
+	notExecutable := filepath.Join(dir, "saya-not-executable")
+	require.NoError(t, os.WriteFile(notExecutable, []byte("#!/bin/sh"), 0600))
+	executable := filepath.Join(dir, "saya-executable")
+	require.NoError(t, os.WriteFile(executable, []byte("#!/bin/sh"), 0700))
+	forgeFile := filepath.Join(dir, "forge-file")
+	require.NoError(t, os.WriteFile(forgeFile, nil, 0600))
+
+	platform, err := PlatformNormalized("")
+	require.NoError(t, err)
+	qemuExe := computeTypeExes(*platform)[ComputeTypeQemu][0]
+
+	tests := []struct {
+		name             string
+		req              RequestSayaCtx
+		exes             map[string]string
+		kvm              bool
+		wantProblems     []string
+		wantExePath      string
+		wantComputeTypes []string
+		wantKvm          bool
+		wantForgeExists  *bool
+	}{
+		{
+			name:             "should-report-healthy-host",
+			req:              RequestSayaCtx{Exe: "saya", Forge: dir},
+			exes:             map[string]string{"saya": "/usr/bin/saya", qemuExe: "/usr/bin/" + qemuExe, "VBoxManage": "/usr/bin/VBoxManage"},
+			kvm:              true,
+			wantProblems:     []string{},
+			wantExePath:      "/usr/bin/saya",
+			wantComputeTypes: []string{ComputeTypeQemu, ComputeTypeVirtualbox},
+			wantKvm:          true,
+			wantForgeExists:  newBool(true),
+		},
+		{
+			name:         "should-report-exe-not-in-path",
+			req:          RequestSayaCtx{},
+			exes:         map[string]string{qemuExe: "/usr/bin/" + qemuExe},
+			kvm:          true,
+			wantProblems: []string{"error: saya executable not found"},
+			wantKvm:      true,
+			wantComputeTypes: []string{
+				ComputeTypeQemu,
+			},
+		},
+		{
+			name:             "should-report-missing-exe-path",
+			req:              RequestSayaCtx{Exe: filepath.Join(dir, "none")},
+			exes:             map[string]string{"VBoxManage": "/usr/bin/VBoxManage"},
+			wantProblems:     []string{"error: saya executable not found"},
+			wantComputeTypes: []string{ComputeTypeVirtualbox},
+		},
+		{
+			name:         "should-report-not-executable-exe-and-no-compute-type",
+			req:          RequestSayaCtx{Exe: notExecutable},
+			wantProblems: []string{"error: saya executable is not executable", "warning: no compute type installed"},
+			wantExePath:  notExecutable,
+		},
+		{
+			name:             "should-report-qemu-without-kvm",
+			req:              RequestSayaCtx{Exe: executable},
+			exes:             map[string]string{qemuExe: "/usr/bin/" + qemuExe},
+			wantProblems:     []string{"warning: kvm not available"},
+			wantExePath:      executable,
+			wantComputeTypes: []string{ComputeTypeQemu},
+		},
+		{
+			name:             "should-accept-forge-to-be-created",
+			req:              RequestSayaCtx{Exe: executable, Forge: filepath.Join(dir, "new", "forge")},
+			exes:             map[string]string{"VBoxManage": "/usr/bin/VBoxManage"},
+			wantProblems:     []string{},
+			wantExePath:      executable,
+			wantComputeTypes: []string{ComputeTypeVirtualbox},
+			wantForgeExists:  newBool(false),
+		},
+		{
+			name: "should-look-compute-types-up-in-the-path-saya-runs-with",
+			req: RequestSayaCtx{Exe: executable, Env: &ExecEnv{Vars: map[string]string{
+				"PATH": "/opt/qemu/bin" + string(filepath.ListSeparator) + "/opt/other/bin"}}},
+			exes: map[string]string{
+				"/opt/qemu/bin/" + qemuExe: "/opt/qemu/bin/" + qemuExe,
+				"VBoxManage":               "/usr/bin/VBoxManage",
+			},
+			kvm:              true,
+			wantProblems:     []string{},
+			wantExePath:      executable,
+			wantComputeTypes: []string{ComputeTypeQemu},
+			wantKvm:          true,
+		},
+		{
+			name:             "should-report-forge-not-a-directory",
+			req:              RequestSayaCtx{Exe: executable, Forge: forgeFile},
+			exes:             map[string]string{"VBoxManage": "/usr/bin/VBoxManage"},
+			wantProblems:     []string{"error: forge is not a directory"},
+			wantExePath:      executable,
+			wantComputeTypes: []string{ComputeTypeVirtualbox},
+			wantForgeExists:  newBool(false),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			givenHost(t, tt.exes, tt.kvm)
+
+			info := InspectHost(context.Background(), tt.req)
+
+			require.Equal(t, tt.wantProblems, problemSummaries(info))
+			require.Equal(t, tt.wantExePath, info.ExePath)
+			require.Equal(t, tt.wantComputeTypes, info.ComputeTypes)
+			require.Equal(t, tt.wantKvm, info.KvmAvailable)
+			require.Equal(t, tt.wantForgeExists, info.ForgeExists)
+			require.Equal(t, *platform, info.Platform)
+		})
+	}
+}
+
+func TestSayaCmdExecReportsStartFailure(t *testing.T) {
+	cmd, err := NewCmdVersion(RequestSayaCtx{Exe: filepath.Join(t.TempDir(), "none", "saya")})
+	require.NoError(t, err)
+
+	outcome, err := cmd.Exec(context.Background())
+
+	require.Error(t, err)
+	require.Equal(t, -777, outcome.ExitCode)
+	require.Contains(t, err.Error(), "fail to start saya, executable does not exist")
+}
+
+func newBool(b bool) *bool {
+	return &b
+}
@@ -34,12 +34,10 @@ func ImageRm(ctx context.Context, req ImageDeleteRequest) error {
 	if err != nil {
 		return err
 	}
-	cmd, err := NewCmdImgRm(req.Exe, req.RequestSayaCtx)
+	cmd, err := NewCmdImgRm(ref.Normalized(), req.RequestSayaCtx)
 	if err != nil {
 		return err
 	}
-	cmd.WithRef(ref.Normalized())
-
 	cmd.appendFlagIfNotBlank("--img-type", req.ImgType)
 	cmd.appendFlagIfNotBlank("--platform", req.Platform)
 
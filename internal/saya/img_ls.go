@@ -57,14 +57,10 @@ func Ls(ctx context.Context, req LsRequest) ([]LsResult, error) {
 		}
 		refNormalized = ref.Normalized()
 	}
-	cmd, err := NewCmdImgLs(req.Exe, req.RequestSayaCtx)
+	cmd, err := NewCmdImgLs(refNormalized, req.RequestSayaCtx)
 	if err != nil {
 		return nil, err
 	}
-	if refNormalized != "" {
-		cmd.WithRef(refNormalized)
-	}
-
 	// cmd.appendFlagIfNotBlank("--hash", req.Hash)
 	// saya image ls --filter img-type=qcow2 --filter reference='appserver:v1*'
 	// --filter os-variant=alpine --filter 'label=audience=tester'
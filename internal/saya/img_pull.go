@@ -34,11 +34,7 @@ type PullRequest struct {
 	HttpRepo *HttpRepo
 	S3Repo   *S3Repo
 
-	Exe        string        // saya executable command or path
-	Config     string        // saya executable command or path
-	Forge      string        // forge(local image store) location
-	LicenseKey opaque.String // License key
-	LogLevel   string        // log level error|warn|info|debug|trace
+	RequestSayaCtx
 }
 
 type PullResult struct {
@@ -56,24 +52,17 @@ func Pull(ctx context.Context, req PullRequest) (*PullResult, error) {
 	if err != nil {
 		return nil, err
 	}
-	cmd, err := NewCmdImgPull(req.Exe)
+	cmd, err := NewCmdImgPull(ref.Normalized(), req.RequestSayaCtx)
 	if err != nil {
 		return nil, err
 	}
-	cmd.WithRef(ref.Normalized())
-
-	cmd.WithCfgFile(req.Config)
-	cmd.WithForgeLocation(req.Forge)
-	cmd.WithLicenseKey(req.LicenseKey)
-	cmd.WithLogLevel(req.LogLevel)
-
 	cmd.appendFlagIfNotBlank("--hash", req.Hash)
 	cmd.appendFlagIfNotBlank("--img-type", req.ImgType)
 	cmd.appendFlagIfNotBlank("--platform", req.Platform)
 	cmd.appendFlagIfNotBlank("--repo-type", req.RepoType)
 
 	if repo := req.HttpRepo; repo != nil {
-		cmd.appendFlagIfNotBlank("--http-auth-basic-password", repo.AuthHttpBasic.Pwd)
+		cmd.appendSecretIfNotBlank("--http-auth-basic-password", repo.AuthHttpBasic.Pwd)
 		cmd.appendFlagIfNotBlank("--http-auth-basic-username", repo.AuthHttpBasic.Username)
 		cmd.appendFlagIfNotBlank("--http-base-path", repo.BasePath)
 		cmd.appendFlagIfNotBlank("--http-repo-url", repo.RepoUrl)
@@ -81,21 +70,23 @@ func Pull(ctx context.Context, req PullRequest) (*PullResult, error) {
 	}
 
 	if repo := req.S3Repo; repo != nil {
-		if cred := repo.AuthAwsCreds; cred != nil {
-			cmd.appendFlagIfNotBlank("--aws-access-key-id", cred.AccessKeyID)
-			cmd.appendFlagIfNotBlank("--aws-secret-access-key", cred.SecretAccessKey)
-
-			// TODO not supported yet by saya cli
-			// cmd.appendFlagIfNotBlank("--session-token", cred.SessionToken)
-			// cmd.appendFlagIfNotBlank("--aws-source", cred.Source)
-			// if cred.CanExpire {
-			// 	cmd.appendFlagIfNotBlank("--aws-can-expire", "true")
-			// }
-			// cmd.appendFlagIfNotBlank("--aws-expires", cred.Expires.Format(time.RFC3339))
+		cred, resolvedByProvider, err := repo.ResolveCredentials(ctx)
+		if err != nil {
+			return nil, err
 		}
-		if repo.UsePathStyle {
-			cmd.Args.AppendNoValue("--s3-use-path-style")
+		if cred != nil && resolvedByProvider {
+			// resolved credentials are usually temporary ones, saya cli only supports session token
+			// through the environment.
+			cmd.WithEnv("AWS_ACCESS_KEY_ID", *opaque.NewString(cred.AccessKeyID))
+			cmd.WithEnv("AWS_SECRET_ACCESS_KEY", cred.SecretAccessKey)
+			cmd.WithEnv("AWS_SESSION_TOKEN", cred.SessionToken)
+		} else if cred != nil {
+			cmd.appendFlagIfNotBlank("--aws-access-key-id", cred.AccessKeyID)
+			cmd.appendSecretIfNotBlank("--aws-secret-access-key", cred.SecretAccessKey)
+			// saya has no session token flag, temporary static keys authenticate with the token from the environment
+			cmd.WithEnv("AWS_SESSION_TOKEN", cred.SessionToken)
 		}
+		cmd.appendSwitchIf("--s3-use-path-style", repo.UsePathStyle)
 		cmd.appendFlagIfNotBlank("--aws-ep-url", repo.EpUrl)
 		cmd.appendFlagIfNotBlank("--aws-ep-url-s3", repo.EpUrlS3)
 		cmd.appendFlagIfNotBlank("--aws-region", repo.Region)
@@ -0,0 +1,114 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package saya
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/congop/terraform-provider-saya/internal/opaque"
+	"github.com/hashicorp/terraform-plugin-log/tflogtest"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSayaEchoingSecrets echoes its args and the secret environment variables, as a misbehaving saya would.
+const fakeSayaEchoingSecrets = `#!/bin/sh
+echo "args: $*"
+echo "env: $SAYA_HTTP_AUTH_BASIC_PASSWORD $SAYA_LICENSE_KEY $AWS_SECRET_ACCESS_KEY" >&2
+exit %d
+`
+
+func TestPullDoesNotLeakSecrets(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake saya is a shell script")
+	}
+	const pwd = "http-pwd-d3adb33f"
+	const licenseKey = "license-key-c0ffee"
+	const secretAccessKey = "aws-secret-f00d"
+
+	tests := []struct {
+		name          string
+		exitCode      int
+		secretsAsArgs bool
+		s3            bool
+	}{
+		{name: "failing-saya-secrets-in-env", exitCode: 3},
+		{name: "failing-saya-secrets-in-args", exitCode: 3, secretsAsArgs: true},
+		{name: "succeeding-saya-secrets-in-args", exitCode: 0, secretsAsArgs: true},
+		{name: "failing-saya-s3-secrets-in-args", exitCode: 3, secretsAsArgs: true, s3: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sayaExe := writeTestFile(t, t.TempDir(), "saya", []byte(fmt.Sprintf(fakeSayaEchoingSecrets, tt.exitCode)))
+			require.NoError(t, os.Chmod(sayaExe, 0700))
+
+			logs := bytes.Buffer{}
+			ctx := tflogtest.RootLogger(context.Background(), &logs)
+
+			req := PullRequest{
+				Name:     "ubuntu:v1",
+				RepoType: "http",
+				HttpRepo: &HttpRepo{
+					RepoUrl:       "http://127.0.0.1:1",
+					AuthHttpBasic: AuthHttpBasic{Username: "user", Pwd: *opaque.NewString(pwd)},
+				},
+				RequestSayaCtx: RequestSayaCtx{
+					Exe:           sayaExe,
+					LicenseKey:    *opaque.NewString(licenseKey),
+					SecretsAsArgs: tt.secretsAsArgs,
+				},
+			}
+			if tt.s3 {
+				req.RepoType = "s3"
+				req.HttpRepo = nil
+				req.S3Repo = &S3Repo{
+					Bucket: "bucket",
+					AuthAwsCreds: &AwsCredentials{
+						AccessKeyID: "AKID", SecretAccessKey: *opaque.NewString(secretAccessKey),
+					},
+				}
+			}
+
+			_, err := Pull(ctx, req)
+			require.Error(t, err, "fake saya does not produce any result")
+
+			for _, secret := range []string{pwd, licenseKey, secretAccessKey} {
+				require.NotContains(t, logs.String(), secret, "secret leaked into tflog")
+				require.NotContains(t, err.Error(), secret, "secret leaked into error")
+				require.NotContains(t, fmt.Sprintf("%+v", err), secret, "secret leaked into error details")
+			}
+		})
+	}
+}
+
+func TestSayaCmdRedact(t *testing.T) {
+	cmd, err := NewCmdImgPull("alpine:v1", RequestSayaCtx{Exe: "saya"})
+	require.NoError(t, err)
+	cmd.Args.Append("--http-auth-basic-password", "pwd")
+	cmd.Args.AppendCmdArgs(&CmdArgOpaqueStr{K: "--opaque", V: opaque.NewString("opaque-value")})
+	cmd.WithEnv("SAYA_LICENSE_KEY", *opaque.NewString("pwd-and-more"))
+	cmd.appendFlagIfNotBlank("--repo-type", "http")
+
+	require.Equal(t,
+		"******** ******** ******** http",
+		cmd.Redact("pwd opaque-value pwd-and-more http"))
+	require.Equal(t,
+		[]string{"image", "pull", "alpine:v1", "--http-auth-basic-password", "********", "--opaque", "********", "--repo-type", "http"},
+		cmd.Args.ArgsDisplay())
+}
@@ -0,0 +1,349 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package saya
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	stderrors "errors"
+
+	"github.com/congop/terraform-provider-saya/internal/opaque"
+	"github.com/pkg/errors"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"golang.org/x/exp/maps"
+)
+
+const (
+	sshDefaultPort   = "22"
+	sshDefaultTmpDir = "/tmp"
+)
+
+// SshHost is a remote machine saya is executed on over ssh.
+// Paths passed to saya (config, forge, certificates, etc.) refer to the remote machine.
+type SshHost struct {
+	Address        string        // host[:port]; the port defaults to 22
+	User           string        // ssh user
+	PrivateKey     opaque.String // pem encoded private key; conflicts with PrivateKeyFile
+	PrivateKeyFile string        // path of the pem encoded private key
+	KnownHosts     string        // known_hosts formatted host keys; conflicts with KnownHostsFile
+	KnownHostsFile string        // path of a known_hosts file; defaults to ~/.ssh/known_hosts if KnownHosts is blank
+	TmpDir         string        // remote directory where saya writes result files; defaults to /tmp
+}
+
+func (h *SshHost) NormalizeToNil() *SshHost {
+	if h == nil {
+		return nil
+	}
+	copy := *h
+	copy.Address = strings.TrimSpace(copy.Address)
+	copy.User = strings.TrimSpace(copy.User)
+	copy.PrivateKey.Normalize()
+	copy.PrivateKeyFile = strings.TrimSpace(copy.PrivateKeyFile)
+	copy.KnownHosts = strings.TrimSpace(copy.KnownHosts)
+	copy.KnownHostsFile = strings.TrimSpace(copy.KnownHostsFile)
+	copy.TmpDir = strings.TrimSpace(copy.TmpDir)
+	if copy.Address == "" && copy.User == "" && copy.PrivateKey.Value() == "" && copy.PrivateKeyFile == "" &&
+		copy.KnownHosts == "" && copy.KnownHostsFile == "" && copy.TmpDir == "" {
+		return nil
+	}
+	if copy.TmpDir == "" {
+		copy.TmpDir = sshDefaultTmpDir
+	}
+	return &copy
+}
+
+// Validate returns an error if the ssh host settings are incomplete or conflicting.
+func (h *SshHost) Validate() error {
+	switch {
+	case h.Address == "":
+		return errors.Errorf("SshHost.Validate -- address must not be blank")
+	case h.User == "":
+		return errors.Errorf("SshHost.Validate -- user must not be blank: address=%s", h.Address)
+	case h.PrivateKey.Value() == "" && h.PrivateKeyFile == "":
+		return errors.Errorf("SshHost.Validate -- one of private key or private key file must be set: address=%s", h.Address)
+	case h.PrivateKey.Value() != "" && h.PrivateKeyFile != "":
+		return errors.Errorf("SshHost.Validate -- private key and private key file are conflicting: address=%s", h.Address)
+	case h.KnownHosts != "" && h.KnownHostsFile != "":
+		return errors.Errorf("SshHost.Validate -- known hosts and known hosts file are conflicting: address=%s", h.Address)
+	}
+	return nil
+}
+
+func (h *SshHost) addressWithPort() string {
+	if _, _, err := net.SplitHostPort(h.Address); err == nil {
+		return h.Address
+	}
+	return net.JoinHostPort(strings.Trim(h.Address, "[]"), sshDefaultPort)
+}
+
+func (h *SshHost) signer() (ssh.Signer, error) {
+	keyPem := []byte(h.PrivateKey.Value())
+	if h.PrivateKeyFile != "" {
+		var err error
+		if keyPem, err = os.ReadFile(h.PrivateKeyFile); err != nil {
+			return nil, errors.Wrapf(err, "SshHost.signer -- fail to read private key file: path=%s err=%v", h.PrivateKeyFile, err)
+		}
+	}
+	signer, err := ssh.ParsePrivateKey(keyPem)
+	if err != nil {
+		// the error never contains the key
+		return nil, errors.Wrapf(err, "SshHost.signer -- fail to parse private key: path=%s err=%v", h.PrivateKeyFile, err)
+	}
+	return signer, nil
+}
+
+// hostKeyCallback verifies the host key against the known hosts; unknown hosts are rejected.
+func (h *SshHost) hostKeyCallback() (ssh.HostKeyCallback, error) {
+	knownHostsFile := h.KnownHostsFile
+	if h.KnownHosts != "" {
+		f, err := os.CreateTemp("", "saya-known-hosts-*")
+		if err != nil {
+			return nil, errors.Wrapf(err, "SshHost.hostKeyCallback -- fail to create known hosts file: err=%v", err)
+		}
+		defer os.Remove(f.Name())
+		_, err = f.WriteString(h.KnownHosts + "\n")
+		f.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "SshHost.hostKeyCallback -- fail to write known hosts file: err=%v", err)
+		}
+		knownHostsFile = f.Name()
+	}
+	if knownHostsFile == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, errors.Wrapf(err, "SshHost.hostKeyCallback -- fail to get home dir for default known hosts: err=%v", err)
+		}
+		knownHostsFile = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	callback, err := knownhosts.New(knownHostsFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "SshHost.hostKeyCallback -- fail to load known hosts: path=%s err=%v", knownHostsFile, err)
+	}
+	return callback, nil
+}
+
+// Dial opens an ssh connection to the host.
+func (h *SshHost) Dial(ctx context.Context) (*ssh.Client, error) {
+	if err := h.Validate(); err != nil {
+		return nil, err
+	}
+	signer, err := h.signer()
+	if err != nil {
+		return nil, err
+	}
+	hostKeyCallback, err := h.hostKeyCallback()
+	if err != nil {
+		return nil, err
+	}
+	config := &ssh.ClientConfig{
+		User:            h.User,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKeyCallback,
+	}
+
+	addr := h.addressWithPort()
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "SshHost.Dial -- fail to connect: address=%s err=%v", addr, err)
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		return nil, errors.Wrapf(err, "SshHost.Dial -- ssh handshake failed: address=%s user=%s err=%v", addr, h.User, err)
+	}
+	return ssh.NewClient(sshConn, chans, reqs), nil
+}
+
+// remoteResultDst returns the remote path saya writes the result to, for the local result destination.
+func (h *SshHost) remoteResultDst(localResultDst string) string {
+	return path.Join(h.TmpDir, filepath.Base(localResultDst))
+}
+
+// SshExecutor runs saya on a remote host over ssh; the result file is written in the host tmp dir
+// and fetched back over sftp.
+type SshExecutor struct {
+	Host *SshHost
+}
+
+func (e SshExecutor) Exec(ctx context.Context, req ExecRequest) (ExecResult, error) {
+	host := e.Host
+	client, err := host.Dial(ctx)
+	if err != nil {
+		return ExecResult{ExitCode: -777, StartFailure: "ssh connection failed"}, err
+	}
+	defer client.Close()
+
+	argv := req.Argv
+	remoteResultDst := ""
+	if req.ResultDst != "" {
+		remoteResultDst = host.remoteResultDst(req.ResultDst)
+		argv = make([]string, len(req.Argv))
+		for i, arg := range req.Argv {
+			if i > 0 && req.Argv[i-1] == "--result-dst" && arg == req.ResultDst {
+				arg = remoteResultDst
+			}
+			argv[i] = arg
+		}
+	}
+
+	res, err := host.run(ctx, client, argv, req.Env.Overrides(req.ExtraEnv), req.Stdin)
+	if remoteResultDst == "" {
+		return res, err
+	}
+	if err != nil {
+		host.remove(client, remoteResultDst)
+		return res, err
+	}
+	if res.Result, err = host.fetchAndRemove(client, remoteResultDst); err != nil {
+		return res, err
+	}
+	return res, nil
+}
+
+// run executes the command on the host.
+// The environment is passed through stdin ahead of the actual stdin, so that secrets show neither
+// in the remote process list nor depend on the sshd AcceptEnv setting; values must not contain new lines.
+func (h *SshHost) run(ctx context.Context, client *ssh.Client, argv []string, env map[string]string, stdin io.Reader) (ExecResult, error) {
+	envStdin, err := envAsStdin(env)
+	if err != nil {
+		return ExecResult{ExitCode: -777, StartFailure: "environment not transferable over ssh"}, err
+	}
+	session, err := client.NewSession()
+	if err != nil {
+		return ExecResult{ExitCode: -777, StartFailure: "ssh session not opened"},
+			errors.Wrapf(err, "SshHost.run -- fail to open session: err=%v", err)
+	}
+	defer session.Close()
+
+	stdout, stderr := bytes.Buffer{}, bytes.Buffer{}
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+	session.Stdin = strings.NewReader(envStdin)
+	if stdin != nil {
+		session.Stdin = io.MultiReader(session.Stdin, stdin)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- session.Run(remoteCommandLine(argv)) }()
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		_ = session.Signal(ssh.SIGKILL)
+		session.Close()
+		return ExecResult{ExitCode: -777, StartFailure: startFailureReason(ctx.Err())}, ctx.Err()
+	}
+
+	res := ExecResult{Stdout: stdout.String(), Stderr: stderr.String()}
+	if err != nil {
+		res.ExitCode = -777
+		var exitErr *ssh.ExitError
+		if stderrors.As(err, &exitErr) {
+			res.ExitCode = exitErr.ExitStatus()
+		} else {
+			res.StartFailure = "ssh session failed"
+		}
+	}
+	return res, err
+}
+
+// fetchAndRemove reads the remote file over sftp and removes it from the host.
+// A missing remote file is not an error, saya may have failed before writing it.
+func (h *SshHost) fetchAndRemove(client *ssh.Client, remotePath string) ([]byte, error) {
+	sftpClient, err := sftp.NewClient(client)
+	if err != nil {
+		return nil, errors.Wrapf(err, "SshHost.fetchAndRemove -- fail to start sftp: err=%v", err)
+	}
+	defer sftpClient.Close()
+
+	remoteFile, err := sftpClient.Open(remotePath)
+	if err != nil {
+		if stderrors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "SshHost.fetchAndRemove -- fail to open remote file: path=%s err=%v", remotePath, err)
+	}
+	defer func() {
+		remoteFile.Close()
+		_ = sftpClient.Remove(remotePath)
+	}()
+
+	content, err := io.ReadAll(remoteFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "SshHost.fetchAndRemove -- fail to fetch remote file: path=%s err=%v", remotePath, err)
+	}
+	return content, nil
+}
+
+// remove removes the remote file, best effort, e.g. a partial result of a failed execution.
+func (h *SshHost) remove(client *ssh.Client, remotePath string) {
+	sftpClient, err := sftp.NewClient(client)
+	if err != nil {
+		return
+	}
+	defer sftpClient.Close()
+	_ = sftpClient.Remove(remotePath)
+}
+
+// remoteCommandLine returns a posix shell command line reading KEY=VALUE lines from stdin up to an empty line,
+// exporting them and then executing argv.
+func remoteCommandLine(argv []string) string {
+	quoted := make([]string, 0, len(argv))
+	for _, arg := range argv {
+		quoted = append(quoted, shellQuote(arg))
+	}
+	return `while IFS= read -r kv && [ -n "$kv" ]; do export "$kv"; done; exec ` + strings.Join(quoted, " ")
+}
+
+// envAsStdin returns the environment as one KEY=value line per variable, terminated by an empty line.
+// Variables containing new lines are rejected, they would be read as several variables; the error does not contain the values.
+func envAsStdin(env map[string]string) (string, error) {
+	keys := maps.Keys(env)
+	sort.Strings(keys)
+	sb := strings.Builder{}
+	for _, k := range keys {
+		if strings.ContainsAny(k, "=\n") || k == "" {
+			return "", errors.Errorf("envAsStdin -- bad environment variable name: name=%q", k)
+		}
+		if strings.ContainsAny(env[k], "\r\n") {
+			return "", errors.Errorf("envAsStdin -- environment variable value must not contain new lines: name=%s", k)
+		}
+		sb.WriteString(k + "=" + env[k] + "\n")
+	}
+	sb.WriteString("\n")
+	return sb.String(), nil
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// remoteDisplay returns the remote host part of the execution error messages.
+func (sayaCmd SayaCmd) remoteDisplay() string {
+	if sayaCmd.remote == nil {
+		return ""
+	}
+	return fmt.Sprintf(" \n\thost=%s@%s", sayaCmd.remote.User, sayaCmd.remote.Address)
+}
@@ -0,0 +1,250 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package saya
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	stderrors "errors"
+
+	"github.com/congop/terraform-provider-saya/internal/opaque"
+	"github.com/pkg/sftp"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// testSshServer is an in-process ssh server running exec requests with sh and serving sftp from the local file system.
+type testSshServer struct {
+	addr       string
+	hostKey    ssh.PublicKey
+	clientKey  string // pem encoded private key accepted by the server
+	knownHosts string
+}
+
+func newTestSshKey(t *testing.T) (ssh.Signer, string) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(priv)
+	require.NoError(t, err)
+	return signer, string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+}
+
+func givenTestSshServer(t *testing.T) testSshServer {
+	hostSigner, _ := newTestSshKey(t)
+	clientSigner, clientKey := newTestSshKey(t)
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if !bytes.Equal(key.Marshal(), clientSigner.PublicKey().Marshal()) {
+				return nil, stderrors.New("unknown client key")
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(hostSigner)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveTestSshConn(conn, config)
+		}
+	}()
+
+	addr := listener.Addr().String()
+	return testSshServer{
+		addr:       addr,
+		hostKey:    hostSigner.PublicKey(),
+		clientKey:  clientKey,
+		knownHosts: knownhosts.Line([]string{addr}, hostSigner.PublicKey()),
+	}
+}
+
+func serveTestSshConn(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newChan := range chans {
+		if newChan.ChannelType() != "session" {
+			_ = newChan.Reject(ssh.UnknownChannelType, "only sessions are supported")
+			continue
+		}
+		channel, requests, err := newChan.Accept()
+		if err != nil {
+			continue
+		}
+		go serveTestSshSession(channel, requests)
+	}
+}
+
+func serveTestSshSession(channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer channel.Close()
+	for req := range requests {
+		var payload struct{ Value string }
+		_ = ssh.Unmarshal(req.Payload, &payload)
+		switch {
+		case req.Type == "exec":
+			_ = req.Reply(true, nil)
+			cmd := exec.Command("sh", "-c", payload.Value)
+			cmd.Stdin, cmd.Stdout, cmd.Stderr = channel, channel, channel.Stderr()
+			exitStatus := 0
+			if err := cmd.Run(); err != nil {
+				exitStatus = 255
+				var exitErr *exec.ExitError
+				if stderrors.As(err, &exitErr) {
+					exitStatus = exitErr.ExitCode()
+				}
+			}
+			_, _ = channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{uint32(exitStatus)}))
+			return
+		case req.Type == "subsystem" && payload.Value == "sftp":
+			_ = req.Reply(true, nil)
+			server, err := sftp.NewServer(channel)
+			if err != nil {
+				return
+			}
+			_ = server.Serve()
+			return
+		default:
+			_ = req.Reply(false, nil)
+		}
+	}
+}
+
+// fakeRemoteSaya prints its args and writes the environment it got to the --result-dst file.
+const fakeRemoteSaya = `#!/bin/sh
+echo "$*"
+while [ "$#" -gt 0 ]; do
+  if [ "$1" = "--result-dst" ]; then printf '%s|%s' "$SAYA_LICENSE_KEY" "$FOO" > "$2"; fi
+  shift
+done
+exit "${FAKE_EXIT:-0}"
+`
+
+func TestSayaCmdExecRemote(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the test ssh server runs commands with sh")
+	}
+	server := givenTestSshServer(t)
+	otherHostSigner, _ := newTestSshKey(t)
+	dir := t.TempDir()
+	sayaExe := writeTestFile(t, dir, "saya", []byte(fakeRemoteSaya))
+	require.NoError(t, os.Chmod(sayaExe, 0700))
+	remoteTmpDir := filepath.Join(dir, "remote-tmp")
+	require.NoError(t, os.Mkdir(remoteTmpDir, 0700))
+
+	tests := []struct {
+		name         string
+		knownHosts   string
+		vars         map[string]string
+		wantExitCode int
+		wantResult   string
+		wantErr      string
+	}{
+		{
+			name:       "should-run-remotely-and-fetch-result",
+			knownHosts: server.knownHosts,
+			vars:       map[string]string{"FOO": "it's bar"},
+			wantResult: "lk-secret|it's bar",
+		},
+		{
+			name:         "should-report-remote-exit-code",
+			knownHosts:   server.knownHosts,
+			vars:         map[string]string{"FAKE_EXIT": "3"},
+			wantExitCode: 3,
+			wantErr:      "fail to execute command",
+		},
+		{
+			name:         "should-reject-unknown-host-key",
+			knownHosts:   knownhosts.Line([]string{server.addr}, otherHostSigner.PublicKey()),
+			wantExitCode: -777,
+			wantErr:      "fail to start saya, ssh connection failed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			localResultDst := filepath.Join(t.TempDir(), "result.json")
+			cmd := SayaCmd{exe: sayaExe}
+			cmd.WithRequestSayaCtx(RequestSayaCtx{
+				LicenseKey: *opaque.NewString("lk-secret"),
+				Env:        &ExecEnv{Vars: tt.vars},
+				Host: &SshHost{
+					Address:    server.addr,
+					User:       "tester",
+					PrivateKey: *opaque.NewString(server.clientKey),
+					KnownHosts: tt.knownHosts,
+					TmpDir:     remoteTmpDir,
+				},
+			})
+			cmd.Args.Append("--result-dst", localResultDst)
+
+			outcome, err := cmd.Exec(context.Background())
+
+			require.Equal(t, tt.wantExitCode, outcome.ExitCode)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tt.wantErr)
+				require.NoFileExists(t, localResultDst)
+				return
+			}
+			require.NoError(t, err)
+			remoteResultDst := filepath.Join(remoteTmpDir, "result.json")
+			require.Equal(t, "--result-dst "+remoteResultDst+"\n", outcome.Stdout)
+			result, err := os.ReadFile(localResultDst)
+			require.NoError(t, err)
+			require.Equal(t, tt.wantResult, string(result))
+			require.NoFileExists(t, remoteResultDst, "remote result must be removed once fetched")
+		})
+	}
+}
+
+func TestRemoteCommandLine(t *testing.T) {
+	require.Equal(t,
+		`while IFS= read -r kv && [ -n "$kv" ]; do export "$kv"; done; exec 'sudo' '/opt/saya' '--name' 'it'\''s'`,
+		remoteCommandLine([]string{"sudo", "/opt/saya", "--name", "it's"}))
+}
+
+func TestEnvAsStdin(t *testing.T) {
+	envStdin, err := envAsStdin(map[string]string{"B": "x y", "A": "1"})
+	require.NoError(t, err)
+	require.Equal(t, "A=1\nB=x y\n\n", envStdin)
+
+	_, err = envAsStdin(map[string]string{"SAYA_LICENSE_KEY": "line1\nline2-secret"})
+	require.ErrorContains(t, err, "must not contain new lines: name=SAYA_LICENSE_KEY")
+	require.NotContains(t, err.Error(), "secret")
+
+	_, err = envAsStdin(map[string]string{"A=B": "1"})
+	require.ErrorContains(t, err, "bad environment variable name")
+}
@@ -15,9 +15,13 @@
 package saya
 
 import (
+	"context"
 	"reflect"
 	"strings"
 	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/congop/terraform-provider-saya/internal/opaque"
 )
 
 const RepoTypeHttp = "http"
@@ -36,10 +40,10 @@ type AwsCredentials struct {
 	AccessKeyID string //revive:disable-line:var-naming
 
 	// AWS Secret Access Key
-	SecretAccessKey string
+	SecretAccessKey opaque.String
 
 	// AWS Session Token
-	SessionToken string
+	SessionToken opaque.String
 
 	// Source of the credentials
 	Source string
@@ -55,8 +59,8 @@ func (cred *AwsCredentials) NormalizeToNil() *AwsCredentials {
 	}
 	copy := *cred
 	copy.AccessKeyID = strings.TrimSpace(copy.AccessKeyID)
-	copy.SecretAccessKey = strings.TrimSpace(copy.SecretAccessKey)
-	copy.SessionToken = strings.TrimSpace(copy.SessionToken)
+	copy.SecretAccessKey.Normalize()
+	copy.SessionToken.Normalize()
 	copy.Source = strings.TrimSpace(copy.Source)
 	if copy.Expires != nil && copy.Expires.IsZero() {
 		copy.Expires = nil
@@ -70,7 +74,7 @@ func (cred *AwsCredentials) HasExpires() bool {
 
 type AuthHttpBasic struct {
 	Username string
-	Pwd      string
+	Pwd      opaque.String
 }
 
 type HttpRepo struct {
@@ -85,7 +89,7 @@ func (repo *HttpRepo) NormalizeToNil() *HttpRepo {
 		return nil
 	}
 	copy := *repo
-	copy.AuthHttpBasic.Pwd = strings.TrimSpace(copy.AuthHttpBasic.Pwd)
+	copy.AuthHttpBasic.Pwd.Normalize()
 	copy.AuthHttpBasic.Username = strings.TrimSpace(copy.AuthHttpBasic.Username)
 	copy.BasePath = strings.TrimSpace(copy.BasePath)
 	copy.RepoUrl = strings.TrimSpace(copy.RepoUrl)
@@ -105,7 +109,31 @@ type S3Repo struct {
 	Region  string // aws region to send request to
 
 	AuthAwsCreds *AwsCredentials
+	CredsChain   *AwsCredentialChain
 	UsePathStyle bool
+
+	credsProvider aws.CredentialsProvider // resolves AuthAwsCreds/CredsChain into (refreshed) credentials
+}
+
+// WithCredentialsProvider sets the provider used to resolve the credentials handed over to saya.
+func (repo *S3Repo) WithCredentialsProvider(credsProvider aws.CredentialsProvider) {
+	repo.credsProvider = credsProvider
+}
+
+// ResolveCredentials returns the credentials to be used for the next saya invocation.
+// The second return value is true if the credentials have been resolved by the credentials provider.
+func (repo *S3Repo) ResolveCredentials(ctx context.Context) (*AwsCredentials, bool, error) {
+	if repo == nil {
+		return nil, false, nil
+	}
+	if repo.credsProvider == nil {
+		return repo.AuthAwsCreds, false, nil
+	}
+	cred, err := AwsCredentialsFromProvider(ctx, repo.credsProvider)
+	if err != nil {
+		return nil, true, err
+	}
+	return cred, true, nil
 }
 
 func (repo *S3Repo) NormalizeToNil() *S3Repo {
@@ -114,6 +142,7 @@ func (repo *S3Repo) NormalizeToNil() *S3Repo {
 	}
 	copy := *repo
 	copy.AuthAwsCreds = copy.AuthAwsCreds.NormalizeToNil()
+	copy.CredsChain = copy.CredsChain.NormalizeToNil()
 	copy.BaseKey = strings.TrimSpace(copy.BaseKey)
 	copy.Bucket = strings.TrimSpace(copy.Bucket)
 	copy.EpUrl = strings.TrimSpace(copy.EpUrl)
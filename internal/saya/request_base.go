@@ -22,5 +22,14 @@ type RequestSayaCtx struct {
 	Forge      string        // forge(local image store) location
 	LicenseKey opaque.String // License key
 	LogLevel   string        // log level error|warn|info|debug|trace
+	Env        *ExecEnv      // environment of the saya process; nil to inherit the provider environment
+	Host       *SshHost      // host saya is run on over ssh; nil to run saya locally
+	Executor   Executor      // runs saya command lines; nil for a local process, or ssh if Host is set
 
+	SecretsAsArgs bool // true to pass secrets as command line args, only for old saya versions not reading them from SAYA_ environment variables
+}
+
+// IsRemote returns true if saya is run on a remote host, where local inspection does not apply.
+func (req RequestSayaCtx) IsRemote() bool {
+	return req.Host.NormalizeToNil() != nil
 }
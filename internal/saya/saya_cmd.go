@@ -15,11 +15,12 @@
 package saya
 
 import (
-	"bytes"
 	"context"
 	"fmt"
+	"io/fs"
 	"os"
 	"os/exec"
+	"sort"
 	"strings"
 
 	stderrors "errors"
@@ -33,13 +34,25 @@ type SayaCmd struct {
 	exe                  string
 	Args                 CmdArgs
 	ArgsValidationErrors []error
+
+	env           map[string]opaque.String // additional environment variables of the saya process
+	execEnv       *ExecEnv                 // customization of the inherited environment; nil to inherit as is
+	secretsAsArgs bool                     // true to pass secrets as command line args instead of environment variables
+	escalation    []string                 // command prefix escalating privileges, e.g. sudo; nil to run saya as is
+	remote        *SshHost                 // host saya is run on over ssh; nil to run saya locally
+	executor      Executor                 // runs the command line; nil for the default local or ssh executor
+	spec          *CmdSpec                 // declared sub-command and flags; nil for a raw command accepting any flag
 }
 
 func (sayaCmd *SayaCmd) WithRequestSayaCtx(req RequestSayaCtx) {
+	sayaCmd.secretsAsArgs = req.SecretsAsArgs
 	sayaCmd.WithCfgFile(req.Config)
 	sayaCmd.WithForgeLocation(req.Forge)
 	sayaCmd.WithLicenseKey(req.LicenseKey)
 	sayaCmd.WithLogLevel(req.LogLevel)
+	sayaCmd.WithExecEnv(req.Env)
+	sayaCmd.remote = req.Host.NormalizeToNil()
+	sayaCmd.executor = req.Executor
 }
 
 func (sayaCmd *SayaCmd) WithCfgFile(cfg string) {
@@ -51,11 +64,7 @@ func (sayaCmd *SayaCmd) WithCfgFile(cfg string) {
 }
 
 func (sayaCmd *SayaCmd) WithLicenseKey(lk opaque.String) {
-	lkVal := strings.TrimSpace(lk.Value())
-	if lkVal == "" {
-		return
-	}
-	sayaCmd.Args.AppendCmdArgs(&CmdArgOpaqueStr{K: "--license-key", V: opaque.NewString(lkVal)})
+	sayaCmd.appendSecretIfNotBlank("--license-key", lk)
 }
 
 func (sayaCmd *SayaCmd) WithForgeLocation(forgeLocation string) {
@@ -74,6 +83,40 @@ func (sayaCmd *SayaCmd) WithLogLevel(logLevel string) {
 	sayaCmd.Args.Append("--log-level", logLevel)
 }
 
+// WithEscalation runs saya through the given privilege escalation command, e.g. sudo.
+func (sayaCmd *SayaCmd) WithEscalation(escalation ...string) {
+	sayaCmd.escalation = escalation
+}
+
+// WithEnv sets an additional environment variable for the saya process; blank values are ignored.
+func (sayaCmd *SayaCmd) WithEnv(key string, val opaque.String) {
+	if strings.TrimSpace(val.Value()) == "" {
+		return
+	}
+	if sayaCmd.env == nil {
+		sayaCmd.env = map[string]opaque.String{}
+	}
+	sayaCmd.env[key] = val
+}
+
+// WithExecEnv sets the customization (proxies, variables, minimal environment) of the saya process environment.
+func (sayaCmd *SayaCmd) WithExecEnv(execEnv *ExecEnv) {
+	sayaCmd.execEnv = execEnv.NormalizeToNil()
+}
+
+// Environ returns the environment of the saya process, nil meaning the current process environment.
+func (sayaCmd *SayaCmd) Environ() []string {
+	return sayaCmd.execEnv.Environ(sayaCmd.extraEnv())
+}
+
+func (sayaCmd *SayaCmd) extraEnv() map[string]string {
+	extra := make(map[string]string, len(sayaCmd.env))
+	for k, v := range sayaCmd.env {
+		extra[k] = v.Value()
+	}
+	return extra
+}
+
 func (sayaCmd *SayaCmd) appendFlagIfNotBlank(key, val string) {
 	val = strings.TrimSpace(val)
 	if val == "" {
@@ -85,9 +128,97 @@ func (sayaCmd *SayaCmd) appendFlagIfNotBlank(key, val string) {
 			fmt.Errorf("sayaCmd.appendFlagIfNotBlank -- key must not be blank: key=%s", key))
 		return
 	}
+	if !sayaCmd.checkFlag(key, FlagSingle) {
+		return
+	}
 	sayaCmd.Args.Append(key, val)
 }
 
+func (sayaCmd *SayaCmd) appendSwitchIf(key string, on bool) {
+	if !on || !sayaCmd.checkFlag(key, FlagSwitch) {
+		return
+	}
+	sayaCmd.Args.AppendNoValue(key)
+}
+
+// appendSecretIfNotBlank passes the secret through the saya environment variable matching the flag
+// (e.g. --license-key -> SAYA_LICENSE_KEY), so that the secret does not show up in the process list.
+// Only if secrets are to be passed as args, e.g. for old saya versions, it is passed as flag, masked in the args display.
+func (sayaCmd *SayaCmd) appendSecretIfNotBlank(key string, val opaque.String) {
+	val.Normalize()
+	if val.Value() == "" {
+		return
+	}
+	key = strings.TrimSpace(key)
+	if key == "" {
+		sayaCmd.ArgsValidationErrors = append(sayaCmd.ArgsValidationErrors,
+			fmt.Errorf("sayaCmd.appendSecretIfNotBlank -- key must not be blank: key=%s", key))
+		return
+	}
+	if !sayaCmd.checkFlag(key, FlagSecret) {
+		return
+	}
+	if sayaCmd.secretsAsArgs {
+		sayaCmd.Args.AppendCmdArgs(&CmdArgOpaqueStr{K: key, V: &val})
+		return
+	}
+	sayaCmd.WithEnv(SayaEnvKey(key), val)
+}
+
+// SayaEnvKey returns the environment variable saya reads the flag value from, e.g. --aws-secret-access-key -> SAYA_AWS_SECRET_ACCESS_KEY.
+func SayaEnvKey(flag string) string {
+	return "SAYA_" + strings.ToUpper(strings.ReplaceAll(strings.TrimLeft(strings.TrimSpace(flag), "-"), "-", "_"))
+}
+
+// Redact replaces the secrets handed over to saya, through args or environment, by a mask.
+func (sayaCmd *SayaCmd) Redact(str string) string {
+	return redactSecrets(str, sayaCmd.secretValues())
+}
+
+// redactSecrets replaces the secrets in str by a mask.
+func redactSecrets(str string, secrets []string) string {
+	if len(secrets) == 0 {
+		return str
+	}
+	// longest first, so that a secret containing another one gets fully masked
+	secrets = append([]string{}, secrets...)
+	sort.Slice(secrets, func(i, j int) bool { return len(secrets[i]) > len(secrets[j]) })
+	oldNew := make([]string, 0, len(secrets)*2)
+	for _, secret := range secrets {
+		oldNew = append(oldNew, secret, opaque.NewString(secret).String())
+	}
+	return strings.NewReplacer(oldNew...).Replace(str)
+}
+
+// secretValues returns the non blank values of the environment variables set by the command
+// and of the opaque or secret flag args.
+func (sayaCmd *SayaCmd) secretValues() []string {
+	secrets := make([]string, 0, len(sayaCmd.env))
+	appendIfNotBlank := func(val string) {
+		if val != "" {
+			secrets = append(secrets, val)
+		}
+	}
+	for _, val := range sayaCmd.env {
+		appendIfNotBlank(val.Value())
+	}
+	for _, args := range [][]ICmdArg{sayaCmd.Args.args, sayaCmd.Args.overrides} {
+		for _, arg := range args {
+			switch arg := arg.(type) {
+			case *CmdArgOpaqueStr:
+				if arg.V != nil {
+					appendIfNotBlank(arg.V.Value())
+				}
+			case *CmdArgStr:
+				if arg.V != nil && IsSecretFlag(arg.K) {
+					appendIfNotBlank(*arg.V)
+				}
+			}
+		}
+	}
+	return secrets
+}
+
 func (sayaCmd *SayaCmd) appendMultiFlagIfNotEmpty(key string, values []string) {
 	if len(values) == 0 {
 		return
@@ -95,7 +226,11 @@ func (sayaCmd *SayaCmd) appendMultiFlagIfNotEmpty(key string, values []string) {
 	key = strings.TrimSpace(key)
 	if key == "" {
 		sayaCmd.ArgsValidationErrors = append(sayaCmd.ArgsValidationErrors,
-			fmt.Errorf("sayaCmd.appendFlagIfNotBlank -- key must not be blank: key=%s", key))
+			fmt.Errorf("sayaCmd.appendMultiFlagIfNotEmpty -- key must not be blank: key=%s", key))
+		return
+	}
+	if !sayaCmd.checkFlag(key, FlagRepeatable) {
+		return
 	}
 
 	valuesNormalized := make([]string, 0, len(values))
@@ -115,48 +250,118 @@ func (sayaCmd *SayaCmd) appendMultiFlagIfNotEmpty(key string, values []string) {
 		return
 	}
 
-	sayaCmd.Args.AppendCmdArgs(&CmdMultiArgStr{K: key, V: valuesNormalized})
+	sayaCmd.Args.AppendRepeatable(key, valuesNormalized...)
 }
 
 type ExecOutcome struct {
 	Stdout   string
 	Stderr   string
 	ExitCode int
+	Result   []byte // content of the result file (--result-dst); nil if none has been written
 }
 
-func (sayaCmd SayaCmd) Exec(ctx context.Context) (ExecOutcome, error) {
-	args := sayaCmd.Args.Args()
-
-	stdout := bytes.Buffer{}
-	stderr := bytes.Buffer{}
-	execCmd := exec.CommandContext(ctx, sayaCmd.exe, args...)
-	execCmd.Stderr = &stderr
-	execCmd.Stdout = &stdout
+// ValidateArgs returns an error listing the args validation errors and the conflicting args; nil if the args are valid.
+func (sayaCmd SayaCmd) ValidateArgs() error {
+	msgs := make([]string, 0, len(sayaCmd.ArgsValidationErrors)+1)
+	for _, err := range sayaCmd.ArgsValidationErrors {
+		msgs = append(msgs, err.Error())
+	}
+	if err := sayaCmd.Args.Err(); err != nil {
+		msgs = append(msgs, err.Error())
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	return errors.Errorf("SayaCmd.ValidateArgs -- invalid args: \n\tcommand=%s \n\targ=%q \n\terrs=%s",
+		sayaCmd.exe, sayaCmd.Args.ArgsDisplay(), stringutil.IndentN(3, strings.Join(msgs, "\n")))
+}
 
-	err := execCmd.Run()
-	exitCode := 0
-	if err != nil {
-		exitCode = -777
-		var exitErr *exec.ExitError
-		if found := stderrors.As(err, &exitErr); found {
-			exitCode = exitErr.ExitCode()
-		}
+// Exec runs the command; it refuses to run if the args are invalid.
+func (sayaCmd SayaCmd) Exec(ctx context.Context) (ExecOutcome, error) {
+	if err := sayaCmd.ValidateArgs(); err != nil {
+		return ExecOutcome{ExitCode: -777}, errors.Wrapf(err, "SayaCmd.Exec -- saya not run, args are invalid: err=%v", err)
 	}
+	resultDst, _ := sayaCmd.Args.Value("--result-dst")
+	res, err := sayaCmd.executorOrDefault().Exec(ctx, ExecRequest{
+		Argv:      sayaCmd.argv(sayaCmd.Args.Args()),
+		Env:       sayaCmd.execEnv,
+		ExtraEnv:  sayaCmd.extraEnv(),
+		ResultDst: resultDst,
+		Secrets:   sayaCmd.secretValues(),
+	})
+	if err == nil {
+		err = materializeResult(resultDst, res.Result)
+	}
+
+	// saya may echo secrets, e.g. in error messages; the outcome ends up in logs and diagnostics
 	outcome := ExecOutcome{
-		Stdout:   stdout.String(),
-		Stderr:   stderr.String(),
-		ExitCode: exitCode,
+		Stdout:   sayaCmd.Redact(res.Stdout),
+		Stderr:   sayaCmd.Redact(res.Stderr),
+		ExitCode: res.ExitCode,
+		Result:   res.Result,
 	}
 	if err != nil {
 		wd, _ := os.Getwd()
-		return outcome, errors.Wrapf(err,
+		if outcome.ExitCode == -777 {
+			// saya did not run at all, the exit code would not tell why
+			return outcome, classifyExecFailure(ctx, sayaCmd.specDisplay(), outcome, errors.Wrapf(err,
+				"SayaCmd.Exec -- fail to start saya, %s:"+
+					"\n\tcommand=%s \n\targ=%q \n\tpwd=%s%s \n\tcause=%v",
+				res.StartFailure, sayaCmd.exe, sayaCmd.Args.ArgsDisplay(), wd, sayaCmd.remoteDisplay(), err))
+		}
+		return outcome, classifyExecFailure(ctx, sayaCmd.specDisplay(), outcome, errors.Wrapf(err,
 			"SayaCmd.Exec -- fail to execute command:"+
-				"\n\tcommand=%s \n\targ=%q \n\tpwd=%s \n\tcause=%v "+
+				"\n\tcommand=%s \n\targ=%q \n\tpwd=%s%s \n\tcause=%v "+
 				"\n\tstdout=%s \n\tstderr=%s",
-			sayaCmd.exe, sayaCmd.Args.ArgsDisplay(), wd, err,
+			sayaCmd.exe, sayaCmd.Args.ArgsDisplay(), wd, sayaCmd.remoteDisplay(), err,
 			stringutil.IndentN(3, string(outcome.Stdout)),
-			stringutil.IndentN(3, stringutil.Truncate(outcome.Stderr, 512)))
+			stringutil.IndentN(3, stringutil.Truncate(outcome.Stderr, 512))))
 	}
 	return outcome, nil
 
 }
+
+// specDisplay returns the sub-command path, e.g. vm ls; blank for commands without spec.
+func (sayaCmd SayaCmd) specDisplay() string {
+	if sayaCmd.spec == nil {
+		return ""
+	}
+	return sayaCmd.spec.String()
+}
+
+// executorOrDefault returns the executor saya is run with: the injected one, else ssh if a remote host is set,
+// else a local process.
+func (sayaCmd SayaCmd) executorOrDefault() Executor {
+	switch {
+	case sayaCmd.executor != nil:
+		return sayaCmd.executor
+	case sayaCmd.remote != nil:
+		return SshExecutor{Host: sayaCmd.remote}
+	default:
+		return LocalExecutor{}
+	}
+}
+
+// argv returns the command line running saya, including the privilege escalation prefix.
+func (sayaCmd SayaCmd) argv(args []string) []string {
+	argv := make([]string, 0, len(sayaCmd.escalation)+1+len(args))
+	argv = append(argv, sayaCmd.escalation...)
+	argv = append(argv, sayaCmd.exe)
+	return append(argv, args...)
+}
+
+// startFailureReason tells why the saya process could not be started.
+func startFailureReason(err error) string {
+	switch {
+	case stderrors.Is(err, exec.ErrNotFound):
+		return "executable not found in PATH"
+	case stderrors.Is(err, fs.ErrNotExist):
+		return "executable does not exist"
+	case stderrors.Is(err, fs.ErrPermission):
+		return "executable is not executable or not accessible"
+	case stderrors.Is(err, context.Canceled), stderrors.Is(err, context.DeadlineExceeded):
+		return "execution canceled"
+	default:
+		return "unexpected error"
+	}
+}
@@ -0,0 +1,291 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package saya
+
+import (
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/congop/terraform-provider-saya/internal/opaque"
+	"github.com/stretchr/testify/require"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files of the saya command lines")
+
+const goldenPullResult = `{"name":"alpine","version":"v1","sha256":"abc","type":"qcow2","platform":{"os":"linux","arch":"amd64"}}`
+
+// goldenCmdLine is the command line of a saya execution, with its extra environment variables.
+type goldenCmdLine struct {
+	argv []string
+	env  []string // sorted KEY=value, secret values masked
+}
+
+// givenGoldenSayaCtx returns a request context setting all global flags, with an executor capturing the command lines.
+func givenGoldenSayaCtx(result string, cmdLines *[]goldenCmdLine) RequestSayaCtx {
+	return RequestSayaCtx{
+		Exe:        "saya",
+		Config:     "/etc/saya/config.yml",
+		Forge:      "/var/lib/saya/forge",
+		LicenseKey: *opaque.NewString("lk-secret"),
+		LogLevel:   "debug",
+		Executor: &RecordingExecutor{Delegate: ExecutorFunc(func(ctx context.Context, req ExecRequest) (ExecResult, error) {
+			env := make([]string, 0, len(req.ExtraEnv))
+			for key, val := range req.ExtraEnv {
+				env = append(env, key+"="+redactSecrets(val, req.Secrets))
+			}
+			sort.Strings(env)
+			*cmdLines = append(*cmdLines, goldenCmdLine{argv: recordArgv(req), env: env})
+			return ExecResult{Result: []byte(result)}, nil
+		})},
+	}
+}
+
+// requireGoldenArgv compares the argv, one arg per line, followed by the extra environment variables
+// with testdata/golden/<name>.golden; go test -update rewrites it.
+func requireGoldenArgv(t *testing.T, name string, cmdLine goldenCmdLine) {
+	goldenPath := filepath.Join("testdata", "golden", name+".golden")
+	got := strings.Join(cmdLine.argv, "\n") + "\n# env\n"
+	for _, env := range cmdLine.env {
+		got += env + "\n"
+	}
+	if *updateGolden {
+		require.NoError(t, os.MkdirAll(filepath.Dir(goldenPath), 0755))
+		require.NoError(t, os.WriteFile(goldenPath, []byte(got), 0644))
+	}
+	want, err := os.ReadFile(goldenPath)
+	require.NoError(t, err, "golden file missing, run go test -update")
+	require.Equal(t, string(want), got)
+}
+
+func TestSayaCmdGoldenArgv(t *testing.T) {
+	expires := time.Date(2023, 9, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		result string
+		run    func(ctx context.Context, sayaCtx RequestSayaCtx) error
+	}{
+		{
+			name:   "image-ls",
+			result: "[]",
+			run: func(ctx context.Context, sayaCtx RequestSayaCtx) error {
+				_, err := Ls(ctx, LsRequest{Name: "alpine:v1", ImgType: "qcow2", Platform: "linux/arm64/v8", RequestSayaCtx: sayaCtx})
+				return err
+			},
+		},
+		{
+			name:   "image-pull-http",
+			result: goldenPullResult,
+			run: func(ctx context.Context, sayaCtx RequestSayaCtx) error {
+				_, err := Pull(ctx, PullRequest{
+					Name: "alpine:v1", ImgType: "qcow2", Platform: "linux/amd64", Hash: "sha256:abc", RepoType: "http",
+					HttpRepo: &HttpRepo{
+						RepoUrl: "https://repo.example.com", BasePath: "images", UploadStrategy: "put",
+						AuthHttpBasic: AuthHttpBasic{Username: "user", Pwd: *opaque.NewString("pwd-secret")},
+					},
+					RequestSayaCtx: sayaCtx,
+				})
+				return err
+			},
+		},
+		{
+			name:   "image-pull-http-secrets-as-args",
+			result: goldenPullResult,
+			run: func(ctx context.Context, sayaCtx RequestSayaCtx) error {
+				sayaCtx.SecretsAsArgs = true
+				_, err := Pull(ctx, PullRequest{
+					Name: "alpine:v1", RepoType: "http",
+					HttpRepo: &HttpRepo{
+						RepoUrl:       "https://repo.example.com",
+						AuthHttpBasic: AuthHttpBasic{Username: "user", Pwd: *opaque.NewString("pwd-secret")},
+					},
+					RequestSayaCtx: sayaCtx,
+				})
+				return err
+			},
+		},
+		{
+			name:   "image-pull-s3",
+			result: goldenPullResult,
+			run: func(ctx context.Context, sayaCtx RequestSayaCtx) error {
+				_, err := Pull(ctx, PullRequest{
+					Name: "alpine:v1", RepoType: "s3",
+					S3Repo: &S3Repo{
+						Bucket: "images", BaseKey: "rbase", EpUrl: "http://127.0.0.1:9000", EpUrlS3: "http://127.0.0.1:9000/",
+						Region: "eu-west-1", UsePathStyle: true,
+						AuthAwsCreds: &AwsCredentials{
+							AccessKeyID: "AKID", SecretAccessKey: *opaque.NewString("sak-secret"),
+							SessionToken: *opaque.NewString("st-secret"), Source: "static", CanExpire: true, Expires: &expires,
+						},
+					},
+					RequestSayaCtx: sayaCtx,
+				})
+				return err
+			},
+		},
+		{
+			name:   "image-pull-s3-static-keys",
+			result: goldenPullResult,
+			run: func(ctx context.Context, sayaCtx RequestSayaCtx) error {
+				_, err := Pull(ctx, PullRequest{
+					Name: "alpine:v1", RepoType: "s3",
+					S3Repo: &S3Repo{
+						Bucket: "images", Region: "eu-west-1",
+						AuthAwsCreds: &AwsCredentials{AccessKeyID: "AKID", SecretAccessKey: *opaque.NewString("sak-secret")},
+					},
+					RequestSayaCtx: sayaCtx,
+				})
+				return err
+			},
+		},
+		{
+			name: "image-rm",
+			run: func(ctx context.Context, sayaCtx RequestSayaCtx) error {
+				return ImageRm(ctx, ImageDeleteRequest{Name: "alpine:v1", ImgType: "qcow2", Platform: "linux/amd64", RequestSayaCtx: sayaCtx})
+			},
+		},
+		{
+			name: "setup",
+			run: func(ctx context.Context, sayaCtx RequestSayaCtx) error {
+				_, err := Setup(ctx, SetupRequest{
+					ComputeType: "ssh", Target: "192.168.56.10", WantComputeTypes: []string{"qemu", "virtualbox"},
+					TargetUser: "tester", Escalation: EscalationSudo, RequestSayaCtx: sayaCtx,
+				})
+				return err
+			},
+		},
+		{
+			name: "version",
+			run: func(ctx context.Context, sayaCtx RequestSayaCtx) error {
+				_, err := Version(ctx, sayaCtx)
+				return err
+			},
+		},
+		{
+			name:   "vm-ls",
+			result: "[]",
+			run: func(ctx context.Context, sayaCtx RequestSayaCtx) error {
+				_, err := VmLs(ctx, VmLsRequest{
+					Id: "vm-1", Name: "web", ComputeType: "qemu", OsVariant: "alpine", RequestSayaCtx: sayaCtx,
+				})
+				return err
+			},
+		},
+		{
+			name:   "vm-run",
+			result: `{"id":"vm-1","name":"web"}`,
+			run: func(ctx context.Context, sayaCtx RequestSayaCtx) error {
+				_, err := VmRun(ctx, VmRunRequest{
+					ImgRef: "alpine:v1", Name: "web", ComputeType: "qemu", Platform: "linux/amd64", ImgType: "qcow2",
+					RequestSayaCtx: sayaCtx,
+				})
+				return err
+			},
+		},
+		{
+			name: "vm-rm",
+			run: func(ctx context.Context, sayaCtx RequestSayaCtx) error {
+				_, err := VmRm(ctx, VmRmRequest{Id: "vm-1", RequestSayaCtx: sayaCtx})
+				return err
+			},
+		},
+		{
+			name: "vm-start",
+			run: func(ctx context.Context, sayaCtx RequestSayaCtx) error {
+				_, err := VmStart(ctx, VmStartRequest{Id: "vm-1", RequestSayaCtx: sayaCtx})
+				return err
+			},
+		},
+		{
+			name: "vm-stop",
+			run: func(ctx context.Context, sayaCtx RequestSayaCtx) error {
+				_, err := VmStop(ctx, VmStopRequest{Id: "vm-1", RequestSayaCtx: sayaCtx})
+				return err
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmdLines := []goldenCmdLine{}
+
+			err := tt.run(context.Background(), givenGoldenSayaCtx(tt.result, &cmdLines))
+
+			require.NoError(t, err)
+			require.Len(t, cmdLines, 1)
+			requireGoldenArgv(t, tt.name, cmdLines[0])
+		})
+	}
+}
+
+func TestSayaCmdGoldenCoversAllSpecs(t *testing.T) {
+	for _, spec := range CmdSpecs {
+		goldenPaths, err := filepath.Glob(filepath.Join("testdata", "golden", strings.Join(spec.Path, "-")+"*.golden"))
+		require.NoError(t, err)
+		require.NotEmpty(t, goldenPaths, "each saya command must have a golden command line: cmd=%s", spec)
+	}
+}
+
+func TestSayaCmdRejectsUndeclaredFlags(t *testing.T) {
+	tests := []struct {
+		name    string
+		append  func(cmd *SayaCmd)
+		wantErr string
+	}{
+		{
+			name:    "undeclared-flag",
+			append:  func(cmd *SayaCmd) { cmd.appendFlagIfNotBlank("--compte-type", "qemu") },
+			wantErr: "flag not supported by command: cmd=vm ls flag=--compte-type",
+		},
+		{
+			name:    "single-used-as-repeatable",
+			append:  func(cmd *SayaCmd) { cmd.appendMultiFlagIfNotEmpty("--format", []string{"json", "yaml"}) },
+			wantErr: "flag kind mismatch: cmd=vm ls flag=--format declared=single used-as=repeatable",
+		},
+		{
+			name:    "repeatable-used-as-single",
+			append:  func(cmd *SayaCmd) { cmd.appendFlagIfNotBlank("--filter", "name=web") },
+			wantErr: "flag kind mismatch: cmd=vm ls flag=--filter declared=repeatable used-as=single",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, err := NewCmdVmLs("", RequestSayaCtx{Exe: "saya"})
+			require.NoError(t, err)
+
+			tt.append(cmd)
+
+			require.Equal(t, []string{"vm", "ls"}, cmd.Args.Args())
+			require.Len(t, cmd.ArgsValidationErrors, 1)
+			require.Contains(t, cmd.ArgsValidationErrors[0].Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestNewSayaCmdValidatesExeAndOperand(t *testing.T) {
+	_, err := NewCmdVmStart("vm-1", RequestSayaCtx{Exe: " "})
+	require.ErrorContains(t, err, "saya-exe must not be blank: cmd=vm start")
+
+	_, err = NewCmdVmStart(" ", RequestSayaCtx{Exe: "saya"})
+	require.ErrorContains(t, err, "id must not be blank: cmd=vm start")
+
+	cmd, err := NewCmdVmStop("stop", RequestSayaCtx{Exe: "saya"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"vm", "stop", "stop"}, cmd.Args.Args(), "operand equal to a sub-command word must be kept")
+}
@@ -0,0 +1,131 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package saya
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// FlagKind tells how a saya flag takes its value.
+type FlagKind int
+
+const (
+	FlagSingle     FlagKind = iota // --flag <value>, at most once
+	FlagRepeatable                 // --flag <value>, once per value
+	FlagSwitch                     // --flag, without value
+	FlagSecret                     // --flag <secret>, passed through its SAYA_ environment variable; as arg only on explicit fallback for old saya versions
+)
+
+func (kind FlagKind) String() string {
+	switch kind {
+	case FlagSingle:
+		return "single"
+	case FlagRepeatable:
+		return "repeatable"
+	case FlagSwitch:
+		return "switch"
+	case FlagSecret:
+		return "secret"
+	default:
+		return fmt.Sprintf("FlagKind(%d)", int(kind))
+	}
+}
+
+// CmdSpec declares a saya command: its sub-command path, operand and flags.
+// The command builders are derived from it, so that argv are only assembled from declared flags.
+type CmdSpec struct {
+	Path            []string            // sub-command path, e.g. image pull
+	Operand         string              // name of the positional operand, e.g. image-reference; blank if none
+	OperandOptional bool                // true if the operand may be blank
+	Flags           map[string]FlagKind // flags of the sub-command, the global flags excepted
+	NoGlobalFlags   bool                // true if the global flags of the request context do not apply, e.g. for version
+}
+
+// globalFlags are the flags of all saya commands, set from the request context.
+var globalFlags = map[string]FlagKind{
+	"--config":      FlagSingle,
+	"--forge":       FlagSingle,
+	"--license-key": FlagSecret,
+	"--log-level":   FlagSingle,
+}
+
+// FlagKind returns the kind of the flag and true if the command accepts it.
+func (spec *CmdSpec) FlagKind(flag string) (FlagKind, bool) {
+	if kind, ok := globalFlags[flag]; ok && !spec.NoGlobalFlags {
+		return kind, true
+	}
+	kind, ok := spec.Flags[flag]
+	return kind, ok
+}
+
+func (spec *CmdSpec) String() string {
+	return strings.Join(spec.Path, " ")
+}
+
+// newSayaCmd builds the base command of the spec, i.e. <saya-exe> <path...> <operand>, to be completed with flags.
+func newSayaCmd(spec *CmdSpec, operand string, reqSayaCtx RequestSayaCtx) (*SayaCmd, error) {
+	sayaExe := strings.TrimSpace(reqSayaCtx.Exe)
+	if sayaExe == "" {
+		return nil, errors.Errorf("newSayaCmd -- saya-exe must not be blank: cmd=%s", spec)
+	}
+	operand = strings.TrimSpace(operand)
+	switch {
+	case spec.Operand == "" && operand != "":
+		return nil, errors.Errorf("newSayaCmd -- command takes no operand: cmd=%s operand=%s", spec, operand)
+	case spec.Operand != "" && operand == "" && !spec.OperandOptional:
+		return nil, errors.Errorf("newSayaCmd -- %s must not be blank: cmd=%s", spec.Operand, spec)
+	}
+
+	cmd := &SayaCmd{exe: sayaExe, spec: spec}
+	words := spec.Path
+	if operand != "" {
+		words = append(append(make([]string, 0, len(words)+1), words...), operand)
+	}
+	for i, word := range words {
+		cmd.Args.AppendCmdArgs(&CmdArgPositional{Pos: i, V: word})
+	}
+	if spec.NoGlobalFlags {
+		cmd.WithExecEnv(reqSayaCtx.Env)
+		cmd.remote = reqSayaCtx.Host.NormalizeToNil()
+		cmd.executor = reqSayaCtx.Executor
+	} else {
+		cmd.WithRequestSayaCtx(reqSayaCtx)
+	}
+	return cmd, nil
+}
+
+// checkFlag returns true if the flag is declared by the command spec with the given kind;
+// otherwise the mismatch is recorded as args validation error. Commands without spec accept any flag.
+func (sayaCmd *SayaCmd) checkFlag(flag string, kind FlagKind) bool {
+	if sayaCmd.spec == nil {
+		return true
+	}
+	declared, ok := sayaCmd.spec.FlagKind(flag)
+	switch {
+	case !ok:
+		sayaCmd.ArgsValidationErrors = append(sayaCmd.ArgsValidationErrors,
+			fmt.Errorf("sayaCmd.checkFlag -- flag not supported by command: cmd=%s flag=%s", sayaCmd.spec, flag))
+		return false
+	case declared != kind:
+		sayaCmd.ArgsValidationErrors = append(sayaCmd.ArgsValidationErrors,
+			fmt.Errorf("sayaCmd.checkFlag -- flag kind mismatch: cmd=%s flag=%s declared=%s used-as=%s",
+				sayaCmd.spec, flag, declared, kind))
+		return false
+	}
+	return true
+}
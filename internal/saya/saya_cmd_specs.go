@@ -0,0 +1,162 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package saya
+
+// The saya commands used by the provider.
+var (
+	CmdSpecImgLs = &CmdSpec{
+		Path:            []string{"image", "ls"},
+		Operand:         "image-reference",
+		OperandOptional: true,
+		Flags: map[string]FlagKind{
+			"--filter":     FlagRepeatable,
+			"--format":     FlagSingle,
+			"--result-dst": FlagSingle,
+		},
+	}
+
+	CmdSpecImgPull = &CmdSpec{
+		Path:    []string{"image", "pull"},
+		Operand: "image-reference",
+		Flags: map[string]FlagKind{
+			"--hash":                     FlagSingle,
+			"--img-type":                 FlagSingle,
+			"--platform":                 FlagSingle,
+			"--repo-type":                FlagSingle,
+			"--result-dst":               FlagSingle,
+			"--http-auth-basic-password": FlagSecret,
+			"--http-auth-basic-username": FlagSingle,
+			"--http-base-path":           FlagSingle,
+			"--http-repo-url":            FlagSingle,
+			"--http-upload-strategy":     FlagSingle,
+			"--aws-access-key-id":        FlagSingle,
+			"--aws-secret-access-key":    FlagSecret,
+			"--aws-ep-url":               FlagSingle,
+			"--aws-ep-url-s3":            FlagSingle,
+			"--aws-region":               FlagSingle,
+			"--s3-use-path-style":        FlagSwitch,
+			"--s3-base-key":              FlagSingle,
+			"--s3-bucket":                FlagSingle,
+		},
+	}
+
+	CmdSpecImgRm = &CmdSpec{
+		Path:    []string{"image", "rm"},
+		Operand: "image-reference",
+		Flags: map[string]FlagKind{
+			"--img-type": FlagSingle,
+			"--platform": FlagSingle,
+		},
+	}
+
+	CmdSpecSetup = &CmdSpec{
+		Path: []string{"setup"},
+		Flags: map[string]FlagKind{
+			"--compute-type":      FlagSingle,
+			"--target":            FlagSingle,
+			"--want-compute-type": FlagRepeatable,
+			"--target-user":       FlagSingle,
+		},
+	}
+
+	// CmdSpecVersion does not need config, forge or license to print the version.
+	CmdSpecVersion = &CmdSpec{
+		Path:          []string{"version"},
+		NoGlobalFlags: true,
+	}
+
+	CmdSpecVmLs = &CmdSpec{
+		Path:            []string{"vm", "ls"},
+		Operand:         "id",
+		OperandOptional: true,
+		Flags: map[string]FlagKind{
+			"--filter":     FlagRepeatable,
+			"--format":     FlagSingle,
+			"--result-dst": FlagSingle,
+		},
+	}
+
+	CmdSpecVmRun = &CmdSpec{
+		Path:    []string{"vm", "run"},
+		Operand: "image-reference",
+		Flags: map[string]FlagKind{
+			"--name":         FlagSingle,
+			"--compute-type": FlagSingle,
+			"--platform":     FlagSingle,
+			"--img-type":     FlagSingle,
+			"--result-dst":   FlagSingle,
+		},
+	}
+
+	CmdSpecVmRm    = &CmdSpec{Path: []string{"vm", "rm"}, Operand: "id"}
+	CmdSpecVmStart = &CmdSpec{Path: []string{"vm", "start"}, Operand: "id"}
+	CmdSpecVmStop  = &CmdSpec{Path: []string{"vm", "stop"}, Operand: "id"}
+)
+
+// CmdSpecs lists the saya commands used by the provider.
+var CmdSpecs = []*CmdSpec{
+	CmdSpecImgLs, CmdSpecImgPull, CmdSpecImgRm, CmdSpecSetup, CmdSpecVersion,
+	CmdSpecVmLs, CmdSpecVmRun, CmdSpecVmRm, CmdSpecVmStart, CmdSpecVmStop,
+}
+
+// NewCmdImgLs creates the base command <saya-exe> image ls [<img-reference>].
+func NewCmdImgLs(imgRef string, reqSayaCtx RequestSayaCtx) (*SayaCmd, error) {
+	return newSayaCmd(CmdSpecImgLs, imgRef, reqSayaCtx)
+}
+
+// NewCmdImgPull creates the base command <saya-exe> image pull <img-reference>.
+func NewCmdImgPull(imgRef string, reqSayaCtx RequestSayaCtx) (*SayaCmd, error) {
+	return newSayaCmd(CmdSpecImgPull, imgRef, reqSayaCtx)
+}
+
+// NewCmdImgRm creates the base command <saya-exe> image rm <img-reference>.
+func NewCmdImgRm(imgRef string, reqSayaCtx RequestSayaCtx) (*SayaCmd, error) {
+	return newSayaCmd(CmdSpecImgRm, imgRef, reqSayaCtx)
+}
+
+// NewCmdSetup creates the base command <saya-exe> setup.
+func NewCmdSetup(reqSayaCtx RequestSayaCtx) (*SayaCmd, error) {
+	return newSayaCmd(CmdSpecSetup, "", reqSayaCtx)
+}
+
+// NewCmdVersion creates the command <saya-exe> version.
+func NewCmdVersion(reqSayaCtx RequestSayaCtx) (*SayaCmd, error) {
+	return newSayaCmd(CmdSpecVersion, "", reqSayaCtx)
+}
+
+// NewCmdVmLs creates the base command <saya-exe> vm ls [<id>].
+func NewCmdVmLs(id string, reqSayaCtx RequestSayaCtx) (*SayaCmd, error) {
+	return newSayaCmd(CmdSpecVmLs, id, reqSayaCtx)
+}
+
+// NewCmdVmRun creates the base command <saya-exe> vm run <img-reference>.
+func NewCmdVmRun(imgRef string, reqSayaCtx RequestSayaCtx) (*SayaCmd, error) {
+	return newSayaCmd(CmdSpecVmRun, imgRef, reqSayaCtx)
+}
+
+// NewCmdVmRm creates the command <saya-exe> vm rm <id>.
+func NewCmdVmRm(id string, reqSayaCtx RequestSayaCtx) (*SayaCmd, error) {
+	return newSayaCmd(CmdSpecVmRm, id, reqSayaCtx)
+}
+
+// NewCmdVmStart creates the command <saya-exe> vm start <id>.
+func NewCmdVmStart(id string, reqSayaCtx RequestSayaCtx) (*SayaCmd, error) {
+	return newSayaCmd(CmdSpecVmStart, id, reqSayaCtx)
+}
+
+// NewCmdVmStop creates the command <saya-exe> vm stop <id>.
+func NewCmdVmStop(id string, reqSayaCtx RequestSayaCtx) (*SayaCmd, error) {
+	return newSayaCmd(CmdSpecVmStop, id, reqSayaCtx)
+}
@@ -0,0 +1,80 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package saya
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/congop/terraform-provider-saya/internal/opaque"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSayaCmdSecrets(t *testing.T) {
+	const licenseKey = "lk-secret-value"
+	const pwd = "pwd-secret-value"
+	tests := []struct {
+		name          string
+		secretsAsArgs bool
+		wantArgs      []string
+		wantDisplay   []string
+		wantEnv       []string
+	}{
+		{
+			name:        "should-pass-secrets-through-environment-by-default",
+			wantArgs:    []string{"image", "pull", "alpine:v1"},
+			wantDisplay: []string{"image", "pull", "alpine:v1"},
+			wantEnv: []string{
+				"SAYA_HTTP_AUTH_BASIC_PASSWORD=" + pwd,
+				"SAYA_LICENSE_KEY=" + licenseKey,
+			},
+		},
+		{
+			name:          "should-pass-secrets-as-args-on-fallback",
+			secretsAsArgs: true,
+			wantArgs:      []string{"image", "pull", "alpine:v1", "--license-key", licenseKey, "--http-auth-basic-password", pwd},
+			wantDisplay:   []string{"image", "pull", "alpine:v1", "--license-key", "********", "--http-auth-basic-password", "********"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, err := NewCmdImgPull("alpine:v1", RequestSayaCtx{
+				Exe:           "saya",
+				LicenseKey:    *opaque.NewString(" " + licenseKey + " "),
+				SecretsAsArgs: tt.secretsAsArgs,
+			})
+			require.NoError(t, err)
+			cmd.appendSecretIfNotBlank("--http-auth-basic-password", *opaque.NewString(pwd))
+
+			require.Equal(t, tt.wantArgs, cmd.Args.Args())
+			require.Equal(t, tt.wantDisplay, cmd.Args.ArgsDisplay())
+			environ := cmd.Environ()
+			for _, kv := range tt.wantEnv {
+				require.Contains(t, environ, kv)
+			}
+			if len(tt.wantEnv) == 0 {
+				require.Nil(t, environ)
+			}
+		})
+	}
+}
+
+// writeTestFile writes the content to the file of the directory and returns its path.
+func writeTestFile(t *testing.T, dir, name string, content []byte) string {
+	p := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(p, content, 0600), "fail to write file: path=%s", p)
+	return p
+}
@@ -0,0 +1,125 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package saya
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	stderrors "errors"
+
+	"github.com/congop/terraform-provider-saya/internal/stringutil"
+)
+
+// ErrorKind classifies saya failures.
+// Saya documents neither error codes nor error messages, so that only the failures recognizable
+// without parsing the saya output get a kind other than ErrKindUnknown.
+type ErrorKind string
+
+const (
+	ErrKindUnknown ErrorKind = "unknown"
+	ErrKindTimeout ErrorKind = "timeout" // the context of the execution has timed out
+)
+
+type errorKindInfo struct {
+	summary string // actionable diagnostic summary
+	hint    string // what the user can do about it
+}
+
+var errorKindInfos = map[ErrorKind]errorKindInfo{
+	ErrKindTimeout: {
+		summary: "Saya timed out",
+		hint:    "The operation did not complete in time; it may succeed when retried.",
+	},
+}
+
+// SayaError is a classified saya failure.
+// It matches the ErrXxx sentinel of its kind with errors.Is, e.g. errors.Is(err, saya.ErrTimeout).
+type SayaError struct {
+	Kind     ErrorKind
+	Cmd      string // sub-command, e.g. vm ls
+	ExitCode int
+	Message  string // saya error message
+	cause    error  // execution error, with the command line and outputs
+}
+
+var ErrTimeout = &SayaError{Kind: ErrKindTimeout}
+
+// NewSayaError returns an error of the kind, e.g. for saya clients not executing saya.
+func NewSayaError(kind ErrorKind, cmd string, msg string) *SayaError {
+	return &SayaError{Kind: kind, Cmd: cmd, Message: msg}
+}
+
+func (e *SayaError) Error() string {
+	switch {
+	case e.cause != nil:
+		return fmt.Sprintf("%s: %v", e.Kind, e.cause)
+	case e.Message != "":
+		return fmt.Sprintf("%s: saya %s: %s", e.Kind, e.Cmd, e.Message)
+	default:
+		return string(e.Kind)
+	}
+}
+
+func (e *SayaError) Unwrap() error {
+	return e.cause
+}
+
+func (e *SayaError) Is(target error) bool {
+	targetErr, ok := target.(*SayaError)
+	return ok && targetErr.Kind == e.Kind
+}
+
+// Summary returns an actionable one line description of the failure.
+func (e *SayaError) Summary() string {
+	if info, ok := errorKindInfos[e.Kind]; ok {
+		return info.summary
+	}
+	if e.Cmd == "" {
+		return "saya failed"
+	}
+	return fmt.Sprintf("saya %s failed", e.Cmd)
+}
+
+// Hint tells what can be done about the failure; blank if nothing specific.
+func (e *SayaError) Hint() string {
+	return errorKindInfos[e.Kind].hint
+}
+
+// AsSayaError returns the saya error in the chain of err.
+func AsSayaError(err error) (*SayaError, bool) {
+	sayaErr := &SayaError{}
+	if stderrors.As(err, &sayaErr) {
+		return sayaErr, true
+	}
+	return nil, false
+}
+
+// classifyExecFailure classifies the failure of a saya execution; it is a timeout if the context deadline
+// has been exceeded, unknown otherwise. The message is the last line saya has written to stderr.
+func classifyExecFailure(ctx context.Context, cmd string, outcome ExecOutcome, err error) *SayaError {
+	sayaErr := &SayaError{Kind: ErrKindUnknown, Cmd: cmd, ExitCode: outcome.ExitCode, cause: err}
+	if stderrors.Is(ctx.Err(), context.DeadlineExceeded) || stderrors.Is(err, context.DeadlineExceeded) {
+		sayaErr.Kind = ErrKindTimeout
+	}
+	sayaErr.Message = stringutil.Truncate(lastNonBlankLine(outcome.Stderr), 512)
+	return sayaErr
+}
+
+func lastNonBlankLine(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
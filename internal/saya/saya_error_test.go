@@ -0,0 +1,125 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package saya
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifyExecFailure(t *testing.T) {
+	deadlineCtx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	tests := []struct {
+		name        string
+		ctx         context.Context
+		outcome     ExecOutcome
+		err         error
+		wantKind    ErrorKind
+		wantMessage string
+	}{
+		{
+			name:        "last-stderr-line-as-message",
+			outcome:     ExecOutcome{ExitCode: 1, Stderr: "INF vm stop -- stopping\nERR vm stop -- failed: id=vm-1\n\n"},
+			wantKind:    ErrKindUnknown,
+			wantMessage: "ERR vm stop -- failed: id=vm-1",
+		},
+		{
+			name:        "stdout-never-classified",
+			outcome:     ExecOutcome{ExitCode: 1, Stdout: "image not found: timed out 401", Stderr: "ERR image pull -- failed"},
+			wantKind:    ErrKindUnknown,
+			wantMessage: "ERR image pull -- failed",
+		},
+		{
+			name:     "stderr-message-not-classified",
+			outcome:  ExecOutcome{ExitCode: 16, Stderr: `{"level":"error","code":"vm-not-found","message":"operation timed out"}`},
+			wantKind: ErrKindUnknown,
+		},
+		{
+			name:     "context-deadline-in-error",
+			outcome:  ExecOutcome{ExitCode: -1},
+			err:      errors.Wrap(context.DeadlineExceeded, "wait"),
+			wantKind: ErrKindTimeout,
+		},
+		{
+			name:     "context-deadline-exceeded",
+			ctx:      deadlineCtx,
+			outcome:  ExecOutcome{ExitCode: -1},
+			err:      errors.New("signal: killed"),
+			wantKind: ErrKindTimeout,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := tt.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			err := tt.err
+			if err == nil {
+				err = fmt.Errorf("exit status %d", tt.outcome.ExitCode)
+			}
+
+			sayaErr := classifyExecFailure(ctx, "vm run", tt.outcome, err)
+
+			require.Equal(t, tt.wantKind, sayaErr.Kind)
+			require.Equal(t, "vm run", sayaErr.Cmd)
+			require.Equal(t, tt.outcome.ExitCode, sayaErr.ExitCode)
+			if tt.wantMessage != "" {
+				require.Equal(t, tt.wantMessage, sayaErr.Message)
+			}
+			require.ErrorIs(t, sayaErr, err, "the execution error must stay in the chain")
+		})
+	}
+}
+
+func TestSayaErrorMatchesSentinelOfItsKind(t *testing.T) {
+	err := errors.Wrap(NewSayaError(ErrKindTimeout, "vm stop", "stop not completed"), "deleteVm")
+
+	require.ErrorIs(t, err, ErrTimeout)
+	require.NotErrorIs(t, errors.Wrap(NewSayaError(ErrKindUnknown, "vm stop", "failed"), "deleteVm"), ErrTimeout)
+
+	sayaErr, ok := AsSayaError(err)
+	require.True(t, ok)
+	require.Equal(t, "Saya timed out", sayaErr.Summary())
+	require.NotEmpty(t, sayaErr.Hint())
+	require.Equal(t, "timeout: saya vm stop: stop not completed", sayaErr.Error())
+	require.Equal(t, "saya vm rm failed", NewSayaError(ErrKindUnknown, "vm rm", "").Summary())
+	require.Empty(t, NewSayaError(ErrKindUnknown, "vm rm", "").Hint())
+}
+
+func TestSayaCmdExecClassifiesFailures(t *testing.T) {
+	cmd, err := NewCmdVmStop("vm-1", RequestSayaCtx{
+		Exe: "saya",
+		Executor: ExecutorFunc(func(ctx context.Context, req ExecRequest) (ExecResult, error) {
+			return ExecResult{ExitCode: 1, Stderr: "ERR vm stop -- failed: vm not found"}, fmt.Errorf("exit status 1")
+		}),
+	})
+	require.NoError(t, err)
+
+	_, err = cmd.Exec(context.Background())
+
+	sayaErr, ok := AsSayaError(err)
+	require.True(t, ok)
+	require.Equal(t, ErrKindUnknown, sayaErr.Kind)
+	require.Equal(t, "vm stop", sayaErr.Cmd)
+	require.Equal(t, "ERR vm stop -- failed: vm not found", sayaErr.Message)
+	require.Contains(t, err.Error(), "SayaCmd.Exec -- fail to execute command", "execution details must be kept")
+}
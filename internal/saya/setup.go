@@ -0,0 +1,144 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package saya
+
+import (
+	"context"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/congop/terraform-provider-saya/internal/log"
+	"github.com/congop/terraform-provider-saya/internal/stringutil"
+	"github.com/pkg/errors"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+const (
+	EscalationSudo          = "sudo"             // always run saya setup with sudo
+	EscalationSudoIfNotRoot = "sudo-if-not-root" // run saya setup with sudo unless already root
+	EscalationNone          = "none"             // never escalate privileges
+
+	DefaultEscalation = EscalationSudoIfNotRoot // privilege escalation used when none is specified
+
+	SetupTargetLocalhost = "localhost"
+)
+
+// Escalations lists the supported privilege escalations.
+var Escalations = []string{EscalationSudo, EscalationSudoIfNotRoot, EscalationNone}
+
+// geteuid is a variable so tests can simulate running as root.
+var geteuid = os.Geteuid
+
+// sudoCmd is the privilege escalation prefix; non-interactive because nobody can answer a password prompt.
+var sudoCmd = []string{"sudo", "--non-interactive"}
+
+// NormalizeEscalation returns the escalation, the default one if blank, or an error if it is not supported.
+func NormalizeEscalation(escalation string) (string, error) {
+	escalation = strings.TrimSpace(escalation)
+	if escalation == "" {
+		return DefaultEscalation, nil
+	}
+	if !slices.Contains(Escalations, escalation) {
+		return "", errors.Errorf("NormalizeEscalation -- bad escalation: escalation=%s supported=%q", escalation, Escalations)
+	}
+	return escalation, nil
+}
+
+// EscalationPrefix returns the command prefix escalating the privileges of saya setup for a root user or not;
+// empty if no escalation is needed.
+// Sudo only preserves the allow-listed variables of the minimal environment and the given ones (e.g. the variables
+// set for saya), instead of the whole environment.
+func EscalationPrefix(escalation string, isRoot bool, preserveEnv ...string) []string {
+	if escalation == EscalationSudo || (escalation == EscalationSudoIfNotRoot && !isRoot) {
+		preserved := append(append([]string{}, minimalEnvAllowList...), preserveEnv...)
+		sort.Strings(preserved)
+		preserved = slices.Compact(preserved)
+		return append(append([]string{}, sudoCmd...), "--preserve-env="+strings.Join(preserved, ","))
+	}
+	return nil
+}
+
+// IsLocalRoot returns true if the provider process runs as root.
+func IsLocalRoot() bool {
+	return geteuid() == 0
+}
+
+type SetupRequest struct {
+	ComputeType      string   // compute type of the setup target, defaults to localhost
+	Target           string   // setup target, defaults to localhost
+	WantComputeTypes []string // compute types to be set up, e.g. qemu, virtualbox
+	TargetUser       string   // user the compute types are set up for
+	Escalation       string   // privilege escalation: sudo, sudo-if-not-root (default) or none
+
+	RequestSayaCtx
+}
+
+type SetupResult struct {
+	ComputeTypes []string // compute types installed after the setup; only known for localhost targets
+}
+
+// Setup runs saya setup to install the wanted compute types on the target for the target user.
+func Setup(ctx context.Context, req SetupRequest) (*SetupResult, error) {
+	log.Debugf(ctx, "Setup requested: request=%#v", req)
+	if len(req.WantComputeTypes) == 0 {
+		return nil, errors.Errorf("Setup -- at least one compute type must be wanted")
+	}
+	escalation, err := NormalizeEscalation(req.Escalation)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd, err := NewCmdSetup(req.RequestSayaCtx)
+	if err != nil {
+		return nil, err
+	}
+	computeType := strings.TrimSpace(req.ComputeType)
+	if computeType == "" {
+		computeType = SetupTargetLocalhost
+	}
+	target := strings.TrimSpace(req.Target)
+	if target == "" {
+		target = SetupTargetLocalhost
+	}
+	cmd.appendFlagIfNotBlank("--compute-type", computeType)
+	cmd.appendFlagIfNotBlank("--target", target)
+	cmd.appendMultiFlagIfNotEmpty("--want-compute-type", req.WantComputeTypes)
+	cmd.appendFlagIfNotBlank("--target-user", req.TargetUser)
+	isRoot := IsLocalRoot()
+	if req.IsRemote() {
+		isRoot = strings.TrimSpace(req.Host.User) == "root"
+	}
+	if prefix := EscalationPrefix(escalation, isRoot, maps.Keys(cmd.execEnv.Overrides(cmd.extraEnv()))...); len(prefix) != 0 {
+		cmd.WithEscalation(prefix...)
+	}
+
+	outcome, err := cmd.Exec(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err,
+			"Setup -- fail to execute saya setup command: "+
+				"\n\treq=%#v \n\terr=%s  ",
+			req, stringutil.IndentN(2, err.Error()))
+	}
+	log.Debugf(ctx, "Setup - cmd exec outcome: outcome=%#v", outcome)
+
+	if target != SetupTargetLocalhost || req.IsRemote() {
+		// installed compute types can only be inspected on the machine running the provider
+		return &SetupResult{}, nil
+	}
+	info := InspectHost(ctx, req.RequestSayaCtx)
+	return &SetupResult{ComputeTypes: info.ComputeTypes}, nil
+}
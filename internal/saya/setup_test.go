@@ -0,0 +1,121 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package saya
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/congop/terraform-provider-saya/internal/opaque"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeArgsRecorder records its args into <dir>/<name>.args; as sudo, it skips the -- options and runs the command.
+const fakeArgsRecorder = `#!/bin/sh
+echo "$*" > %s
+while [ "${1#--}" != "$1" ]; do shift; done
+if [ "$#" -gt 0 ] && [ -x "$1" ]; then exec "$@"; fi
+`
+
+func givenFakeArgsRecorder(t *testing.T, dir string, name string) (string, func() string) {
+	argsPath := filepath.Join(dir, name+".args")
+	exe := writeTestFile(t, dir, name, []byte(fmt.Sprintf(fakeArgsRecorder, argsPath)))
+	require.NoError(t, os.Chmod(exe, 0700))
+	return exe, func() string {
+		args, err := os.ReadFile(argsPath)
+		if os.IsNotExist(err) {
+			return ""
+		}
+		require.NoError(t, err)
+		return strings.TrimSpace(string(args))
+	}
+}
+
+func TestSetup(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("fake saya and sudo are shell scripts")
+	}
+	qemuExe := "qemu-system-x86_64"
+	if runtime.GOARCH == "arm64" {
+		qemuExe = "qemu-system-aarch64"
+	}
+
+	tests := []struct {
+		name         string
+		escalation   string
+		euid         int
+		licenseKey   string
+		wantSudoArgs bool
+		wantPreserve string
+		wantErr      bool
+	}{
+		{name: "should-sudo-if-not-root-by-default", euid: 1000, wantSudoArgs: true},
+		{name: "should-not-sudo-when-root", escalation: EscalationSudoIfNotRoot, euid: 0},
+		{name: "should-always-sudo", escalation: EscalationSudo, euid: 0, wantSudoArgs: true},
+		{
+			name: "should-preserve-variables-set-for-saya", escalation: EscalationSudo, euid: 1000, licenseKey: "lk-secret",
+			wantSudoArgs: true, wantPreserve: "SAYA_LICENSE_KEY",
+		},
+		{name: "should-never-sudo", escalation: EscalationNone, euid: 1000},
+		{name: "should-reject-bad-escalation", escalation: "doas", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			sayaExe, sayaArgs := givenFakeArgsRecorder(t, dir, "saya")
+			sudoExe, sudoArgs := givenFakeArgsRecorder(t, dir, "sudo")
+			defer func(orig []string, origGeteuid func() int) { sudoCmd, geteuid = orig, origGeteuid }(sudoCmd, geteuid)
+			sudoCmd = []string{sudoExe, "--non-interactive"}
+			geteuid = func() int { return tt.euid }
+			givenHost(t, map[string]string{sayaExe: sayaExe, qemuExe: "/usr/bin/" + qemuExe}, true)
+
+			res, err := Setup(context.Background(), SetupRequest{
+				WantComputeTypes: []string{"qemu", "virtualbox"},
+				TargetUser:       "dev",
+				Escalation:       tt.escalation,
+				RequestSayaCtx:   RequestSayaCtx{Exe: sayaExe, LicenseKey: *opaque.NewString(tt.licenseKey)},
+			})
+
+			if tt.wantErr {
+				require.Error(t, err)
+				require.Empty(t, sayaArgs())
+				return
+			}
+			require.NoError(t, err)
+			wantSayaArgs := "setup --compute-type localhost --target localhost " +
+				"--want-compute-type qemu --want-compute-type virtualbox --target-user dev"
+			require.Equal(t, wantSayaArgs, sayaArgs())
+			if tt.wantSudoArgs {
+				preserved := append([]string{}, minimalEnvAllowList...)
+				if tt.wantPreserve != "" {
+					preserved = append(preserved, tt.wantPreserve)
+				}
+				sort.Strings(preserved)
+				wantPreserveEnv := "--preserve-env=" + strings.Join(preserved, ",")
+				require.Equal(t, "--non-interactive "+wantPreserveEnv+" "+sayaExe+" "+wantSayaArgs, sudoArgs())
+			} else {
+				require.Empty(t, sudoArgs())
+			}
+			// virtualbox is still missing, the read back only reports what is actually installed
+			require.Equal(t, []string{ComputeTypeQemu}, res.ComputeTypes)
+		})
+	}
+}
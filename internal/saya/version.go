@@ -0,0 +1,71 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package saya
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/congop/terraform-provider-saya/internal/log"
+	"github.com/congop/terraform-provider-saya/internal/stringutil"
+	goversion "github.com/hashicorp/go-version"
+	"github.com/pkg/errors"
+)
+
+var semverRegex = regexp.MustCompile(`v?\d+\.\d+\.\d+(-[0-9A-Za-z.-]+)?(\+[0-9A-Za-z.-]+)?`)
+
+// SayaVersion is the version reported by the saya executable.
+type SayaVersion struct {
+	Raw     string             // the output of saya version
+	Version *goversion.Version // nil if no semantic version could be found, e.g. for development builds
+}
+
+func (v *SayaVersion) String() string {
+	if v == nil {
+		return "<unknown>"
+	}
+	if v.Version != nil {
+		return v.Version.Original()
+	}
+	return strings.TrimSpace(v.Raw)
+}
+
+// ParseSayaVersion extracts the semantic version from the saya version output.
+func ParseSayaVersion(out string) *SayaVersion {
+	v := SayaVersion{Raw: out}
+	if found := semverRegex.FindString(out); found != "" {
+		if parsed, err := goversion.NewSemver(found); err == nil {
+			v.Version = parsed
+		}
+	}
+	return &v
+}
+
+// Version runs saya version and returns the parsed version.
+func Version(ctx context.Context, req RequestSayaCtx) (*SayaVersion, error) {
+	cmd, err := NewCmdVersion(req)
+	if err != nil {
+		return nil, err
+	}
+	outcome, err := cmd.Exec(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err,
+			"Version -- fail to execute saya version command: exe=%s \n\terr=%s",
+			req.Exe, stringutil.IndentN(2, err.Error()))
+	}
+	log.Debugf(ctx, "Version -- cmd exec outcome: outcome=%#v", outcome)
+	return ParseSayaVersion(outcome.Stdout), nil
+}
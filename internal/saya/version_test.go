@@ -0,0 +1,63 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package saya
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSayaVersion(t *testing.T) {
+	tests := []struct {
+		name        string
+		out         string
+		wantVersion string
+	}{
+		{name: "should-parse-semver", out: "saya version v0.3.1 (commit abc1234)\n", wantVersion: "v0.3.1"},
+		{name: "should-parse-bare-semver", out: "0.2.5", wantVersion: "0.2.5"},
+		{name: "should-parse-pre-release", out: "saya 0.2.0-rc.1", wantVersion: "0.2.0-rc.1"},
+		{name: "should-not-know-teaser-version", out: "saya_teaser-20231005T135240"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := ParseSayaVersion(tt.out)
+			if tt.wantVersion == "" {
+				require.Nil(t, v.Version)
+				require.Equal(t, tt.out, v.String())
+				return
+			}
+			require.Equal(t, tt.wantVersion, v.String())
+		})
+	}
+}
+
+func TestVersion(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake saya is a shell script")
+	}
+	sayaExe := writeTestFile(t, t.TempDir(), "saya", []byte("#!/bin/sh\n[ \"$1\" = version ] && echo \"saya v0.2.1\"\n"))
+	require.NoError(t, os.Chmod(sayaExe, 0700))
+
+	v, err := Version(context.Background(), RequestSayaCtx{Exe: sayaExe})
+	require.NoError(t, err)
+	require.Equal(t, "v0.2.1", v.String())
+
+	_, err = Version(context.Background(), RequestSayaCtx{Exe: sayaExe + "-missing"})
+	require.Error(t, err)
+}
@@ -123,16 +123,15 @@ func VmLs(ctx context.Context, req VmLsRequest) ([]VmLsResult, error) {
 	// , but having id result in at most 1 vm, so we are fine for the moment
 	// even if this function s not a full ls command
 
-	singleValueFilters := map[string]string{
-		"name":        req.Name,
-		"compte-type": req.ComputeType,
-		"os-variant":  req.OsVariant,
+	singleValueFilters := [][2]string{
+		{"name", req.Name},
+		{"compute-type", req.ComputeType},
+		{"os-variant", req.OsVariant},
 	}
 	filtersStr := make([]string, 0, len(singleValueFilters))
-	for k, v := range singleValueFilters {
-
-		if v = strings.TrimSpace(v); v != "" {
-			filtersStr = append(filtersStr, k+"="+v)
+	for _, filter := range singleValueFilters {
+		if v := strings.TrimSpace(filter[1]); v != "" {
+			filtersStr = append(filtersStr, filter[0]+"="+v)
 		}
 	}
 	sayaCmd.appendMultiFlagIfNotEmpty("--filter", filtersStr)
@@ -0,0 +1,324 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stubrepo
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/congop/terraform-provider-saya/internal/log"
+	"github.com/congop/terraform-provider-saya/internal/saya"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+type FaultKind string
+
+const (
+	FaultLatency   FaultKind = "latency"    // delays the response by Delay
+	FaultStatus    FaultKind = "status"     // responds with Status, 503 by default, instead of serving the request
+	FaultAuth      FaultKind = "auth"       // rejects the credentials, e.g. auth flapping with Every=2
+	FaultReset     FaultKind = "reset"      // resets the connection after AfterBytes body bytes
+	FaultTruncate  FaultKind = "truncate"   // ends the body after AfterBytes bytes, with a matching Content-Length
+	FaultCorrupt   FaultKind = "corrupt"    // flips the body byte at offset AfterBytes
+	FaultBody      FaultKind = "body"       // replaces the body with Body
+	FaultWrongMeta FaultKind = "wrong-meta" // replaces the sha256 of the served meta data yaml
+)
+
+// wrongMetaSha256 is the sha256 served by FaultWrongMeta.
+const wrongMetaSha256 = "badbadbadbadbadbadbadbadbadbadbadbadbadbadbadbadbadbadbadbadbadb"
+
+// Fault is a failure injected into the responses of the requests it selects.
+// Requests are selected by path suffix and then by their 1-based count among the requests matching the path.
+type Fault struct {
+	Kind        FaultKind
+	PathSuffix  string        // selects requests with a path ending with the suffix; all requests if blank
+	FromRequest int           // first selected matching request; the first one if 0
+	ToRequest   int           // last selected matching request; no limit if 0
+	Every       int           // selects every n-th matching request, starting at FromRequest; each one if 0
+	Delay       time.Duration // FaultLatency
+	Status      int           // FaultStatus
+	AfterBytes  int64         // FaultReset, FaultTruncate, FaultCorrupt
+	Body        []byte        // FaultBody
+}
+
+func (fault *Fault) isBodyFault() bool {
+	switch fault.Kind {
+	case FaultReset, FaultTruncate, FaultCorrupt, FaultBody, FaultWrongMeta:
+		return true
+	}
+	return false
+}
+
+type faultState struct {
+	fault    Fault
+	matching int // count of requests matching the path so far
+}
+
+// selects counts the request if its path matches and returns true if the fault applies to it.
+func (state *faultState) selects(path string) bool {
+	if !strings.HasSuffix(path, state.fault.PathSuffix) {
+		return false
+	}
+	state.matching++
+	from := state.fault.FromRequest
+	if from < 1 {
+		from = 1
+	}
+	switch {
+	case state.matching < from:
+		return false
+	case state.fault.ToRequest > 0 && state.matching > state.fault.ToRequest:
+		return false
+	case state.fault.Every > 1:
+		return (state.matching-from)%state.fault.Every == 0
+	}
+	return true
+}
+
+// FaultInjector injects the configured faults into the responses of the wrapped handler.
+type FaultInjector struct {
+	mu       sync.Mutex
+	faults   []*faultState
+	injected int
+
+	// writeError writes the error response of status and auth faults, in the protocol of the server.
+	writeError func(w http.ResponseWriter, r *http.Request, status int)
+}
+
+func newFaultInjector(writeError func(w http.ResponseWriter, r *http.Request, status int)) *FaultInjector {
+	return &FaultInjector{writeError: writeError}
+}
+
+// Add adds faults, applying to the requests from now on.
+func (injector *FaultInjector) Add(faults ...Fault) error {
+	for _, fault := range faults {
+		switch fault.Kind {
+		case FaultLatency, FaultStatus, FaultAuth, FaultReset, FaultTruncate, FaultCorrupt, FaultBody, FaultWrongMeta:
+		default:
+			return errors.Errorf("FaultInjector.Add -- fault kind not supported: kind=%s", fault.Kind)
+		}
+		if fault.Kind == FaultWrongMeta && fault.PathSuffix == "" {
+			fault.PathSuffix = ".meta"
+		}
+		injector.mu.Lock()
+		injector.faults = append(injector.faults, &faultState{fault: fault})
+		injector.mu.Unlock()
+	}
+	return nil
+}
+
+// Clear removes all faults.
+func (injector *FaultInjector) Clear() {
+	injector.mu.Lock()
+	defer injector.mu.Unlock()
+	injector.faults = nil
+}
+
+// Injected returns the number of faults injected so far.
+func (injector *FaultInjector) Injected() int {
+	injector.mu.Lock()
+	defer injector.mu.Unlock()
+	return injector.injected
+}
+
+// selected returns the faults applying to the request.
+func (injector *FaultInjector) selected(r *http.Request) []Fault {
+	injector.mu.Lock()
+	defer injector.mu.Unlock()
+	faults := []Fault{}
+	for _, state := range injector.faults {
+		if state.selects(r.URL.Path) {
+			faults = append(faults, state.fault)
+		}
+	}
+	injector.injected += len(faults)
+	return faults
+}
+
+// Wrap returns a handler injecting the faults into the responses of next.
+func (injector *FaultInjector) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var bodyFault *Fault
+		for _, fault := range injector.selected(r) {
+			fault := fault
+			log.Infof(StubLogCtx(), "FaultInjector -- injecting fault: method=%s path=%s fault=%+v", r.Method, r.URL.Path, fault)
+			switch {
+			case fault.Kind == FaultLatency:
+				time.Sleep(fault.Delay)
+			case fault.Kind == FaultStatus:
+				status := fault.Status
+				if status == 0 {
+					status = http.StatusServiceUnavailable
+				}
+				injector.writeError(w, r, status)
+				return
+			case fault.Kind == FaultAuth:
+				injector.writeError(w, r, http.StatusUnauthorized)
+				return
+			case bodyFault == nil && fault.isBodyFault() && r.Method != http.MethodHead:
+				bodyFault = &fault
+			}
+		}
+		if bodyFault == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		fw := &faultWriter{ResponseWriter: w, fault: bodyFault}
+		next.ServeHTTP(fw, r)
+		fw.finish()
+	})
+}
+
+// faultWriter applies a body fault to successful responses.
+type faultWriter struct {
+	http.ResponseWriter
+	fault       *Fault
+	status      int
+	wroteHeader bool
+	active      bool // true if the response is subject to the fault
+	written     int64
+	discard     bool         // true if the remaining body is not sent
+	buf         bytes.Buffer // body of FaultWrongMeta
+}
+
+func (fw *faultWriter) WriteHeader(status int) {
+	if fw.wroteHeader {
+		return
+	}
+	fw.wroteHeader = true
+	fw.status = status
+	fw.active = status >= 200 && status < 300
+	if !fw.active {
+		fw.ResponseWriter.WriteHeader(status)
+		return
+	}
+	header := fw.Header()
+	switch fw.fault.Kind {
+	case FaultTruncate:
+		if length, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64); err == nil && length > fw.fault.AfterBytes {
+			header.Set("Content-Length", strconv.FormatInt(fw.fault.AfterBytes, 10))
+		}
+	case FaultBody:
+		header.Set("Content-Length", strconv.Itoa(len(fw.fault.Body)))
+		fw.ResponseWriter.WriteHeader(status)
+		_, _ = fw.ResponseWriter.Write(fw.fault.Body)
+		fw.discard = true
+		return
+	case FaultWrongMeta:
+		// the header is written with the modified meta data by finish
+		return
+	}
+	fw.ResponseWriter.WriteHeader(status)
+}
+
+func (fw *faultWriter) Write(p []byte) (int, error) {
+	if !fw.wroteHeader {
+		fw.WriteHeader(http.StatusOK)
+	}
+	switch {
+	case fw.discard:
+		return len(p), nil
+	case !fw.active:
+		return fw.ResponseWriter.Write(p)
+	case fw.fault.Kind == FaultWrongMeta:
+		return fw.buf.Write(p)
+	case fw.fault.Kind == FaultCorrupt:
+		if offset := fw.fault.AfterBytes - fw.written; offset >= 0 && offset < int64(len(p)) {
+			corrupted := append([]byte{}, p...)
+			corrupted[offset] ^= 0xff
+			p = corrupted
+		}
+		n, err := fw.ResponseWriter.Write(p)
+		fw.written += int64(n)
+		return n, err
+	}
+
+	// FaultTruncate and FaultReset
+	remaining := fw.fault.AfterBytes - fw.written
+	if int64(len(p)) <= remaining {
+		n, err := fw.ResponseWriter.Write(p)
+		fw.written += int64(n)
+		return n, err
+	}
+	n, err := fw.ResponseWriter.Write(p[:remaining])
+	fw.written += int64(n)
+	if err != nil {
+		return n, err
+	}
+	fw.discard = true
+	if fw.fault.Kind == FaultReset {
+		fw.reset()
+		return n, errors.Errorf("faultWriter.Write -- connection reset by fault: written=%d", fw.written)
+	}
+	return len(p), nil
+}
+
+// reset flushes the body written so far and closes the connection without graceful shutdown.
+func (fw *faultWriter) reset() {
+	if flusher, ok := fw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	hijacker, ok := fw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		log.Errorf(StubLogCtx(), "faultWriter.reset -- response writer cannot be hijacked: type=%T", fw.ResponseWriter)
+		return
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		log.Errorf(StubLogCtx(), "faultWriter.reset -- fail to hijack connection: err=%v", err)
+		return
+	}
+	_ = rw.Flush()
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		_ = tcpConn.SetLinger(0) // RST instead of FIN
+	}
+	_ = conn.Close()
+}
+
+func (fw *faultWriter) Flush() {
+	if flusher, ok := fw.ResponseWriter.(http.Flusher); ok && !fw.discard && fw.fault.Kind != FaultWrongMeta {
+		flusher.Flush()
+	}
+}
+
+// finish writes the response of FaultWrongMeta once the handler has written the meta data.
+func (fw *faultWriter) finish() {
+	if !fw.active || fw.fault.Kind != FaultWrongMeta {
+		return
+	}
+	body := fw.buf.Bytes()
+	meta := saya.ImageTagMetaData{}
+	if err := yaml.Unmarshal(body, &meta); err != nil {
+		log.Errorf(StubLogCtx(), "faultWriter.finish -- served body is not image meta data, left as is: err=%v", err)
+	} else {
+		meta.Sha256 = wrongMetaSha256
+		wrongMeta := bytes.Buffer{}
+		if err := PersistImgMeta(&wrongMeta, &meta); err != nil {
+			log.Errorf(StubLogCtx(), "faultWriter.finish -- fail to persist wrong meta: err=%v", err)
+		} else {
+			body = wrongMeta.Bytes()
+		}
+	}
+	fw.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	fw.Header().Del("ETag")
+	fw.ResponseWriter.WriteHeader(fw.status)
+	_, _ = fw.ResponseWriter.Write(body)
+}
@@ -0,0 +1,190 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stubrepo
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/congop/terraform-provider-saya/internal/saya"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestHttpRepoFaults(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 64*1024)
+
+	type response struct {
+		status  int
+		body    []byte
+		readErr bool
+	}
+	testCases := []struct {
+		name       string
+		fault      Fault
+		requests   int
+		path       string
+		want       func(i int, res response)
+		minElapsed time.Duration
+	}{
+		{
+			name:       "latency",
+			fault:      Fault{Kind: FaultLatency, Delay: 200 * time.Millisecond},
+			requests:   1,
+			minElapsed: 200 * time.Millisecond,
+			want: func(i int, res response) {
+				require.Equal(t, http.StatusOK, res.status)
+				require.Equal(t, content, res.body)
+			},
+		},
+		{
+			name:     "intermittent 5xx on the image only",
+			fault:    Fault{Kind: FaultStatus, PathSuffix: "img.qcow2", Every: 2},
+			requests: 4,
+			want: func(i int, res response) {
+				require.Equal(t, []int{http.StatusServiceUnavailable, http.StatusOK}[i%2], res.status, "request %d", i)
+			},
+		},
+		{
+			name:     "status on the meta only",
+			fault:    Fault{Kind: FaultStatus, PathSuffix: ".meta", Status: http.StatusInternalServerError},
+			requests: 1,
+			want: func(i int, res response) {
+				require.Equal(t, http.StatusOK, res.status)
+			},
+		},
+		{
+			name:     "auth flapping from the second request",
+			fault:    Fault{Kind: FaultAuth, FromRequest: 2, Every: 2},
+			requests: 4,
+			want: func(i int, res response) {
+				require.Equal(t, []int{http.StatusOK, http.StatusUnauthorized}[i%2], res.status, "request %d", i)
+			},
+		},
+		{
+			name:     "connection reset mid body for the first request",
+			fault:    Fault{Kind: FaultReset, AfterBytes: 1000, ToRequest: 1},
+			requests: 2,
+			want: func(i int, res response) {
+				require.Equal(t, i == 0, res.readErr, "request %d", i)
+				if i == 1 {
+					require.Equal(t, content, res.body)
+				}
+			},
+		},
+		{
+			name:     "truncated",
+			fault:    Fault{Kind: FaultTruncate, AfterBytes: 1000},
+			requests: 1,
+			want: func(i int, res response) {
+				require.False(t, res.readErr)
+				require.Equal(t, content[:1000], res.body)
+			},
+		},
+		{
+			name:     "corrupted",
+			fault:    Fault{Kind: FaultCorrupt, AfterBytes: 70000},
+			requests: 1,
+			want: func(i int, res response) {
+				require.Len(t, res.body, len(content))
+				require.NotEqual(t, content, res.body)
+				require.Equal(t, content[:70000], res.body[:70000])
+				require.Equal(t, content[70001:], res.body[70001:])
+			},
+		},
+		{
+			name:     "body replaced",
+			fault:    Fault{Kind: FaultBody, Body: []byte("not an image")},
+			requests: 1,
+			want: func(i int, res response) {
+				require.Equal(t, "not an image", string(res.body))
+			},
+		},
+		{
+			name:     "wrong meta",
+			fault:    Fault{Kind: FaultWrongMeta},
+			requests: 1,
+			path:     httpRepoTestImgPath + ".meta",
+			want: func(i int, res response) {
+				require.Equal(t, http.StatusOK, res.status)
+				meta := saya.ImageTagMetaData{}
+				require.NoError(t, yaml.Unmarshal(res.body, &meta))
+				require.Equal(t, wrongMetaSha256, meta.Sha256)
+				require.Equal(t, "alpine", meta.Name)
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := givenHttpRepoStarted(t, NewDirHttpRepo(t.TempDir()))
+			_, err := repo.RegisterImgFile(httpRepoTestSpec, bytes.NewReader(content), true)
+			require.NoError(t, err)
+			require.NoError(t, repo.Faults().Add(tc.fault))
+			path := tc.path
+			if path == "" {
+				path = httpRepoTestImgPath
+			}
+			client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+
+			for i := 0; i < tc.requests; i++ {
+				start := time.Now()
+				res, err := client.Get(repo.RepoUrl(path))
+				require.NoError(t, err)
+				body, readErr := io.ReadAll(res.Body)
+				_ = res.Body.Close()
+				require.GreaterOrEqual(t, time.Since(start), tc.minElapsed)
+
+				tc.want(i, response{status: res.StatusCode, body: body, readErr: readErr != nil})
+			}
+		})
+	}
+}
+
+func TestHttpRepoFaultRejectsUnknownKind(t *testing.T) {
+	err := NewDummyHttpRepo().Faults().Add(Fault{Kind: "explode"})
+
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "not supported")
+}
+
+func TestS3ServerFaults(t *testing.T) {
+	ctx := context.Background()
+	server := givenS3ServerStarted(t)
+	server.CreateBucket("bucket")
+	client := s3ServerTestClient(t, server, s3ServerTestCreds)
+	_, err := client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: awssdk.String("bucket"), Key: awssdk.String("img.qcow2"), Body: bytes.NewReader([]byte("content")),
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, server.Faults().Add(Fault{Kind: FaultStatus, PathSuffix: "img.qcow2", ToRequest: 2}))
+	got, err := client.GetObject(ctx, &s3.GetObjectInput{Bucket: awssdk.String("bucket"), Key: awssdk.String("img.qcow2")})
+	require.NoError(t, err, "sdk must retry transient 503")
+	gotContent, err := io.ReadAll(got.Body)
+	require.NoError(t, err)
+	require.Equal(t, "content", string(gotContent))
+	require.Equal(t, 2, server.Faults().Injected())
+
+	server.Faults().Clear()
+	require.NoError(t, server.Faults().Add(Fault{Kind: FaultAuth}))
+	_, err = client.GetObject(ctx, &s3.GetObjectInput{Bucket: awssdk.String("bucket"), Key: awssdk.String("img.qcow2")})
+	requireS3ErrorCode(t, err, "AccessDenied")
+}
@@ -91,26 +91,15 @@ func NewDummyImg(
 		return nil, err
 	}
 
-	urlPathSegments := ImageRepoDirRelUrlSegments(&pullSpecData.Platform, pullSpecData.Tag.Name, pullSpecData.Tag.Version)
-	imageFileBasename, err := ImgFileName(pullSpecData.ImgType)
+	urlPath, err := imgUrlPath(pullSpecData)
 	if err != nil {
 		return nil, err
 	}
-	urlPath := strings.Join(append(urlPathSegments, imageFileBasename), "/")
-
-	metaData := saya.ImageTagMetaData{
-		Name:      pullSpecData.Tag.Name,
-		Version:   pullSpecData.Tag.Version,
-		Sha256:    sha256,
-		Type:      pullSpecData.ImgType,
-		Platform:  saya.PlatformSw{Platform: pullSpecData.Platform, OsVariant: pullSpecData.OsVariant},
-		CreatedAt: time.Now(),
-		SrcType:   pullSpecData.RepoType,
-	}
+	metaData := imgMetaData(pullSpecData, sha256)
 
 	dummyImg := DummyImg{
 		img:       img,
-		metaData:  &metaData,
+		metaData:  metaData,
 		meta:      nil,
 		withMeta:  withMeta,
 		BasicAuth: basicAuth,
@@ -120,21 +109,81 @@ func NewDummyImg(
 	return &dummyImg, nil
 }
 
+// imgUrlPath returns the path of the image relative to the repository base path.
+func imgUrlPath(pullSpecData PullImgSpecData) (string, error) {
+	urlPathSegments := ImageRepoDirRelUrlSegments(&pullSpecData.Platform, pullSpecData.Tag.Name, pullSpecData.Tag.Version)
+	imageFileBasename, err := ImgFileName(pullSpecData.ImgType)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(append(urlPathSegments, imageFileBasename), "/"), nil
+}
+
+func imgMetaData(pullSpecData PullImgSpecData, sha256 string) *saya.ImageTagMetaData {
+	return &saya.ImageTagMetaData{
+		Name:      pullSpecData.Tag.Name,
+		Version:   pullSpecData.Tag.Version,
+		Sha256:    sha256,
+		Type:      pullSpecData.ImgType,
+		Platform:  saya.PlatformSw{Platform: pullSpecData.Platform, OsVariant: pullSpecData.OsVariant},
+		CreatedAt: time.Now(),
+		SrcType:   pullSpecData.RepoType,
+	}
+}
+
+// HttpRepo is a http repository serving images from memory or, if dir is set, from a directory.
 type HttpRepo struct {
 	ramImgStore map[string]*DummyImg
+	dir         string              // directory the images are served from and uploaded to; memory is used if blank
+	basicAuth   *saya.AuthHttpBasic // repository wide credentials, checked in addition to the ones of the dummy images
+	faults      *FaultInjector
+	addr        string // listen address, a random localhost port if blank
 	ip          string
 	port        uint16
 	httpServer  *http.Server
 }
 
 func NewDummyHttpRepo() *HttpRepo {
-	return &HttpRepo{ramImgStore: map[string]*DummyImg{}}
+	return &HttpRepo{ramImgStore: map[string]*DummyImg{}, faults: newFaultInjector(writeHttpFault)}
+}
+
+// NewDirHttpRepo returns a repository serving the image files of the directory, which also stores uploads.
+// Files are streamed and support HEAD and Range requests, so that large images can be used.
+func NewDirHttpRepo(dir string) *HttpRepo {
+	return &HttpRepo{ramImgStore: map[string]*DummyImg{}, dir: dir, faults: newFaultInjector(writeHttpFault)}
+}
+
+// Faults returns the injector of the faults of the repository responses.
+func (repo *HttpRepo) Faults() *FaultInjector {
+	return repo.faults
+}
+
+func writeHttpFault(w http.ResponseWriter, r *http.Request, status int) {
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="saya-stubrepo", charset="UTF-8"`)
+	}
+	http.Error(w, "fault injected: "+http.StatusText(status), status)
+}
+
+// WithAddr sets the address the repository listens at, e.g. 127.0.0.1:10099.
+func (repo *HttpRepo) WithAddr(addr string) *HttpRepo {
+	repo.addr = addr
+	return repo
+}
+
+// WithBasicAuth requires the credentials for all requests.
+func (repo *HttpRepo) WithBasicAuth(basicAuth *saya.AuthHttpBasic) *HttpRepo {
+	repo.basicAuth = basicAuth
+	return repo
 }
 
 func (repo *HttpRepo) RegisterDummyImg(img *DummyImg) error {
 	if img == nil {
 		return errors.Errorf("DummyHttpRepo.RegisterDummyImg -- img must nor be nil")
 	}
+	if repo.dir != "" {
+		return repo.writeDummyImg(img)
+	}
 	repo.ramImgStore[img.UrlPath] = img
 	repo.ramImgStore[img.UrlPath+".meta"] = img
 	return nil
@@ -166,7 +215,10 @@ func (repo *HttpRepo) Start() error {
 	// engine.Handle("GET", "/repo", repo.GetData)
 	engine.NoRoute(repo.NoRoot)
 
-	addrStr := "localhost:0"
+	addrStr := repo.addr
+	if addrStr == "" {
+		addrStr = "localhost:0"
+	}
 	ln, err := net.Listen("tcp", addrStr)
 	if err != nil {
 		return errors.Wrapf(
@@ -176,7 +228,7 @@ func (repo *HttpRepo) Start() error {
 	addr := ln.Addr()
 	srv := &http.Server{
 		Addr:    addr.String(),
-		Handler: engine,
+		Handler: repo.faults.Wrap(engine),
 	}
 	repo.httpServer = srv
 	go func() {
@@ -208,13 +260,14 @@ func (repo *HttpRepo) NoRoot(ginCtx *gin.Context) {
 	log.Infof(StubLogCtx(), "DummyHttpRepo.NoRoot -- request: method=%s resPath=%s available=%v", method, resPath, maps.Keys(repo.ramImgStore))
 
 	switch method {
-	case "HEAD":
-		ginCtx.Status(http.StatusNotImplemented)
-	case "GET":
+	case http.MethodGet, http.MethodHead:
 		repo.GetData(ginCtx)
+	case http.MethodPut:
+		repo.PutData(ginCtx)
 	default:
-		log.Infof(StubLogCtx(), "DummyHttpRepo.NoRoot -- not found: method=%s resPath=%s available=%v", method, resPath, maps.Keys(repo.ramImgStore))
-		ginCtx.Status(http.StatusNotFound)
+		log.Infof(StubLogCtx(), "DummyHttpRepo.NoRoot -- method not allowed: method=%s resPath=%s", method, resPath)
+		ginCtx.Header("Allow", "GET, HEAD, PUT")
+		ginCtx.Status(http.StatusMethodNotAllowed)
 	}
 }
 
@@ -236,6 +289,13 @@ func (repo *HttpRepo) GetData(ginCtx *gin.Context) {
 	resPathHttp := ginCtx.Request.URL.Path
 	log.Infof(StubLogCtx(), "DummyHttpRepo.GetData -- request: resPathHttp=%s available=%v", resPathHttp, maps.Keys(repo.ramImgStore))
 	resPath := strings.TrimPrefix(resPathHttp, "/repo/")
+	if !repo.authorized(ginCtx, repo.basicAuth) {
+		return
+	}
+	if repo.dir != "" {
+		repo.serveFile(ginCtx, resPath)
+		return
+	}
 	dummyImg, avail := repo.ramImgStore[resPath]
 	if dummyImg == nil || !avail {
 
@@ -243,26 +303,47 @@ func (repo *HttpRepo) GetData(ginCtx *gin.Context) {
 		ginCtx.Data(http.StatusNotFound, "", []byte("no dummy img found:"+resPath))
 		return
 	}
-	if dummyImg.BasicAuth != nil {
-		u, p, ok := ginCtx.Request.BasicAuth()
-		if !ok || u != dummyImg.BasicAuth.Username || p != dummyImg.BasicAuth.Pwd {
-			// Todo add WWW-Authenticate: Basic realm="User Visible Realm"
-			// @see https://en.wikipedia.org/wiki/Basic_access_authentication
-			ginCtx.Status(http.StatusForbidden)
-			return
-		}
+	if !repo.authorized(ginCtx, dummyImg.BasicAuth) {
+		return
 	}
 	switch {
 	case strings.HasSuffix(resPath, dummyImg.UrlPath):
-		ginCtx.Data(http.StatusOK, "", dummyImg.img)
+		serveBytes(ginCtx, dummyImg.img)
 	case strings.HasSuffix(resPath, ".meta") && dummyImg.metaData != nil:
 		metaByte, err := dummyImg.MetaDataAsBytes()
 		if err != nil {
 			log.Errorf(StubLogCtx(), "DummyHttpRepo.GetData -- fail to make meta bytes: path=%s, err=%+v", resPath, err)
 		}
-		ginCtx.Data(http.StatusOK, "", metaByte)
+		serveBytes(ginCtx, metaByte)
 	default:
 		ginCtx.Status(http.StatusNotFound)
 	}
 
 }
+
+// serveBytes serves the content with ETag, supporting HEAD, Range and conditional requests.
+func serveBytes(ginCtx *gin.Context, content []byte) {
+	sha256, err := DigestSha256(bytes.NewReader(content))
+	if err != nil {
+		ginCtx.Status(http.StatusInternalServerError)
+		return
+	}
+	ginCtx.Header("ETag", `"`+sha256+`"`)
+	ginCtx.Header("Content-Type", "application/octet-stream")
+	http.ServeContent(ginCtx.Writer, ginCtx.Request, "", time.Time{}, bytes.NewReader(content))
+}
+
+// authorized checks the basic auth credentials if required and challenges the client if they do not match.
+func (repo *HttpRepo) authorized(ginCtx *gin.Context, basicAuth *saya.AuthHttpBasic) bool {
+	if basicAuth == nil {
+		return true
+	}
+	u, p, ok := ginCtx.Request.BasicAuth()
+	if ok && u == basicAuth.Username && p == basicAuth.Pwd.Value() {
+		return true
+	}
+	// @see https://en.wikipedia.org/wiki/Basic_access_authentication
+	ginCtx.Header("WWW-Authenticate", `Basic realm="saya-stubrepo", charset="UTF-8"`)
+	ginCtx.Status(http.StatusUnauthorized)
+	return false
+}
@@ -0,0 +1,174 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stubrepo
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	stderrors "errors"
+
+	"github.com/congop/terraform-provider-saya/internal/log"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// filePath returns the path of the repository file, which cannot be outside of the repository directory.
+func (repo *HttpRepo) filePath(resPath string) string {
+	return filepath.Join(repo.dir, filepath.FromSlash(path.Clean("/"+resPath)))
+}
+
+// fileETag returns an ETag derived from size and modification time, the content being too big to be hashed per request.
+func fileETag(fi os.FileInfo) string {
+	return fmt.Sprintf(`"%x-%x"`, fi.Size(), fi.ModTime().UnixNano())
+}
+
+// serveFile streams the repository file, supporting HEAD, Range and conditional requests.
+func (repo *HttpRepo) serveFile(ginCtx *gin.Context, resPath string) {
+	filePath := repo.filePath(resPath)
+	f, err := os.Open(filePath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Errorf(StubLogCtx(), "DummyHttpRepo.serveFile -- fail to open: path=%s err=%v", filePath, err)
+		}
+		ginCtx.Status(http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil || fi.IsDir() {
+		ginCtx.Status(http.StatusNotFound)
+		return
+	}
+	ginCtx.Header("ETag", fileETag(fi))
+	ginCtx.Header("Content-Type", "application/octet-stream")
+	http.ServeContent(ginCtx.Writer, ginCtx.Request, "", fi.ModTime(), f)
+}
+
+// PutData stores the uploaded file in the repository directory; in-memory repositories do not support uploads.
+func (repo *HttpRepo) PutData(ginCtx *gin.Context) {
+	if repo.dir == "" {
+		ginCtx.Header("Allow", "GET, HEAD")
+		ginCtx.Status(http.StatusMethodNotAllowed)
+		return
+	}
+	if !repo.authorized(ginCtx, repo.basicAuth) {
+		return
+	}
+	resPath := path.Clean("/" + ginCtx.Request.URL.Path)
+	if !strings.HasPrefix(resPath, "/repo/") {
+		ginCtx.Status(http.StatusNotFound)
+		return
+	}
+	filePath := repo.filePath(strings.TrimPrefix(resPath, "/repo/"))
+	_, statErr := os.Stat(filePath)
+
+	_, err := writeFileStreamedSized(filePath, ginCtx.Request.Body, ginCtx.Request.ContentLength)
+	switch {
+	case stderrors.Is(err, errSizeMismatch):
+		log.Infof(StubLogCtx(), "DummyHttpRepo.PutData -- upload rejected: path=%s err=%v", filePath, err)
+		ginCtx.Status(http.StatusBadRequest)
+	case err != nil:
+		log.Errorf(StubLogCtx(), "DummyHttpRepo.PutData -- fail to store upload: path=%s err=%v", filePath, err)
+		ginCtx.Status(http.StatusInternalServerError)
+	case statErr == nil:
+		ginCtx.Status(http.StatusNoContent)
+	default:
+		ginCtx.Status(http.StatusCreated)
+	}
+}
+
+// errSizeMismatch is returned by writeFileStreamedSized if the content has not the expected size.
+var errSizeMismatch = stderrors.New("content size mismatch")
+
+// writeFileStreamed writes the content to a temporary file renamed to path, so that readers never see partial files.
+func writeFileStreamed(filePath string, content io.Reader) (int64, error) {
+	return writeFileStreamedSized(filePath, content, -1)
+}
+
+// writeFileStreamedSized is writeFileStreamed which leaves path untouched if the content size is not the expected one.
+// A negative size means that the size is unknown.
+func writeFileStreamedSized(filePath string, content io.Reader, size int64) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(filePath), 0700); err != nil {
+		return 0, errors.Wrapf(err, "writeFileStreamed -- fail to make dir: path=%s err=%v", filePath, err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), filepath.Base(filePath)+".*.tmp")
+	if err != nil {
+		return 0, errors.Wrapf(err, "writeFileStreamed -- fail to create temp file: path=%s err=%v", filePath, err)
+	}
+	defer os.Remove(tmp.Name())
+	written, err := io.Copy(tmp, content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return written, errors.Wrapf(err, "writeFileStreamed -- fail to write: path=%s err=%v", tmp.Name(), err)
+	}
+	if size >= 0 && written != size {
+		return written, errors.Wrapf(errSizeMismatch, "writeFileStreamed -- unexpected size: path=%s size=%d written=%d", filePath, size, written)
+	}
+	if err := os.Rename(tmp.Name(), filePath); err != nil {
+		return written, errors.Wrapf(err, "writeFileStreamed -- fail to rename: src=%s dst=%s err=%v", tmp.Name(), filePath, err)
+	}
+	return written, nil
+}
+
+// writeDummyImg writes the image and its meta data, if it is to be served, to the repository directory.
+func (repo *HttpRepo) writeDummyImg(img *DummyImg) error {
+	if _, err := writeFileStreamed(repo.filePath(img.UrlPath), bytes.NewReader(img.img)); err != nil {
+		return err
+	}
+	metaBytes, err := img.MetaDataAsBytes()
+	if err != nil || metaBytes == nil {
+		return err
+	}
+	_, err = writeFileStreamed(repo.filePath(img.UrlPath+".meta"), bytes.NewReader(metaBytes))
+	return err
+}
+
+// RegisterImgFile streams the content as image of the directory repository and returns its sha256.
+// Unlike dummy images, the content can have any size, e.g. to test multi-GB pulls.
+func (repo *HttpRepo) RegisterImgFile(pullSpecData PullImgSpecData, content io.Reader, withMeta bool) (string, error) {
+	if repo.dir == "" {
+		return "", errors.Errorf("DummyHttpRepo.RegisterImgFile -- repository not directory backed: spec=%v", pullSpecData)
+	}
+	urlPath, err := imgUrlPath(pullSpecData)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	if _, err := writeFileStreamed(repo.filePath(urlPath), io.TeeReader(content, h)); err != nil {
+		return "", err
+	}
+	digest := fmt.Sprintf("%x", h.Sum(nil))
+	if !withMeta {
+		return digest, nil
+	}
+	metaBuf := bytes.Buffer{}
+	if err := PersistImgMeta(&metaBuf, imgMetaData(pullSpecData, digest)); err != nil {
+		return "", err
+	}
+	if _, err := writeFileStreamed(repo.filePath(urlPath+".meta"), &metaBuf); err != nil {
+		return "", err
+	}
+	return digest, nil
+}
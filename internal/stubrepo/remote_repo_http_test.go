@@ -0,0 +1,176 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stubrepo
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/congop/terraform-provider-saya/internal/opaque"
+	"github.com/congop/terraform-provider-saya/internal/saya"
+	"github.com/stretchr/testify/require"
+)
+
+var httpRepoTestSpec = PullImgSpecData{
+	Tag:       saya.Reference{Original: "alpine:v1", Name: "alpine", Version: "v1"},
+	OsVariant: "alpine",
+	Platform:  saya.Platform{Os: "linux", Arch: "amd64"},
+	RepoType:  "http",
+	ImgType:   "qcow2",
+}
+
+const httpRepoTestImgPath = "alpine/v1/linux/amd64/img.qcow2"
+
+func givenHttpRepoStarted(t *testing.T, repo *HttpRepo) *HttpRepo {
+	require.NoError(t, repo.Start())
+	t.Cleanup(func() { _ = repo.Close() })
+	return repo
+}
+
+func doHttpRepoRequest(t *testing.T, method, url string, body io.Reader, header map[string]string) (*http.Response, []byte) {
+	req, err := http.NewRequest(method, url, body)
+	require.NoError(t, err)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	resBody, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	return res, resBody
+}
+
+func TestDirHttpRepoServesImgFile(t *testing.T) {
+	repo := givenHttpRepoStarted(t, NewDirHttpRepo(t.TempDir()))
+	content := bytes.Repeat([]byte("0123456789abcdef"), 1024*1024/16*3)
+	sha256, err := repo.RegisterImgFile(httpRepoTestSpec, bytes.NewReader(content), true)
+	require.NoError(t, err)
+	wantSha256, err := DigestSha256(bytes.NewReader(content))
+	require.NoError(t, err)
+	require.Equal(t, wantSha256, sha256)
+	imgUrl := repo.RepoUrl(httpRepoTestImgPath)
+
+	res, body := doHttpRepoRequest(t, http.MethodGet, imgUrl, nil, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, content, body)
+	etag := res.Header.Get("ETag")
+	require.NotEmpty(t, etag)
+
+	res, body = doHttpRepoRequest(t, http.MethodHead, imgUrl, nil, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Empty(t, body)
+	require.Equal(t, int64(len(content)), res.ContentLength)
+	require.Equal(t, etag, res.Header.Get("ETag"))
+	require.Equal(t, "bytes", res.Header.Get("Accept-Ranges"))
+
+	res, body = doHttpRepoRequest(t, http.MethodGet, imgUrl, nil, map[string]string{"Range": "bytes=1048576-", "If-Range": etag})
+	require.Equal(t, http.StatusPartialContent, res.StatusCode)
+	require.Equal(t, content[1048576:], body)
+
+	res, body = doHttpRepoRequest(t, http.MethodGet, imgUrl, nil, map[string]string{"Range": "bytes=16-", "If-Range": `"stale"`})
+	require.Equal(t, http.StatusOK, res.StatusCode, "stale If-Range must serve the whole file")
+	require.Equal(t, content, body)
+
+	res, body = doHttpRepoRequest(t, http.MethodGet, imgUrl+".meta", nil, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Contains(t, string(body), sha256)
+
+	res, _ = doHttpRepoRequest(t, http.MethodGet, repo.RepoUrl("../../etc/passwd"), nil, nil)
+	require.Equal(t, http.StatusNotFound, res.StatusCode)
+}
+
+func TestDirHttpRepoPutUpload(t *testing.T) {
+	repo := givenHttpRepoStarted(t, NewDirHttpRepo(t.TempDir()))
+	imgUrl := repo.RepoUrl(httpRepoTestImgPath)
+
+	res, _ := doHttpRepoRequest(t, http.MethodPut, imgUrl, strings.NewReader("v1"), nil)
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+	res, _ = doHttpRepoRequest(t, http.MethodPut, imgUrl, strings.NewReader("v2"), nil)
+	require.Equal(t, http.StatusNoContent, res.StatusCode)
+
+	res, body := doHttpRepoRequest(t, http.MethodGet, imgUrl, nil, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, "v2", string(body))
+}
+
+func TestHttpRepoBasicAuthChallenge(t *testing.T) {
+	basicAuth := &saya.AuthHttpBasic{Username: "user", Pwd: *opaque.NewString("pwd")}
+	testCases := []struct {
+		name string
+		repo func(t *testing.T) *HttpRepo
+	}{
+		{
+			name: "directory repository",
+			repo: func(t *testing.T) *HttpRepo {
+				repo := NewDirHttpRepo(t.TempDir()).WithBasicAuth(basicAuth)
+				_, err := repo.RegisterImgFile(httpRepoTestSpec, strings.NewReader("img"), false)
+				require.NoError(t, err)
+				return repo
+			},
+		},
+		{
+			name: "in-memory repository with image credentials",
+			repo: func(t *testing.T) *HttpRepo {
+				repo := NewDummyHttpRepo()
+				img, err := NewDummyImg([]byte("img"), false, httpRepoTestSpec, basicAuth)
+				require.NoError(t, err)
+				require.NoError(t, repo.RegisterDummyImg(img))
+				return repo
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := givenHttpRepoStarted(t, tc.repo(t))
+			imgUrl := repo.RepoUrl(httpRepoTestImgPath)
+
+			res, _ := doHttpRepoRequest(t, http.MethodGet, imgUrl, nil, nil)
+			require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+			require.Contains(t, res.Header.Get("WWW-Authenticate"), "Basic realm=")
+
+			req, err := http.NewRequest(http.MethodHead, imgUrl, nil)
+			require.NoError(t, err)
+			req.SetBasicAuth(basicAuth.Username, basicAuth.Pwd.Value())
+			authRes, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer authRes.Body.Close()
+			require.Equal(t, http.StatusOK, authRes.StatusCode)
+			require.Equal(t, int64(len("img")), authRes.ContentLength)
+		})
+	}
+}
+
+func TestWriteFileStreamedSizedKeepsFileOnSizeMismatch(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "img.qcow2")
+	_, err := writeFileStreamed(filePath, strings.NewReader("v1"))
+	require.NoError(t, err)
+
+	written, err := writeFileStreamedSized(filePath, strings.NewReader("v2-truncated"), 3)
+	require.ErrorIs(t, err, errSizeMismatch)
+	require.Equal(t, int64(len("v2-truncated")), written)
+
+	content, err := os.ReadFile(filePath)
+	require.NoError(t, err)
+	require.Equal(t, "v1", string(content), "existing file must be left untouched")
+	entries, err := os.ReadDir(filepath.Dir(filePath))
+	require.NoError(t, err)
+	require.Len(t, entries, 1, "temp file must be removed")
+}
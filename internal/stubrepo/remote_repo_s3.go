@@ -20,9 +20,11 @@ import (
 	"io"
 	"net"
 	"path"
+	"strings"
 
 	awssdk "github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/congop/terraform-provider-saya/internal/opaque"
 	"github.com/congop/terraform-provider-saya/internal/saya"
 	"github.com/congop/terraform-provider-saya/internal/stringutil"
 	"github.com/pkg/errors"
@@ -33,19 +35,48 @@ type ImgRegisterer interface {
 	RegisterDummyImg(img *DummyImg) error
 }
 
+// EnvS3RepoContainer opts in to the LocalStack container as s3 repository of GivenS3RepoStarted (requires docker).
+const EnvS3RepoContainer = "TF_SAYA_STUBREPO_S3_CONTAINER"
+
+const (
+	s3RepoAccessKeyId     = "test"
+	s3RepoSecretAccessKey = "test"
+)
+
+// RepoS3 is a s3 repository served in-process by a S3Server or, opt-in, by a LocalStack container.
 type RepoS3 struct {
+	withContainer bool
+	server        *S3Server
 	tc            testcontainers.Container
-	portLsGateway int
+	port          int
 	s3Client      *s3.Client
 }
 
+// NewRepoS3 returns a s3 repository served by an in-process S3Server.
+func NewRepoS3() *RepoS3 {
+	return &RepoS3{}
+}
+
+// NewContainerRepoS3 returns a s3 repository served by a LocalStack container, which requires docker.
+func NewContainerRepoS3() *RepoS3 {
+	return &RepoS3{withContainer: true}
+}
+
 func (repo *RepoS3) Log(logf func(format string, args ...any)) {
 	if repo == nil {
 		return
 	}
+	if repo.server != nil {
+		logf("RepoS3.Log --  server request log: %s", stringutil.IndentN(3, strings.Join(repo.server.RequestLog(), "\n")))
+		return
+	}
+	if repo.tc == nil {
+		return
+	}
 	rc, err := repo.tc.Logs(StubLogCtx())
 	if err != nil {
 		logf("RepoS3 -- fail to get log: err=%v", err)
+		return
 	}
 
 	defer rc.Close()
@@ -58,6 +89,14 @@ func (repo *RepoS3) Log(logf func(format string, args ...any)) {
 	logf("RepoS3.Log --  container log: %s", stringutil.IndentN(3, string(allBytes)))
 }
 
+// Faults returns the injector of the faults of the in-process server, nil if served by a container.
+func (repo *RepoS3) Faults() *FaultInjector {
+	if repo.server == nil {
+		return nil
+	}
+	return repo.server.Faults()
+}
+
 func (repo *RepoS3) getS3Client() (*s3.Client, error) {
 	if repo.s3Client != nil {
 		return repo.s3Client, nil
@@ -73,7 +112,7 @@ func (repo *RepoS3) getS3Client() (*s3.Client, error) {
 		},
 		&awssdk.Credentials{
 			AccessKeyID:     s3Repo.AuthAwsCreds.AccessKeyID,
-			SecretAccessKey: s3Repo.AuthAwsCreds.SecretAccessKey,
+			SecretAccessKey: s3Repo.AuthAwsCreds.SecretAccessKey.Value(),
 		},
 		s3Repo.Region)
 	if err != nil {
@@ -149,7 +188,7 @@ func (repo *RepoS3) RegisterDummyImg(img *DummyImg) error {
 		},
 		Credentials: &awssdk.Credentials{
 			AccessKeyID:     s3Repo.AuthAwsCreds.AccessKeyID,
-			SecretAccessKey: s3Repo.AuthAwsCreds.SecretAccessKey,
+			SecretAccessKey: s3Repo.AuthAwsCreds.SecretAccessKey.Value(),
 		},
 		Region: s3Repo.Region,
 		Tx:     txs,
@@ -162,6 +201,14 @@ func (repo *RepoS3) RegisterDummyImg(img *DummyImg) error {
 }
 
 func (repo *RepoS3) Close() error {
+	if repo == nil {
+		return nil
+	}
+	if server := repo.server; server != nil {
+		if err := server.Close(); err != nil {
+			return errors.Wrapf(err, "DummyRepoS3 -- fail to close server: err =%v", err)
+		}
+	}
 	if tc := repo.tc; tc != nil {
 		err := tc.Terminate(StubLogCtx())
 		if err != nil {
@@ -177,12 +224,12 @@ func (repo *RepoS3) AsRepos() *saya.Repos {
 		S3: &saya.S3Repo{
 			Bucket:  "repobucket",
 			BaseKey: "rbase",
-			EpUrl:   fmt.Sprintf("http://localhost:%d", repo.portLsGateway),
-			EpUrlS3: fmt.Sprintf("http://localhost:%d/", repo.portLsGateway),
+			EpUrl:   fmt.Sprintf("http://localhost:%d", repo.port),
+			EpUrlS3: fmt.Sprintf("http://localhost:%d/", repo.port),
 			Region:  "us-east-1",
 			AuthAwsCreds: &saya.AwsCredentials{
-				AccessKeyID:     "test",
-				SecretAccessKey: "test",
+				AccessKeyID:     s3RepoAccessKeyId,
+				SecretAccessKey: *opaque.NewString(s3RepoSecretAccessKey),
 			},
 		},
 	}
@@ -205,6 +252,26 @@ func FreeLocalhostTcp4Port() (int, error) {
 }
 
 func (repo *RepoS3) Start() error {
+	if repo.withContainer {
+		if err := repo.startContainer(); err != nil {
+			return err
+		}
+	} else {
+		server := NewS3Server(awssdk.Credentials{AccessKeyID: s3RepoAccessKeyId, SecretAccessKey: s3RepoSecretAccessKey})
+		if err := server.Start(); err != nil {
+			return err
+		}
+		repo.server = server
+		repo.port = server.Port()
+	}
+
+	if err := repo.mkBucket(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (repo *RepoS3) startContainer() error {
 	ctx := context.Background()
 	cName := "dummy-repo-s3"
 
@@ -235,7 +302,7 @@ func (repo *RepoS3) Start() error {
 			cName, err, err.Error())
 	}
 	repo.tc = sutC
-	repo.portLsGateway = portLsGateway
+	repo.port = portLsGateway
 
 	err = repo.tc.Start(StubLogCtx())
 	if err != nil {
@@ -243,9 +310,5 @@ func (repo *RepoS3) Start() error {
 			"DummyRepoS3.Start -- fail to start container: req-name=%s, err(%T):%s",
 			cName, err, err.Error())
 	}
-
-	if err = repo.mkBucket(); err != nil {
-		return err
-	}
 	return nil
 }
@@ -0,0 +1,112 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stubrepo
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/congop/terraform-provider-saya/internal/log"
+	"github.com/congop/terraform-provider-saya/internal/saya"
+	"github.com/pkg/errors"
+)
+
+// ImgSpecFromRelPath returns the spec of the image at the path relative to the repository base,
+// i.e. <name>/<version>/<os>/<arch>[/<arch-variant>]/img.<type>; the os variant is unknown.
+func ImgSpecFromRelPath(relPath string, repoType string) (*PullImgSpecData, error) {
+	segs := strings.Split(path.Clean(filepath.ToSlash(relPath)), "/")
+	if len(segs) != 5 && len(segs) != 6 {
+		return nil, errors.Errorf(
+			"ImgSpecFromRelPath -- path must be <name>/<version>/<os>/<arch>[/<arch-variant>]/img.<type>: path=%s", relPath)
+	}
+	imgType := strings.TrimPrefix(segs[len(segs)-1], "img.")
+	if fileName, err := ImgFileName(imgType); err != nil || fileName != segs[len(segs)-1] {
+		return nil, errors.Errorf("ImgSpecFromRelPath -- not an image file: path=%s supported-types=%v", relPath, supportedTypes)
+	}
+	platform := saya.Platform{Os: segs[2], Arch: segs[3]}
+	if len(segs) == 6 {
+		platform.ArchVariant = segs[4]
+	}
+	name, version := segs[0], segs[1]
+	return &PullImgSpecData{
+		Tag:      saya.Reference{Original: name + ":" + version, Name: name, Version: version},
+		Platform: platform,
+		RepoType: repoType,
+		ImgType:  imgType,
+	}, nil
+}
+
+// GenerateMissingImgMeta writes the meta data yaml of the images of the repository directory which have none.
+// It returns the paths, relative to dir, of the generated meta data files.
+func GenerateMissingImgMeta(dir string, repoType string) ([]string, error) {
+	generated := []string{}
+	err := filepath.WalkDir(dir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), "img.") || strings.HasSuffix(entry.Name(), ".meta") {
+			return nil
+		}
+		relPath, err := filepath.Rel(dir, filePath)
+		if err != nil {
+			return err
+		}
+		spec, err := ImgSpecFromRelPath(relPath, repoType)
+		if err != nil {
+			log.Debugf(StubLogCtx(), "GenerateMissingImgMeta -- skipping file: path=%s err=%v", relPath, err)
+			return nil
+		}
+		if _, err := os.Stat(filePath + ".meta"); err == nil {
+			return nil
+		}
+		if err := writeImgMeta(filePath, spec); err != nil {
+			return err
+		}
+		generated = append(generated, relPath+".meta")
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "GenerateMissingImgMeta -- fail to generate meta data: dir=%s err=%v", dir, err)
+	}
+	return generated, nil
+}
+
+func writeImgMeta(imgPath string, spec *PullImgSpecData) error {
+	f, err := os.Open(imgPath)
+	if err != nil {
+		return errors.Wrapf(err, "writeImgMeta -- fail to open image: path=%s err=%v", imgPath, err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return errors.Wrapf(err, "writeImgMeta -- fail to stat image: path=%s err=%v", imgPath, err)
+	}
+	sha256, err := DigestSha256(f)
+	if err != nil {
+		return err
+	}
+	meta := imgMetaData(*spec, sha256)
+	meta.CreatedAt = fi.ModTime().UTC()
+	metaBuf := bytes.Buffer{}
+	if err := PersistImgMeta(&metaBuf, meta); err != nil {
+		return err
+	}
+	_, err = writeFileStreamed(imgPath+".meta", &metaBuf)
+	return err
+}
@@ -17,6 +17,7 @@ package stubrepo
 import (
 	"bytes"
 	"io"
+	"os"
 
 	"github.com/congop/terraform-provider-saya/internal/random"
 	"github.com/congop/terraform-provider-saya/internal/saya"
@@ -57,8 +58,12 @@ func (drs *RemoteRepos) GivenHttpRepoStarted() error {
 	return nil
 }
 
+// GivenS3RepoStarted starts an in-process s3 repository, or a LocalStack container if EnvS3RepoContainer is set.
 func (drs *RemoteRepos) GivenS3RepoStarted() error {
-	r := &RepoS3{}
+	r := NewRepoS3()
+	if os.Getenv(EnvS3RepoContainer) != "" {
+		r = NewContainerRepoS3()
+	}
 	if err := r.Start(); err != nil {
 		return err
 	}
@@ -0,0 +1,850 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stubrepo
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/congop/terraform-provider-saya/internal/log"
+	"github.com/congop/terraform-provider-saya/internal/random"
+	"github.com/pkg/errors"
+	"golang.org/x/exp/maps"
+)
+
+const s3XmlNs = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+// s3StoredHeaders are the object headers set on put and returned on get and head.
+var s3StoredHeaders = []string{
+	"Cache-Control", "Content-Disposition", "Content-Encoding", "Content-Language", "Content-Type", "Expires",
+	"X-Amz-Server-Side-Encryption", "X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id", "X-Amz-Storage-Class",
+}
+
+type s3Object struct {
+	data         []byte
+	etag         string // quoted, as returned in the ETag header
+	lastModified time.Time
+	header       http.Header // stored headers, including x-amz-meta-*
+	tagCount     int
+}
+
+// s3DirBucket backs the objects of a bucket below the base key by the files of a directory.
+type s3DirBucket struct {
+	baseKey string
+	dir     string
+}
+
+// filePath returns the path of the directory file of the key; false if the key is not below the base key.
+func (dirBucket s3DirBucket) filePath(key string) (string, bool) {
+	relKey := key
+	if dirBucket.baseKey != "" {
+		if !strings.HasPrefix(key, dirBucket.baseKey+"/") {
+			return "", false
+		}
+		relKey = key[len(dirBucket.baseKey)+1:]
+	}
+	// cleaned from the root, the key cannot address a file outside of the directory
+	return filepath.Join(dirBucket.dir, filepath.FromSlash(path.Clean("/"+relKey))), true
+}
+
+type s3MultipartUpload struct {
+	bucket string
+	key    string
+	header http.Header
+	parts  map[int]*s3Object
+}
+
+// S3Server is an in-process S3 compatible server, so that s3 repositories can be used without docker.
+// It supports bucket creation, object get, put, head, delete and listing, as well as multipart uploads.
+// Objects are kept in memory, except the ones of directories served read-only with ServeDir.
+// Requests must be signed (AWS Signature Version 4) with one of the configured credentials.
+type S3Server struct {
+	mu         sync.Mutex
+	creds      map[string]string // secret access key by access key id
+	buckets    map[string]map[string]*s3Object
+	dirs       map[string]s3DirBucket // directory backing the bucket, by bucket
+	uploads    map[string]*s3MultipartUpload
+	requestLog []string
+	faults     *FaultInjector
+
+	httpServer *http.Server
+	addr       string // listen address, a random localhost port if blank
+	listenAddr string // host:port actually listened at
+	port       int
+}
+
+// NewS3Server returns a server accepting requests signed with the given credentials.
+func NewS3Server(creds ...awssdk.Credentials) *S3Server {
+	server := &S3Server{
+		creds:   map[string]string{},
+		buckets: map[string]map[string]*s3Object{},
+		dirs:    map[string]s3DirBucket{},
+		uploads: map[string]*s3MultipartUpload{},
+		faults:  newFaultInjector(writeS3Fault),
+	}
+	for _, cred := range creds {
+		server.creds[cred.AccessKeyID] = cred.SecretAccessKey
+	}
+	return server
+}
+
+// WithAddr sets the address the server listens at, e.g. 127.0.0.1:9000.
+func (server *S3Server) WithAddr(addr string) *S3Server {
+	server.addr = addr
+	return server
+}
+
+// Start starts serving at the configured address or at a random localhost port.
+func (server *S3Server) Start() error {
+	addrStr := server.addr
+	if addrStr == "" {
+		addrStr = "127.0.0.1:0"
+	}
+	ln, err := net.Listen("tcp", addrStr)
+	if err != nil {
+		return errors.Wrapf(err, "S3Server.Start -- fail to start listening at: addr=%s err=%v", addrStr, err)
+	}
+	server.port = ln.Addr().(*net.TCPAddr).Port
+	server.listenAddr = ln.Addr().String()
+	server.httpServer = &http.Server{Addr: ln.Addr().String(), Handler: server.faults.Wrap(server)}
+	go func(srv *http.Server) {
+		log.Debugf(StubLogCtx(), "S3Server.Start -- serving at: addr=%v", ln.Addr())
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Infof(StubLogCtx(), "S3Server.Start -- server stop serving: addr=%v, err=%+v", ln.Addr(), err)
+		}
+	}(server.httpServer)
+	return nil
+}
+
+// Port returns the port the server listens at.
+func (server *S3Server) Port() int {
+	return server.port
+}
+
+// Addr returns the host:port the server listens at, e.g. 127.0.0.1:9000 or [::]:9000.
+func (server *S3Server) Addr() string {
+	return server.listenAddr
+}
+
+func (server *S3Server) Close() error {
+	if server.httpServer == nil {
+		return nil
+	}
+	srv := server.httpServer
+	server.httpServer = nil
+	return srv.Close()
+}
+
+// Faults returns the injector of the faults of the server responses.
+func (server *S3Server) Faults() *FaultInjector {
+	return server.faults
+}
+
+func writeS3Fault(w http.ResponseWriter, r *http.Request, status int) {
+	switch status {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		writeS3Error(w, r, newS3Error(http.StatusForbidden, "AccessDenied", "access denied by fault"))
+	case http.StatusServiceUnavailable:
+		writeS3Error(w, r, newS3Error(status, "SlowDown", "please reduce your request rate (fault injected)"))
+	default:
+		writeS3Error(w, r, newS3Error(status, "InternalError", "we encountered an internal error (fault injected)"))
+	}
+}
+
+// CreateBucket creates the bucket if it does not exist yet, e.g. to set up a repository without s3 client.
+func (server *S3Server) CreateBucket(bucket string) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if _, exists := server.buckets[bucket]; !exists {
+		server.buckets[bucket] = map[string]*s3Object{}
+	}
+}
+
+// ServeDir serves the files of the directory as objects of the bucket, keyed <baseKey>/<path relative to dir>.
+// The bucket is created if needed. Files are streamed when got instead of being loaded in memory;
+// objects put into the bucket take precedence over them, and they are never modified or deleted.
+func (server *S3Server) ServeDir(bucket, baseKey, dir string) {
+	server.CreateBucket(bucket)
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	server.dirs[bucket] = s3DirBucket{baseKey: strings.Trim(baseKey, "/"), dir: dir}
+}
+
+// RequestLog returns the requests served so far, one "method uri status" line per request.
+func (server *S3Server) RequestLog() []string {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	return append([]string{}, server.requestLog...)
+}
+
+// s3Error is an error response of the S3 api.
+type s3Error struct {
+	status  int
+	Code    string
+	Message string
+}
+
+func (err *s3Error) Error() string {
+	return fmt.Sprintf("%s: %s", err.Code, err.Message)
+}
+
+func newS3Error(status int, code string, format string, args ...any) *s3Error {
+	return &s3Error{status: status, Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+type s3ErrorResponse struct {
+	XMLName   xml.Name `xml:"Error"`
+	Code      string   `xml:"Code"`
+	Message   string   `xml:"Message"`
+	Resource  string   `xml:"Resource"`
+	RequestId string   `xml:"RequestId"`
+}
+
+type s3StatusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *s3StatusRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (server *S3Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rec := &s3StatusRecorder{ResponseWriter: w, status: http.StatusOK}
+	if err := server.serve(rec, r); err != nil {
+		writeS3Error(rec, r, err)
+	}
+	server.mu.Lock()
+	server.requestLog = append(server.requestLog, fmt.Sprintf("%s %s %d", r.Method, r.RequestURI, rec.status))
+	server.mu.Unlock()
+}
+
+func writeS3Error(w http.ResponseWriter, r *http.Request, err error) {
+	s3Err, ok := err.(*s3Error)
+	if !ok {
+		s3Err = newS3Error(http.StatusInternalServerError, "InternalError", "%v", err)
+	}
+	log.Debugf(StubLogCtx(), "S3Server -- request failed: method=%s uri=%s err=%v", r.Method, r.RequestURI, s3Err)
+	if r.Method == http.MethodHead {
+		w.WriteHeader(s3Err.status)
+		return
+	}
+	requestId, _ := random.String(8)
+	writeS3Xml(w, s3Err.status, s3ErrorResponse{
+		Code: s3Err.Code, Message: s3Err.Message, Resource: r.URL.Path, RequestId: requestId,
+	})
+}
+
+func writeS3Xml(w http.ResponseWriter, status int, body any) {
+	bodyXml, err := xml.Marshal(body)
+	if err != nil {
+		log.Errorf(StubLogCtx(), "S3Server -- fail to marshal response: body=%#v err=%v", body, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.Header().Set("Content-Length", strconv.Itoa(len(xml.Header)+len(bodyXml)))
+	w.WriteHeader(status)
+	_, _ = io.WriteString(w, xml.Header)
+	_, _ = w.Write(bodyXml)
+}
+
+// bucketAndKey returns the bucket and key addressed by the request, virtual hosted (bucket.localhost) or path style.
+func bucketAndKey(r *http.Request) (string, string) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	if strings.HasSuffix(host, ".localhost") {
+		return strings.TrimSuffix(host, ".localhost"), path
+	}
+	bucket, key, _ := strings.Cut(path, "/")
+	return bucket, key
+}
+
+func (server *S3Server) serve(w http.ResponseWriter, r *http.Request) error {
+	body, err := readS3Body(r)
+	if err != nil {
+		return err
+	}
+	if err := verifySigV4(r, body.sha256, server.secretOf); err != nil {
+		return err
+	}
+
+	bucket, key := bucketAndKey(r)
+	query := r.URL.Query()
+	switch {
+	case bucket == "" && r.Method == http.MethodGet:
+		return server.listBuckets(w)
+	case bucket == "":
+		return newS3Error(http.StatusMethodNotAllowed, "MethodNotAllowed", "method not allowed: method=%s", r.Method)
+	case key == "" && r.Method == http.MethodPut:
+		return server.createBucket(w, bucket)
+	case key == "" && r.Method == http.MethodHead:
+		return server.headBucket(w, bucket)
+	case key == "" && r.Method == http.MethodDelete:
+		return server.deleteBucket(w, bucket)
+	case key == "" && r.Method == http.MethodGet && query.Get("list-type") == "2":
+		return server.listObjects(w, bucket, query, true)
+	case key == "" && r.Method == http.MethodGet:
+		return server.listObjects(w, bucket, query, false)
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		return server.uploadPart(w, query, body.data)
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		return newS3Error(http.StatusNotImplemented, "NotImplemented", "copy object not supported")
+	case r.Method == http.MethodPut:
+		return server.putObject(w, r, bucket, key, body.data)
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		return server.createMultipartUpload(w, r, bucket, key)
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		return server.completeMultipartUpload(w, bucket, key, query.Get("uploadId"), body.data)
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		return server.abortMultipartUpload(w, query.Get("uploadId"))
+	case r.Method == http.MethodDelete:
+		return server.deleteObject(w, bucket, key)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		return server.getObject(w, r, bucket, key)
+	default:
+		return newS3Error(http.StatusNotImplemented, "NotImplemented", "operation not supported: method=%s uri=%s", r.Method, r.RequestURI)
+	}
+}
+
+func (server *S3Server) secretOf(accessKeyId string) (string, bool) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	secret, found := server.creds[accessKeyId]
+	return secret, found
+}
+
+type s3Body struct {
+	data   []byte
+	sha256 string // hex encoded
+}
+
+// readS3Body reads the request body and checks it against the x-amz-content-sha256 header.
+func readS3Body(r *http.Request) (*s3Body, error) {
+	contentSha256 := r.Header.Get("X-Amz-Content-Sha256")
+	if strings.HasPrefix(contentSha256, "STREAMING-") {
+		return nil, newS3Error(http.StatusNotImplemented, "NotImplemented", "aws-chunked payload not supported: x-amz-content-sha256=%s", contentSha256)
+	}
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, newS3Error(http.StatusBadRequest, "IncompleteBody", "fail to read body: %v", err)
+	}
+	digest := sha256.Sum256(data)
+	body := &s3Body{data: data, sha256: hex.EncodeToString(digest[:])}
+	switch contentSha256 {
+	case "", "UNSIGNED-PAYLOAD":
+	case body.sha256:
+	default:
+		return nil, newS3Error(http.StatusBadRequest, "XAmzContentSHA256Mismatch",
+			"the provided x-amz-content-sha256 header does not match the body: provided=%s computed=%s", contentSha256, body.sha256)
+	}
+	if contentSha256 != "" {
+		body.sha256 = contentSha256
+	}
+	return body, nil
+}
+
+type s3Bucket struct {
+	Name         string `xml:"Name"`
+	CreationDate string `xml:"CreationDate"`
+}
+
+type s3ListAllMyBucketsResult struct {
+	XMLName xml.Name   `xml:"ListAllMyBucketsResult"`
+	Xmlns   string     `xml:"xmlns,attr"`
+	Buckets []s3Bucket `xml:"Buckets>Bucket"`
+}
+
+func (server *S3Server) listBuckets(w http.ResponseWriter) error {
+	server.mu.Lock()
+	names := maps.Keys(server.buckets)
+	server.mu.Unlock()
+	sort.Strings(names)
+	res := s3ListAllMyBucketsResult{Xmlns: s3XmlNs}
+	for _, name := range names {
+		res.Buckets = append(res.Buckets, s3Bucket{Name: name, CreationDate: time.Now().UTC().Format(time.RFC3339)})
+	}
+	writeS3Xml(w, http.StatusOK, res)
+	return nil
+}
+
+func (server *S3Server) createBucket(w http.ResponseWriter, bucket string) error {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if _, exists := server.buckets[bucket]; exists {
+		return newS3Error(http.StatusConflict, "BucketAlreadyOwnedByYou", "bucket already exists: bucket=%s", bucket)
+	}
+	server.buckets[bucket] = map[string]*s3Object{}
+	w.Header().Set("Location", "/"+bucket)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (server *S3Server) headBucket(w http.ResponseWriter, bucket string) error {
+	if _, err := server.bucketObjects(bucket); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (server *S3Server) deleteBucket(w http.ResponseWriter, bucket string) error {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	objects, exists := server.buckets[bucket]
+	_, dirBacked := server.dirs[bucket]
+	switch {
+	case !exists:
+		return newS3Error(http.StatusNotFound, "NoSuchBucket", "bucket does not exist: bucket=%s", bucket)
+	case len(objects) != 0 || dirBacked:
+		return newS3Error(http.StatusConflict, "BucketNotEmpty", "bucket not empty: bucket=%s", bucket)
+	}
+	delete(server.buckets, bucket)
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// bucketObjects returns the objects of the bucket, the caller must not hold the lock.
+func (server *S3Server) bucketObjects(bucket string) (map[string]*s3Object, error) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	objects, exists := server.buckets[bucket]
+	if !exists {
+		return nil, newS3Error(http.StatusNotFound, "NoSuchBucket", "bucket does not exist: bucket=%s", bucket)
+	}
+	return objects, nil
+}
+
+// s3ObjectInfo is the listed information of an object.
+type s3ObjectInfo struct {
+	etag         string
+	size         int64
+	lastModified time.Time
+	storageClass string
+}
+
+// objectInfos returns the information of the objects of the bucket by key, including the directory files.
+func (server *S3Server) objectInfos(bucket string) (map[string]s3ObjectInfo, error) {
+	server.mu.Lock()
+	objects, exists := server.buckets[bucket]
+	dirBucket, dirBacked := server.dirs[bucket]
+	infos := make(map[string]s3ObjectInfo, len(objects))
+	for key, obj := range objects {
+		storageClass := obj.header.Get("X-Amz-Storage-Class")
+		if storageClass == "" {
+			storageClass = "STANDARD"
+		}
+		infos[key] = s3ObjectInfo{etag: obj.etag, size: int64(len(obj.data)), lastModified: obj.lastModified, storageClass: storageClass}
+	}
+	server.mu.Unlock()
+	switch {
+	case !exists:
+		return nil, newS3Error(http.StatusNotFound, "NoSuchBucket", "bucket does not exist: bucket=%s", bucket)
+	case !dirBacked:
+		return infos, nil
+	}
+
+	err := filepath.WalkDir(dirBucket.dir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		relPath, err := filepath.Rel(dirBucket.dir, filePath)
+		if err != nil {
+			return err
+		}
+		key := path.Join(dirBucket.baseKey, filepath.ToSlash(relPath))
+		if _, put := infos[key]; put {
+			return nil
+		}
+		fi, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		infos[key] = s3ObjectInfo{etag: fileETag(fi), size: fi.Size(), lastModified: fi.ModTime(), storageClass: "STANDARD"}
+		return nil
+	})
+	if err != nil {
+		return nil, newS3Error(http.StatusInternalServerError, "InternalError",
+			"fail to list directory: bucket=%s dir=%s err=%v", bucket, dirBucket.dir, err)
+	}
+	return infos, nil
+}
+
+type s3Contents struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type s3CommonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+type s3ListBucketResult struct {
+	XMLName               xml.Name         `xml:"ListBucketResult"`
+	Xmlns                 string           `xml:"xmlns,attr"`
+	Name                  string           `xml:"Name"`
+	Prefix                string           `xml:"Prefix"`
+	Delimiter             string           `xml:"Delimiter,omitempty"`
+	MaxKeys               int              `xml:"MaxKeys"`
+	EncodingType          string           `xml:"EncodingType,omitempty"`
+	IsTruncated           bool             `xml:"IsTruncated"`
+	Marker                string           `xml:"Marker,omitempty"`
+	NextMarker            string           `xml:"NextMarker,omitempty"`
+	KeyCount              *int             `xml:"KeyCount,omitempty"`
+	StartAfter            string           `xml:"StartAfter,omitempty"`
+	ContinuationToken     string           `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string           `xml:"NextContinuationToken,omitempty"`
+	Contents              []s3Contents     `xml:"Contents"`
+	CommonPrefixes        []s3CommonPrefix `xml:"CommonPrefixes"`
+}
+
+// listObjects lists the objects of the bucket, as ListObjectsV2 if v2 else as ListObjects.
+func (server *S3Server) listObjects(w http.ResponseWriter, bucket string, query url.Values, v2 bool) error {
+	infos, err := server.objectInfos(bucket)
+	if err != nil {
+		return err
+	}
+	prefix, delimiter, encodingType := query.Get("prefix"), query.Get("delimiter"), query.Get("encoding-type")
+	maxKeys := 1000
+	if maxKeysStr := query.Get("max-keys"); maxKeysStr != "" {
+		if maxKeys, err = strconv.Atoi(maxKeysStr); err != nil || maxKeys < 0 {
+			return newS3Error(http.StatusBadRequest, "InvalidArgument", "invalid max-keys: max-keys=%s", maxKeysStr)
+		}
+	}
+	res := s3ListBucketResult{
+		Xmlns: s3XmlNs, Name: bucket, Prefix: prefix, Delimiter: delimiter, MaxKeys: maxKeys, EncodingType: encodingType,
+	}
+	marker := query.Get("marker")
+	if v2 {
+		res.StartAfter, res.ContinuationToken = query.Get("start-after"), query.Get("continuation-token")
+		marker = res.StartAfter
+		if token := res.ContinuationToken; token != "" {
+			tokenMarker, err := base64.StdEncoding.DecodeString(token)
+			if err != nil {
+				return newS3Error(http.StatusBadRequest, "InvalidArgument", "invalid continuation-token: token=%s", token)
+			}
+			marker = string(tokenMarker)
+		}
+	} else {
+		res.Marker = marker
+	}
+	encode := func(str string) string {
+		if encodingType == "url" {
+			return url.QueryEscape(str)
+		}
+		return str
+	}
+
+	keys := maps.Keys(infos)
+	sort.Strings(keys)
+	last := ""
+	for _, key := range keys {
+		if !strings.HasPrefix(key, prefix) || key <= marker ||
+			(delimiter != "" && strings.HasSuffix(marker, delimiter) && strings.HasPrefix(key, marker)) {
+			continue
+		}
+		commonPrefix := ""
+		if i := strings.Index(key[len(prefix):], delimiter); delimiter != "" && i >= 0 {
+			commonPrefix = key[:len(prefix)+i+len(delimiter)]
+			if commonPrefix == last {
+				continue
+			}
+		}
+		if len(res.Contents)+len(res.CommonPrefixes) >= maxKeys {
+			res.IsTruncated = true
+			break
+		}
+		if commonPrefix != "" {
+			res.CommonPrefixes = append(res.CommonPrefixes, s3CommonPrefix{Prefix: encode(commonPrefix)})
+			last = commonPrefix
+			continue
+		}
+		info := infos[key]
+		res.Contents = append(res.Contents, s3Contents{
+			Key: encode(key), LastModified: info.lastModified.UTC().Format("2006-01-02T15:04:05.000Z"),
+			ETag: info.etag, Size: info.size, StorageClass: info.storageClass,
+		})
+		last = key
+	}
+
+	if v2 {
+		keyCount := len(res.Contents) + len(res.CommonPrefixes)
+		res.KeyCount = &keyCount
+		if res.IsTruncated {
+			res.NextContinuationToken = base64.StdEncoding.EncodeToString([]byte(last))
+		}
+	} else if res.IsTruncated {
+		res.NextMarker = last
+	}
+	writeS3Xml(w, http.StatusOK, res)
+	return nil
+}
+
+// newS3Object returns the object with the given content and the stored headers.
+func newS3Object(header http.Header, data []byte) *s3Object {
+	digest := md5.Sum(data)
+	obj := &s3Object{
+		data:         data,
+		etag:         `"` + hex.EncodeToString(digest[:]) + `"`,
+		lastModified: time.Now().Truncate(time.Second),
+		header:       http.Header{},
+	}
+	for _, name := range s3StoredHeaders {
+		if val := header.Get(name); val != "" {
+			obj.header.Set(name, val)
+		}
+	}
+	for name, values := range header {
+		if strings.HasPrefix(strings.ToLower(name), "x-amz-meta-") {
+			obj.header[name] = values
+		}
+	}
+	if obj.header.Get("Content-Type") == "" {
+		obj.header.Set("Content-Type", "binary/octet-stream")
+	}
+	if tagging := header.Get("X-Amz-Tagging"); tagging != "" {
+		if tags, err := url.ParseQuery(tagging); err == nil {
+			obj.tagCount = len(tags)
+		}
+	}
+	return obj
+}
+
+func (server *S3Server) putObject(w http.ResponseWriter, r *http.Request, bucket, key string, data []byte) error {
+	if md5B64 := r.Header.Get("Content-Md5"); md5B64 != "" {
+		digest := md5.Sum(data)
+		if md5B64 != base64.StdEncoding.EncodeToString(digest[:]) {
+			return newS3Error(http.StatusBadRequest, "BadDigest", "the Content-MD5 does not match the body: key=%s", key)
+		}
+	}
+	obj := newS3Object(r.Header, data)
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	objects, exists := server.buckets[bucket]
+	if !exists {
+		return newS3Error(http.StatusNotFound, "NoSuchBucket", "bucket does not exist: bucket=%s", bucket)
+	}
+	objects[key] = obj
+	w.Header().Set("ETag", obj.etag)
+	if sse := obj.header.Get("X-Amz-Server-Side-Encryption"); sse != "" {
+		w.Header().Set("X-Amz-Server-Side-Encryption", sse)
+	}
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (server *S3Server) getObject(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	server.mu.Lock()
+	objects, exists := server.buckets[bucket]
+	dirBucket, dirBacked := server.dirs[bucket]
+	var obj *s3Object
+	if exists {
+		obj = objects[key]
+	}
+	server.mu.Unlock()
+	switch {
+	case !exists:
+		return newS3Error(http.StatusNotFound, "NoSuchBucket", "bucket does not exist: bucket=%s", bucket)
+	case obj == nil && dirBacked:
+		return serveDirObject(w, r, bucket, key, dirBucket)
+	case obj == nil:
+		return newS3Error(http.StatusNotFound, "NoSuchKey", "key does not exist: bucket=%s key=%s", bucket, key)
+	}
+	for name, values := range obj.header {
+		w.Header()[name] = values
+	}
+	w.Header().Set("ETag", obj.etag)
+	if obj.tagCount != 0 {
+		w.Header().Set("X-Amz-Tagging-Count", strconv.Itoa(obj.tagCount))
+	}
+	// handles range, conditional and head requests
+	http.ServeContent(w, r, key, obj.lastModified, bytes.NewReader(obj.data))
+	return nil
+}
+
+// serveDirObject streams the directory file of the key, supporting range, conditional and head requests.
+func serveDirObject(w http.ResponseWriter, r *http.Request, bucket, key string, dirBucket s3DirBucket) error {
+	noSuchKey := newS3Error(http.StatusNotFound, "NoSuchKey", "key does not exist: bucket=%s key=%s", bucket, key)
+	filePath, below := dirBucket.filePath(key)
+	if !below {
+		return noSuchKey
+	}
+	f, err := os.Open(filePath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Errorf(StubLogCtx(), "S3Server.serveDirObject -- fail to open: path=%s err=%v", filePath, err)
+		}
+		return noSuchKey
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil || fi.IsDir() {
+		return noSuchKey
+	}
+	w.Header().Set("Content-Type", "binary/octet-stream")
+	w.Header().Set("ETag", fileETag(fi))
+	http.ServeContent(w, r, key, fi.ModTime(), f)
+	return nil
+}
+
+func (server *S3Server) deleteObject(w http.ResponseWriter, bucket, key string) error {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	objects, exists := server.buckets[bucket]
+	if !exists {
+		return newS3Error(http.StatusNotFound, "NoSuchBucket", "bucket does not exist: bucket=%s", bucket)
+	}
+	delete(objects, key)
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+type s3InitiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	UploadId string   `xml:"UploadId"`
+}
+
+type s3CompleteMultipartUpload struct {
+	Parts []struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	} `xml:"Part"`
+}
+
+type s3CompleteMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"CompleteMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Location string   `xml:"Location"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	ETag     string   `xml:"ETag"`
+}
+
+func (server *S3Server) createMultipartUpload(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	if _, err := server.bucketObjects(bucket); err != nil {
+		return err
+	}
+	uploadId, err := random.String(16)
+	if err != nil {
+		return err
+	}
+	server.mu.Lock()
+	server.uploads[uploadId] = &s3MultipartUpload{bucket: bucket, key: key, header: r.Header.Clone(), parts: map[int]*s3Object{}}
+	server.mu.Unlock()
+	writeS3Xml(w, http.StatusOK, s3InitiateMultipartUploadResult{Xmlns: s3XmlNs, Bucket: bucket, Key: key, UploadId: uploadId})
+	return nil
+}
+
+func (server *S3Server) uploadPart(w http.ResponseWriter, query url.Values, data []byte) error {
+	partNumber, err := strconv.Atoi(query.Get("partNumber"))
+	if err != nil || partNumber < 1 {
+		return newS3Error(http.StatusBadRequest, "InvalidArgument", "invalid part number: partNumber=%s", query.Get("partNumber"))
+	}
+	uploadId := query.Get("uploadId")
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	upload, found := server.uploads[uploadId]
+	if !found {
+		return newS3Error(http.StatusNotFound, "NoSuchUpload", "upload does not exist: upload-id=%s", uploadId)
+	}
+	digest := md5.Sum(data)
+	part := &s3Object{data: data, etag: `"` + hex.EncodeToString(digest[:]) + `"`}
+	upload.parts[partNumber] = part
+	w.Header().Set("ETag", part.etag)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (server *S3Server) completeMultipartUpload(w http.ResponseWriter, bucket, key, uploadId string, body []byte) error {
+	completion := s3CompleteMultipartUpload{}
+	if err := xml.Unmarshal(body, &completion); err != nil {
+		return newS3Error(http.StatusBadRequest, "MalformedXML", "fail to unmarshal completion: %v", err)
+	}
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	upload, found := server.uploads[uploadId]
+	if !found || upload.bucket != bucket || upload.key != key {
+		return newS3Error(http.StatusNotFound, "NoSuchUpload", "upload does not exist: upload-id=%s", uploadId)
+	}
+	objects, exists := server.buckets[bucket]
+	if !exists {
+		return newS3Error(http.StatusNotFound, "NoSuchBucket", "bucket does not exist: bucket=%s", bucket)
+	}
+	data := bytes.Buffer{}
+	partDigests := bytes.Buffer{}
+	previous := 0
+	for _, completed := range completion.Parts {
+		part, found := upload.parts[completed.PartNumber]
+		switch {
+		case completed.PartNumber <= previous:
+			return newS3Error(http.StatusBadRequest, "InvalidPartOrder", "parts must be in ascending order: part-number=%d", completed.PartNumber)
+		case !found || part.etag != completed.ETag:
+			return newS3Error(http.StatusBadRequest, "InvalidPart", "part not uploaded: part-number=%d etag=%s", completed.PartNumber, completed.ETag)
+		}
+		previous = completed.PartNumber
+		data.Write(part.data)
+		digest, _ := hex.DecodeString(strings.Trim(part.etag, `"`))
+		partDigests.Write(digest)
+	}
+	obj := newS3Object(upload.header, data.Bytes())
+	digest := md5.Sum(partDigests.Bytes())
+	obj.etag = fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(digest[:]), len(completion.Parts))
+	objects[key] = obj
+	delete(server.uploads, uploadId)
+	writeS3Xml(w, http.StatusOK, s3CompleteMultipartUploadResult{
+		Xmlns: s3XmlNs, Location: "/" + bucket + "/" + key, Bucket: bucket, Key: key, ETag: obj.etag,
+	})
+	return nil
+}
+
+func (server *S3Server) abortMultipartUpload(w http.ResponseWriter, uploadId string) error {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if _, found := server.uploads[uploadId]; !found {
+		return newS3Error(http.StatusNotFound, "NoSuchUpload", "upload does not exist: upload-id=%s", uploadId)
+	}
+	delete(server.uploads, uploadId)
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
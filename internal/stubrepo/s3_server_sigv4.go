@@ -0,0 +1,161 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stubrepo
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+const sigV4Algorithm = "AWS4-HMAC-SHA256"
+
+// sigV4RequiredSignedHeaders are the headers s3 requires to be signed.
+var sigV4RequiredSignedHeaders = []string{"host", "x-amz-content-sha256"}
+
+// sigV4Auth is the parsed authorization header of a request signed with AWS Signature Version 4.
+type sigV4Auth struct {
+	accessKeyId   string
+	scope         string // date/region/service/aws4_request
+	date          string
+	signedHeaders []string
+	signature     string
+}
+
+func parseSigV4Auth(authorization string) (*sigV4Auth, error) {
+	if !strings.HasPrefix(authorization, sigV4Algorithm+" ") {
+		return nil, newS3Error(http.StatusBadRequest, "AuthorizationHeaderMalformed",
+			"authorization algorithm not supported: supported=%s", sigV4Algorithm)
+	}
+	auth := &sigV4Auth{}
+	for _, param := range strings.Split(strings.TrimPrefix(authorization, sigV4Algorithm+" "), ",") {
+		key, val, _ := strings.Cut(strings.TrimSpace(param), "=")
+		switch key {
+		case "Credential":
+			auth.accessKeyId, auth.scope, _ = strings.Cut(val, "/")
+			auth.date, _, _ = strings.Cut(auth.scope, "/")
+		case "SignedHeaders":
+			auth.signedHeaders = strings.Split(val, ";")
+		case "Signature":
+			auth.signature = val
+		}
+	}
+	if auth.accessKeyId == "" || auth.date == "" || len(auth.signedHeaders) == 0 || auth.signature == "" {
+		return nil, newS3Error(http.StatusBadRequest, "AuthorizationHeaderMalformed",
+			"authorization must have Credential, SignedHeaders and Signature: authorization=%s", authorization)
+	}
+	return auth, nil
+}
+
+// verifySigV4 checks the request signature against the secret of the signing access key.
+func verifySigV4(r *http.Request, payloadSha256 string, secretOf func(accessKeyId string) (string, bool)) error {
+	authorization := r.Header.Get("Authorization")
+	if authorization == "" {
+		return newS3Error(http.StatusForbidden, "AccessDenied", "anonymous access not allowed")
+	}
+	auth, err := parseSigV4Auth(authorization)
+	if err != nil {
+		return err
+	}
+	// the credential scope is only valid for the day the request has been signed
+	if amzDate := r.Header.Get("X-Amz-Date"); len(amzDate) < len("yyyymmdd") || auth.date != amzDate[:len("yyyymmdd")] {
+		return newS3Error(http.StatusBadRequest, "AuthorizationHeaderMalformed",
+			"the credential date does not match the x-amz-date: credential-date=%s x-amz-date=%s", auth.date, amzDate)
+	}
+	for _, required := range sigV4RequiredSignedHeaders {
+		if !slices.Contains(auth.signedHeaders, required) {
+			return newS3Error(http.StatusForbidden, "AccessDenied",
+				"the header must be signed: header=%s signed-headers=%s", required, strings.Join(auth.signedHeaders, ";"))
+		}
+	}
+	secret, found := secretOf(auth.accessKeyId)
+	if !found {
+		return newS3Error(http.StatusForbidden, "InvalidAccessKeyId",
+			"the access key id does not exist in our records: access-key-id=%s", auth.accessKeyId)
+	}
+
+	canonicalRequest := sigV4CanonicalRequest(r, auth.signedHeaders, payloadSha256)
+	signature := sigV4Signature(secret, auth.scope, r.Header.Get("X-Amz-Date"), canonicalRequest)
+	if !hmac.Equal([]byte(signature), []byte(auth.signature)) {
+		return newS3Error(http.StatusForbidden, "SignatureDoesNotMatch",
+			"the request signature we calculated does not match the signature you provided: canonical-request=%q", canonicalRequest)
+	}
+	return nil
+}
+
+// sigV4Signature returns the signature of the canonical request signed at the date for the credential scope.
+func sigV4Signature(secret, scope, amzDate, canonicalRequest string) string {
+	canonicalRequestSha256 := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		sigV4Algorithm, amzDate, scope, hex.EncodeToString(canonicalRequestSha256[:]),
+	}, "\n")
+
+	signingKey := []byte("AWS4" + secret)
+	for _, scopePart := range strings.Split(scope, "/") {
+		signingKey = hmacSha256(signingKey, scopePart)
+	}
+	return hex.EncodeToString(hmacSha256(signingKey, stringToSign))
+}
+
+func sigV4CanonicalRequest(r *http.Request, signedHeaders []string, payloadSha256 string) string {
+	canonicalUri, _, _ := strings.Cut(r.RequestURI, "?")
+	if canonicalUri == "" {
+		canonicalUri = "/"
+	}
+	canonicalQuery := strings.ReplaceAll(r.URL.Query().Encode(), "+", "%20")
+
+	// signed headers are sorted by name in the authorization header
+	headers := make([]string, 0, len(signedHeaders))
+	for _, name := range signedHeaders {
+		headers = append(headers, name+":"+sigV4HeaderValue(r, name))
+	}
+
+	return strings.Join([]string{
+		r.Method,
+		canonicalUri,
+		canonicalQuery,
+		strings.Join(headers, "\n") + "\n",
+		strings.Join(signedHeaders, ";"),
+		payloadSha256,
+	}, "\n")
+}
+
+// sigV4HeaderValue returns the canonical value of the header, i.e. trimmed with sequential spaces collapsed.
+func sigV4HeaderValue(r *http.Request, name string) string {
+	switch name {
+	case "host":
+		return r.Host
+	case "content-length":
+		if r.ContentLength >= 0 && r.Header.Get("Content-Length") == "" {
+			return strconv.FormatInt(r.ContentLength, 10)
+		}
+	}
+	values := []string{}
+	for _, val := range r.Header.Values(name) {
+		values = append(values, strings.Join(strings.Fields(val), " "))
+	}
+	return strings.Join(values, ",")
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
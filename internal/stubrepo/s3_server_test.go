@@ -0,0 +1,252 @@
+// Copyright (C) 2023 Patrice Congo <@congop>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stubrepo
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/congop/terraform-provider-saya/internal/saya"
+	"github.com/stretchr/testify/require"
+)
+
+var s3ServerTestCreds = awssdk.Credentials{AccessKeyID: "tester", SecretAccessKey: "secret"}
+
+func givenS3ServerStarted(t *testing.T) *S3Server {
+	server := NewS3Server(s3ServerTestCreds)
+	require.NoError(t, server.Start())
+	t.Cleanup(func() { _ = server.Close() })
+	return server
+}
+
+func s3ServerTestClient(t *testing.T, server *S3Server, creds awssdk.Credentials) *s3.Client {
+	epUrl := fmt.Sprintf("http://localhost:%d", server.Port())
+	cfg, err := LoadConfig(StubLogCtx(), &AwsEndpointSpec{Url: epUrl, S3Url: epUrl + "/"}, &creds, "us-east-1")
+	require.NoError(t, err)
+	return s3.NewFromConfig(*cfg, func(o *s3.Options) { o.UsePathStyle = true })
+}
+
+func requireS3ErrorCode(t *testing.T, err error, wantCode string) {
+	require.Error(t, err)
+	var apiErr smithy.APIError
+	require.ErrorAs(t, err, &apiErr)
+	require.Equal(t, wantCode, apiErr.ErrorCode())
+}
+
+func TestS3ServerObjectLifecycle(t *testing.T) {
+	ctx := context.Background()
+	server := givenS3ServerStarted(t)
+	client := s3ServerTestClient(t, server, s3ServerTestCreds)
+	bucket := "bucket"
+
+	_, err := client.CreateBucket(ctx, &s3.CreateBucketInput{Bucket: &bucket})
+	require.NoError(t, err)
+	_, err = client.CreateBucket(ctx, &s3.CreateBucketInput{Bucket: &bucket})
+	requireS3ErrorCode(t, err, "BucketAlreadyOwnedByYou")
+
+	for _, key := range []string{"rbase/linux/amd64/alpine/v1/img.qcow2", "rbase/linux/amd64/alpine/v1/img.qcow2.meta", "rbase/readme"} {
+		_, err = client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket:               &bucket,
+			Key:                  awssdk.String(key),
+			Body:                 strings.NewReader("content of " + key),
+			ContentType:          awssdk.String("text/plain"),
+			Metadata:             map[string]string{"origin": "test"},
+			ServerSideEncryption: types.ServerSideEncryptionAes256,
+			StorageClass:         types.StorageClassStandardIa,
+		})
+		require.NoError(t, err)
+	}
+
+	head, err := client.HeadObject(ctx, &s3.HeadObjectInput{Bucket: &bucket, Key: awssdk.String("rbase/readme")})
+	require.NoError(t, err)
+	require.Equal(t, int64(len("content of rbase/readme")), head.ContentLength)
+	require.Equal(t, "text/plain", *head.ContentType)
+	require.Equal(t, map[string]string{"origin": "test"}, head.Metadata)
+	require.Equal(t, types.ServerSideEncryptionAes256, head.ServerSideEncryption)
+	require.Equal(t, types.StorageClassStandardIa, head.StorageClass)
+
+	got, err := client.GetObject(ctx, &s3.GetObjectInput{Bucket: &bucket, Key: awssdk.String("rbase/readme"), Range: awssdk.String("bytes=11-")})
+	require.NoError(t, err)
+	gotContent, err := io.ReadAll(got.Body)
+	require.NoError(t, err)
+	require.Equal(t, "rbase/readme", string(gotContent))
+	require.Equal(t, *head.ETag, *got.ETag)
+
+	listed, err := client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+		Bucket: &bucket, Prefix: awssdk.String("rbase/"), Delimiter: awssdk.String("/"),
+	})
+	require.NoError(t, err)
+	require.Len(t, listed.Contents, 1)
+	require.Equal(t, "rbase/readme", *listed.Contents[0].Key)
+	require.Len(t, listed.CommonPrefixes, 1)
+	require.Equal(t, "rbase/linux/", *listed.CommonPrefixes[0].Prefix)
+
+	keys := []string{}
+	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{Bucket: &bucket, MaxKeys: 2})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		require.NoError(t, err)
+		for _, obj := range page.Contents {
+			keys = append(keys, *obj.Key)
+		}
+	}
+	require.Equal(t, []string{
+		"rbase/linux/amd64/alpine/v1/img.qcow2", "rbase/linux/amd64/alpine/v1/img.qcow2.meta", "rbase/readme",
+	}, keys)
+
+	_, err = client.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: &bucket, Key: awssdk.String("rbase/readme")})
+	require.NoError(t, err)
+	_, err = client.GetObject(ctx, &s3.GetObjectInput{Bucket: &bucket, Key: awssdk.String("rbase/readme")})
+	requireS3ErrorCode(t, err, "NoSuchKey")
+	_, err = client.GetObject(ctx, &s3.GetObjectInput{Bucket: awssdk.String("no-bucket"), Key: awssdk.String("rbase/readme")})
+	requireS3ErrorCode(t, err, "NoSuchBucket")
+}
+
+func TestS3ServerMultipartUpload(t *testing.T) {
+	ctx := context.Background()
+	server := givenS3ServerStarted(t)
+	server.CreateBucket("bucket")
+	client := s3ServerTestClient(t, server, s3ServerTestCreds)
+	content := bytes.Repeat([]byte("0123456789abcdef"), 7*1024*1024/16)
+
+	uploader := manager.NewUploader(client, func(u *manager.Uploader) { u.PartSize = manager.MinUploadPartSize })
+	_, err := uploader.Upload(ctx, &s3.PutObjectInput{
+		Bucket: awssdk.String("bucket"), Key: awssdk.String("img.qcow2"), Body: bytes.NewReader(content),
+	})
+	require.NoError(t, err)
+
+	got, err := client.GetObject(ctx, &s3.GetObjectInput{Bucket: awssdk.String("bucket"), Key: awssdk.String("img.qcow2")})
+	require.NoError(t, err)
+	gotContent, err := io.ReadAll(got.Body)
+	require.NoError(t, err)
+	require.Equal(t, content, gotContent)
+	require.True(t, strings.HasSuffix(*got.ETag, `-2"`), "multipart etag expected: etag=%s", *got.ETag)
+}
+
+func TestS3ServerRejectsUnauthenticatedRequests(t *testing.T) {
+	server := givenS3ServerStarted(t)
+	server.CreateBucket("bucket")
+
+	testCases := []struct {
+		name     string
+		creds    awssdk.Credentials
+		wantCode string
+	}{
+		{name: "wrong secret", creds: awssdk.Credentials{AccessKeyID: "tester", SecretAccessKey: "wrong"}, wantCode: "SignatureDoesNotMatch"},
+		{name: "unknown access key", creds: awssdk.Credentials{AccessKeyID: "unknown", SecretAccessKey: "secret"}, wantCode: "InvalidAccessKeyId"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := s3ServerTestClient(t, server, tc.creds)
+
+			_, err := client.PutObject(context.Background(), &s3.PutObjectInput{
+				Bucket: awssdk.String("bucket"), Key: awssdk.String("key"), Body: strings.NewReader("content"),
+			})
+
+			requireS3ErrorCode(t, err, tc.wantCode)
+		})
+	}
+
+	t.Run("anonymous", func(t *testing.T) {
+		res, err := http.Get(fmt.Sprintf("http://localhost:%d/bucket/key", server.Port()))
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusForbidden, res.StatusCode)
+	})
+}
+
+func TestVerifySigV4RejectsBadCredentialScopeAndSignedHeaders(t *testing.T) {
+	const amzDate = "20231005T135240Z"
+	emptySha256 := hex.EncodeToString(sha256.New().Sum(nil))
+	secretOf := func(accessKeyId string) (string, bool) { return s3ServerTestCreds.SecretAccessKey, true }
+	testCases := []struct {
+		name          string
+		scopeDate     string
+		signedHeaders []string
+		wantCode      string
+	}{
+		{name: "valid", scopeDate: "20231005", signedHeaders: []string{"host", "x-amz-content-sha256", "x-amz-date"}},
+		{
+			name: "credential date not matching x-amz-date", scopeDate: "20231004",
+			signedHeaders: []string{"host", "x-amz-content-sha256", "x-amz-date"}, wantCode: "AuthorizationHeaderMalformed",
+		},
+		{name: "host not signed", scopeDate: "20231005", signedHeaders: []string{"x-amz-content-sha256", "x-amz-date"}, wantCode: "AccessDenied"},
+		{name: "content sha256 not signed", scopeDate: "20231005", signedHeaders: []string{"host", "x-amz-date"}, wantCode: "AccessDenied"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "http://localhost/bucket/key", nil)
+			r.Header.Set("X-Amz-Date", amzDate)
+			r.Header.Set("X-Amz-Content-Sha256", emptySha256)
+			// validly signed, so that only the scope and signed headers checks can reject the request
+			scope := tc.scopeDate + "/us-east-1/s3/aws4_request"
+			signature := sigV4Signature(s3ServerTestCreds.SecretAccessKey, scope, amzDate,
+				sigV4CanonicalRequest(r, tc.signedHeaders, emptySha256))
+			r.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+				sigV4Algorithm, s3ServerTestCreds.AccessKeyID, scope, strings.Join(tc.signedHeaders, ";"), signature))
+
+			err := verifySigV4(r, emptySha256, secretOf)
+
+			if tc.wantCode == "" {
+				require.NoError(t, err)
+				return
+			}
+			var s3Err *s3Error
+			require.ErrorAs(t, err, &s3Err)
+			require.Equal(t, tc.wantCode, s3Err.Code)
+		})
+	}
+}
+
+func TestRepoS3RegisterDummyImg(t *testing.T) {
+	repo := NewRepoS3()
+	require.NoError(t, repo.Start())
+	t.Cleanup(func() { _ = repo.Close() })
+
+	img, err := GivenImgInRemoteRepoBySpec(repo.RegisterDummyImg, PullImgSpecData{
+		Tag:       saya.Reference{Original: "alpine:v1", Name: "alpine", Version: "v1"},
+		OsVariant: "alpine",
+		Platform:  saya.Platform{Os: "linux", Arch: "amd64"},
+		RepoType:  "s3",
+		ImgType:   "qcow2",
+	}, true)
+	require.NoError(t, err)
+
+	s3Repo := repo.AsRepos().S3
+	client, err := repo.getS3Client()
+	require.NoError(t, err)
+	listed, err := client.ListObjectsV2(context.Background(), &s3.ListObjectsV2Input{Bucket: &s3Repo.Bucket},
+		func(o *s3.Options) { o.UsePathStyle = true })
+	require.NoError(t, err)
+	keys := []string{}
+	for _, obj := range listed.Contents {
+		keys = append(keys, *obj.Key)
+	}
+	require.Equal(t, []string{"rbase/alpine/v1/linux/amd64/img.qcow2", "rbase/alpine/v1/linux/amd64/img.qcow2.meta"}, keys)
+	require.NotEmpty(t, img.Sha256)
+}